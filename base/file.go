@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/fxamacker/cbor/v2"
@@ -66,6 +67,7 @@ func (fi *FSFileInfo) SetFilename(name string) error {
 type FSDirEntry struct {
 	name   string
 	isFile bool
+	info   *dirEntryInfo
 }
 
 var _ fs.DirEntry = (*FSDirEntry)(nil)
@@ -77,15 +79,45 @@ func NewFSDirEntry(name string, isFile bool) FSDirEntry {
 	}
 }
 
+// NewFSDirEntryStat creates a directory entry that calls stat to load file
+// info the first time it's needed, like os.ReadDir. stat must not follow
+// symlinks. Entries for files call stat to report the type of symlinks
+func NewFSDirEntryStat(name string, isFile bool, stat func() (fs.FileInfo, error)) FSDirEntry {
+	return FSDirEntry{
+		name:   name,
+		isFile: isFile,
+		info:   &dirEntryInfo{stat: stat},
+	}
+}
+
+type dirEntryInfo struct {
+	once sync.Once
+	stat func() (fs.FileInfo, error)
+	fi   fs.FileInfo
+	err  error
+}
+
 func (de FSDirEntry) Name() string { return de.name }
 func (de FSDirEntry) IsDir() bool  { return !de.isFile }
 func (ds FSDirEntry) Type() fs.FileMode {
-	if ds.isFile {
-		return 0
+	if !ds.isFile {
+		return fs.ModeDir
+	}
+	if fi, err := ds.Info(); err == nil {
+		return fi.Mode().Type()
+	}
+	return 0
+}
+
+func (ds FSDirEntry) Info() (fs.FileInfo, error) {
+	if ds.info == nil {
+		return nil, fmt.Errorf("no file info for directory entry %q", ds.name)
 	}
-	return fs.ModeDir
+	ds.info.once.Do(func() {
+		ds.info.fi, ds.info.err = ds.info.stat()
+	})
+	return ds.info.fi, ds.info.err
 }
-func (ds FSDirEntry) Info() (fs.FileInfo, error) { return nil, errors.New("FSDirEntry.FileInfo") }
 
 // memfile is an in-memory file
 type memfile struct {
@@ -154,6 +186,96 @@ func (m memfile) Close() error {
 	return nil
 }
 
+// ErrNotSeekable is returned when seeking file contents that don't support
+// random access, like files that haven't been written to the filesystem yet
+var ErrNotSeekable = errors.New("file contents are not seekable")
+
+// Seek sets the offset for the next read of contents r
+func Seek(r io.Reader, offset int64, whence int) (int64, error) {
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return 0, ErrNotSeekable
+	}
+	return s.Seek(offset, whence)
+}
+
+// ReaderAt implements io.ReaderAt with a seekable reader dedicated to ReadAt
+// calls. ReaderAt seeks only when reads aren't sequential, so runs of small
+// reads don't refetch blocks. ReaderAt is safe for parallel use
+type ReaderAt struct {
+	lk  sync.Mutex
+	r   io.ReadSeeker
+	pos int64
+}
+
+// NewReaderAt creates a ReaderAt from r, which must implement io.Seeker
+func NewReaderAt(r io.Reader) (*ReaderAt, error) {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		return nil, ErrNotSeekable
+	}
+	pos, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return &ReaderAt{r: rs, pos: pos}, nil
+}
+
+// ReadAt reads len(p) bytes starting at off
+func (ra *ReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	ra.lk.Lock()
+	defer ra.lk.Unlock()
+	if off != ra.pos {
+		if ra.pos, err = ra.r.Seek(off, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	n, err = io.ReadFull(ra.r, p)
+	ra.pos += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Close closes the underlying reader if it implements io.Closer
+func (ra *ReaderAt) Close() error {
+	if closer, ok := ra.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// memSymlink is an in-memory symlink, used to write links to a file hierarchy
+type memSymlink struct {
+	fi     *FSFileInfo
+	target string
+}
+
+// Confirm that memSymlink satisfies the Symlink interface
+var _ = (Symlink)(&memSymlink{})
+
+// NewMemSymlink creates a symlink that points to target
+func NewMemSymlink(name, target string) Symlink {
+	return &memSymlink{
+		fi: &FSFileInfo{
+			name:  name,
+			size:  int64(len(target)),
+			mode:  fs.ModeSymlink,
+			mtime: Timestamp(),
+		},
+		target: target,
+	}
+}
+
+func (m *memSymlink) Stat() (fs.FileInfo, error) { return m.fi, nil }
+func (m *memSymlink) Target() string             { return m.target }
+func (m *memSymlink) Read(p []byte) (int, error) { return 0, io.EOF }
+func (m *memSymlink) Close() error               { return nil }
+
 type CBORFiler interface {
 	CBORFile() (fs.File, error)
 }
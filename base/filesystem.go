@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/fs"
 	"sort"
+	"time"
 
 	blocks "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
@@ -14,7 +15,19 @@ import (
 	multihash "github.com/multiformats/go-multihash"
 )
 
-var ErrNotFound = errors.New("not found")
+var (
+	// ErrNotFound is returned when a path doesn't exist. ErrNotFound matches
+	// fs.ErrNotExist with errors.Is
+	ErrNotFound error = notFoundError{}
+	// ErrSymlinkLoop is returned when resolving a path encounters a symlink
+	// cycle, or follows more than MaxSymlinkDepth symlinks
+	ErrSymlinkLoop = errors.New("too many levels of symbolic links")
+)
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string        { return "not found" }
+func (notFoundError) Is(target error) bool { return target == fs.ErrNotExist }
 
 const (
 	// LatestVersion is the most recent semantic version of WNFS this
@@ -35,18 +48,84 @@ const (
 )
 
 const (
-	ModeDefault = 644
+	// ModeDefault is the permission bits of new files & symlinks
+	ModeDefault = 0644
+	// ModeDirDefault is the permission bits of new directories
+	ModeDirDefault = 0755
+	// legacyModeDefault is the mode headers recorded before modes were stored
+	// as permission bits, 644 written as a decimal number
+	legacyModeDefault = 644
+	// legacyTimestampLimit bounds timestamps headers recorded before
+	// timestamps were stored in milliseconds. Seconds below the limit are
+	// dates before the year 5138, milliseconds below it are before March 1973
+	legacyTimestampLimit = 1e11
 )
 
+// EncodeMode returns the permission bits of mode as stored in node headers
+func EncodeMode(mode fs.FileMode) uint32 {
+	return uint32(mode.Perm())
+}
+
+// DecodeMode returns the permission bits stored in a node header
+func DecodeMode(mode uint32) fs.FileMode {
+	if mode == legacyModeDefault {
+		return ModeDefault
+	}
+	return fs.FileMode(mode).Perm()
+}
+
+// EncodeTimestamp returns t in milliseconds since the unix epoch, the
+// precision of timestamps stored in node headers
+func EncodeTimestamp(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+// DecodeTimestamp returns the time of a millisecond timestamp stored in a node
+// header. Values below legacyTimestampLimit are read as seconds, the precision
+// of headers written before timestamps were stored in milliseconds
+func DecodeTimestamp(ms int64) time.Time {
+	if ms >= 0 && ms < legacyTimestampLimit {
+		return time.Unix(ms, 0)
+	}
+	return time.UnixMilli(ms)
+}
+
+// SourceAttrs returns the mode & modification time to record for a node
+// written from a file with info fi. fi values without permission bits use
+// mode, zero modification times use the current time
+func SourceAttrs(fi fs.FileInfo, mode uint32) (uint32, int64) {
+	mtime := Timestamp()
+	if fi == nil {
+		return mode, EncodeTimestamp(mtime)
+	}
+	if fi.Mode().Perm() != 0 {
+		mode = EncodeMode(fi.Mode())
+	}
+	if !fi.ModTime().IsZero() {
+		mtime = fi.ModTime()
+	}
+	return mode, EncodeTimestamp(mtime)
+}
+
+// CtimeInfo is implemented by nodes that record their creation time
+type CtimeInfo interface {
+	fs.FileInfo
+	Ctime() time.Time
+}
+
+// MaxSymlinkDepth is the maximum number of symlinks followed while resolving
+// a single path
+const MaxSymlinkDepth = 40
+
 type NodeType uint8
 
 const (
 	NTFile NodeType = iota
 	NTLDFile
 	NTDir
-	NTSymlink    // reserved for future use
-	NTUnixFSFile // reserved for future use
-	NTUnixFSDir  // reserved for future use
+	NTSymlink
+	NTUnixFSFile // plain unixfs file, used by the pretty branch
+	NTUnixFSDir  // plain unixfs directory, used by the pretty branch
 )
 
 func (nt NodeType) String() string {
@@ -86,6 +165,13 @@ type File interface {
 	Node
 }
 
+// Symlink is a file that points to another path within the same file
+// hierarchy
+type Symlink interface {
+	fs.File
+	Target() string
+}
+
 type LDFile interface {
 	fs.File
 	fs.ReadDirFile
@@ -100,6 +186,8 @@ type Tree interface {
 	Copy(path Path, srcPath string, src fs.FS) (PutResult, error)
 	Rm(path Path) (PutResult, error)
 	Mkdir(path Path) (PutResult, error)
+	Mv(from, to Path) (PutResult, error)
+	Readlink(path Path) (string, error)
 }
 
 type PutResult interface {
@@ -0,0 +1,64 @@
+package base
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestModeEncoding(t *testing.T) {
+	cases := []struct {
+		stored uint32
+		expect fs.FileMode
+	}{
+		{EncodeMode(0600), 0600},
+		{EncodeMode(fs.ModeDir | 0755), 0755},
+		{EncodeMode(fs.ModeSymlink | 0777), 0777},
+		// headers written before modes were stored as permission bits
+		{644, 0644},
+	}
+
+	for _, c := range cases {
+		if got := DecodeMode(c.stored); got != c.expect {
+			t.Errorf("decoding mode %o. want: %s got: %s", c.stored, c.expect, got)
+		}
+	}
+}
+
+func TestTimestampEncoding(t *testing.T) {
+	now := time.Date(2022, 6, 7, 8, 9, 10, 123000000, time.UTC)
+	cases := []struct {
+		stored int64
+		expect time.Time
+	}{
+		{EncodeTimestamp(now), now},
+		// headers written before timestamps were stored in milliseconds
+		{now.Unix(), now.Truncate(time.Second)},
+		{0, time.Unix(0, 0)},
+	}
+
+	for _, c := range cases {
+		if got := DecodeTimestamp(c.stored); !got.Equal(c.expect) {
+			t.Errorf("decoding timestamp %d. want: %s got: %s", c.stored, c.expect, got)
+		}
+	}
+}
+
+func TestSourceAttrs(t *testing.T) {
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 891234567, time.UTC)
+	mode, ts := SourceAttrs(NewFSFileInfo("a", 0, 0600, mtime, nil), ModeDefault)
+	if mode != 0600 {
+		t.Errorf("expected mode 0600, got %o", mode)
+	}
+	if !DecodeTimestamp(ts).Equal(mtime.Truncate(time.Millisecond)) {
+		t.Errorf("expected timestamp %s, got %s", mtime, DecodeTimestamp(ts))
+	}
+
+	mode, ts = SourceAttrs(NewFSFileInfo("a", 0, 0, time.Time{}, nil), ModeDefault)
+	if mode != ModeDefault {
+		t.Errorf("expected default mode for file without permission bits, got %o", mode)
+	}
+	if ts == 0 {
+		t.Errorf("expected current time for file without modification time")
+	}
+}
@@ -0,0 +1,138 @@
+package base
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// GlobMatcher matches slash-separated paths against a list of gitignore-style
+// patterns:
+//   - "*" matches any sequence of characters except "/", "?" matches any single
+//     character except "/"
+//   - "**" matches any number of directories
+//   - patterns without a slash match a name at any depth, patterns containing
+//     a slash are relative to the root. a leading "/" is ignored
+//   - a trailing "/" only matches directories
+//   - a leading "!" negates the pattern, re-including paths matched by
+//     earlier patterns
+//
+// when multiple patterns match a path the last one wins
+type GlobMatcher struct {
+	patterns []globPattern
+}
+
+type globPattern struct {
+	re      *regexp.Regexp
+	dirOnly bool
+	negate  bool
+}
+
+// NewGlobMatcher compiles a list of patterns. blank patterns & patterns
+// starting with "#" are ignored
+func NewGlobMatcher(patterns []string) (*GlobMatcher, error) {
+	m := &GlobMatcher{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		orig := p
+		gp := globPattern{}
+		if strings.HasPrefix(p, "!") {
+			gp.negate = true
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			gp.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+
+		anchored := strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+		if p == "" {
+			return nil, fmt.Errorf("invalid pattern %q", orig)
+		}
+
+		expr := globToRegexp(p)
+		if !anchored {
+			expr = "(.*/)?" + expr
+		}
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", orig, err)
+		}
+		gp.re = re
+		m.patterns = append(m.patterns, gp)
+	}
+	return m, nil
+}
+
+// Len returns the number of patterns in the matcher
+func (m *GlobMatcher) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.patterns)
+}
+
+// Match returns true if path matches. isDir reports whether path is a
+// directory
+func (m *GlobMatcher) Match(path string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	path = strings.Trim(path, "/")
+	matched := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(path) {
+			matched = !p.negate
+		}
+	}
+	return matched
+}
+
+// MatchAncestors returns true if path or any of its parent directories match
+func (m *GlobMatcher) MatchAncestors(path string, isDir bool) bool {
+	path = strings.Trim(path, "/")
+	if m.Match(path, isDir) {
+		return true
+	}
+	for i := strings.LastIndex(path, "/"); i > 0; i = strings.LastIndex(path, "/") {
+		path = path[:i]
+		if m.Match(path, true) {
+			return true
+		}
+	}
+	return false
+}
+
+func globToRegexp(pattern string) string {
+	buf := &strings.Builder{}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/" matches zero or more directories
+					i++
+					buf.WriteString("(.*/)?")
+				} else {
+					buf.WriteString(".*")
+				}
+				continue
+			}
+			buf.WriteString("[^/]*")
+		case '?':
+			buf.WriteString("[^/]")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return buf.String()
+}
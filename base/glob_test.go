@@ -0,0 +1,50 @@
+package base
+
+import "testing"
+
+func TestGlobMatcher(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		expect   bool
+	}{
+		{[]string{"*.txt"}, "a.txt", false, true},
+		{[]string{"*.txt"}, "dir/sub/a.txt", false, true},
+		{[]string{"*.txt"}, "a.txt.bak", false, false},
+		{[]string{"/*.txt"}, "dir/a.txt", false, false},
+		{[]string{"dir/*.txt"}, "dir/a.txt", false, true},
+		{[]string{"dir/*.txt"}, "dir/sub/a.txt", false, false},
+		{[]string{"dir/**/*.txt"}, "dir/sub/deep/a.txt", false, true},
+		{[]string{"dir/**/*.txt"}, "dir/a.txt", false, true},
+		{[]string{"**/node_modules"}, "a/b/node_modules", true, true},
+		{[]string{"build/"}, "build", true, true},
+		{[]string{"build/"}, "build", false, false},
+		{[]string{"?.md"}, "a.md", false, true},
+		{[]string{"?.md"}, "ab.md", false, false},
+		{[]string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{[]string{"*.log", "!keep.log"}, "drop.log", false, true},
+		{[]string{"# comment", ""}, "# comment", false, false},
+	}
+
+	for _, c := range cases {
+		m, err := NewGlobMatcher(c.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Match(c.path, c.isDir); got != c.expect {
+			t.Errorf("patterns %v matching %q (dir: %t). want: %t got: %t", c.patterns, c.path, c.isDir, c.expect, got)
+		}
+	}
+
+	m, err := NewGlobMatcher([]string{"vendor/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.MatchAncestors("vendor/pkg/a.go", false) {
+		t.Errorf("expected file in matched directory to match")
+	}
+	if m.MatchAncestors("src/a.go", false) {
+		t.Errorf("expected unmatched file not to match")
+	}
+}
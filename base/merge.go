@@ -8,6 +8,8 @@ import (
 	"github.com/ipfs/go-cid"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	cbornode "github.com/ipfs/go-ipld-cbor"
+	format "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
 )
 
 // ErrNoCommonHistory signifies a merge error where two nodes share no common
@@ -78,6 +80,46 @@ func CopyBlocks(ctx context.Context, id cid.Cid, src, dst blockservice.BlockServ
 	return dst.Blockstore().Put(ctx, blk)
 }
 
+// WalkBlocks calls visit with the CID of id & every block reachable from it
+// through the links of dag-cbor & dag-pb blocks, depth first. Blocks are only
+// loaded & their links followed when visit returns true
+func WalkBlocks(ctx context.Context, bserv blockservice.BlockService, id cid.Cid, visit func(id cid.Cid) bool) error {
+	if !visit(id) {
+		return nil
+	}
+
+	var links []*format.Link
+	switch id.Type() {
+	case cid.DagCBOR:
+		blk, err := bserv.GetBlock(ctx, id)
+		if err != nil {
+			return err
+		}
+		n, err := cbornode.DecodeBlock(blk)
+		if err != nil {
+			return err
+		}
+		links = n.Links()
+	case cid.DagProtobuf:
+		blk, err := bserv.GetBlock(ctx, id)
+		if err != nil {
+			return err
+		}
+		n, err := merkledag.DecodeProtobufBlock(blk)
+		if err != nil {
+			return err
+		}
+		links = n.Links()
+	}
+
+	for _, l := range links {
+		if err := WalkBlocks(ctx, bserv, l.Cid, visit); err != nil {
+			return fmt.Errorf("walking block %q: %w", l.Cid, err)
+		}
+	}
+	return nil
+}
+
 func AllKeys(ctx context.Context, bs blockstore.Blockstore) ([]cid.Cid, error) {
 	keys, err := bs.AllKeysChan(ctx)
 	if err != nil {
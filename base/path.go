@@ -31,3 +31,11 @@ func (p Path) Shift() (head string, ch Path) {
 		return p[0], p[1:]
 	}
 }
+
+// SymlinkPath parses a symlink target into path components. Absolute targets
+// are relative to the root of the file hierarchy containing the link, relative
+// targets are relative to the directory containing the link
+func SymlinkPath(target string) (p Path, abs bool) {
+	abs = strings.HasPrefix(target, "/")
+	return strings.Split(strings.Trim(target, "/"), "/"), abs
+}
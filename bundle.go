@@ -0,0 +1,127 @@
+package wnfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	base "github.com/functionland/wnfs-go/base"
+	private "github.com/functionland/wnfs-go/private"
+	cid "github.com/ipfs/go-cid"
+)
+
+// CreateBundle writes a bundle for syncing the filesystem at head to a peer
+// whose latest known version is since. Bundles are CARv1 files listing head &
+// since as roots, containing blocks of head that aren't part of since. An
+// undefined since bundles all blocks of head.
+//
+// Bundles carry no keys. Peers open the private hierarchy of a bundle by
+// ratcheting forward from their own keys for since
+func (fac Factory) CreateBundle(ctx context.Context, head, since cid.Cid, w io.Writer) error {
+	ids, err := fac.carBlocks(ctx, head)
+	if err != nil {
+		return err
+	}
+	roots := []cid.Cid{head}
+
+	if since.Defined() {
+		known, err := fac.carBlocks(ctx, since)
+		if err != nil {
+			return fmt.Errorf("listing blocks of %s: %w", since, err)
+		}
+		skip := make(map[cid.Cid]struct{}, len(known))
+		for _, id := range known {
+			skip[id] = struct{}{}
+		}
+		missing := make([]cid.Cid, 0, len(ids))
+		for _, id := range ids {
+			if _, ok := skip[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		ids = missing
+		roots = append(roots, since)
+	}
+
+	_, _, err = fac.writeCARv1(ctx, w, roots, ids)
+	return err
+}
+
+// ApplyBundle imports the blocks of a bundle read from r & merges the bundled
+// version into fs, returning the bundled root. Callers must commit fs to keep
+// the merge. The factory must have decryption fields for the bundled root or
+// the version the bundle was created against. Decryption fields derived for
+// the bundled root are saved when the decryption store is writable
+func (fac Factory) ApplyBundle(ctx context.Context, fs WNFS, r io.Reader) (head cid.Cid, err error) {
+	roots, err := fac.ImportCAR(ctx, r)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("importing bundle: %w", err)
+	}
+	if len(roots) < 1 || len(roots) > 2 {
+		return cid.Undef, fmt.Errorf("invalid bundle: expected 1 or 2 roots, got %d", len(roots))
+	}
+	head = roots[0]
+	since := cid.Undef
+	if len(roots) == 2 {
+		since = roots[1]
+	}
+
+	remote, err := fac.loadBundleHead(ctx, head, since)
+	if err != nil {
+		return head, err
+	}
+	if err := Merge(ctx, fs, remote); err != nil {
+		return head, fmt.Errorf("merging %s: %w", head, err)
+	}
+	return head, nil
+}
+
+func (fac Factory) loadBundleHead(ctx context.Context, head, since cid.Cid) (WNFS, error) {
+	if fac.Decryption == nil {
+		return nil, fmt.Errorf("applying a bundle requires a decryption store")
+	}
+	if name, key, err := fac.Decryption.DecryptionFields(head); err == nil {
+		return fac.LoadWithDecryption(ctx, head, name, key)
+	} else if !errors.Is(err, base.ErrNotFound) {
+		return nil, err
+	}
+	if !since.Defined() {
+		return nil, fmt.Errorf("no decryption fields for bundle root %s", head)
+	}
+
+	name, key, err := fac.Decryption.DecryptionFields(since)
+	if err != nil {
+		return nil, fmt.Errorf("bundle was created against unknown version %s: %w", since, err)
+	}
+	blk, err := fac.BlockService.GetBlock(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+	h, err := decodeRootHeader(blk)
+	if err != nil {
+		return nil, err
+	}
+	if h.Private == nil {
+		return nil, fmt.Errorf("bundle root %s has no private hierarchy", head)
+	}
+	pstore, err := private.LoadStore(ctx, fac.BlockService, fac.Ratchets, *h.Private)
+	if err != nil {
+		return nil, err
+	}
+	proot, err := private.LoadLatestRoot(ctx, pstore, FileHierarchyNamePrivate, key, name)
+	if err != nil {
+		return nil, fmt.Errorf("finding private root of %s: %w", head, err)
+	}
+	if name, err = proot.PrivateName(); err != nil {
+		return nil, err
+	}
+	key = proot.Key()
+
+	if ds, ok := fac.Decryption.(private.WritableDecryptionStore); ok {
+		if err := ds.PutDecryptionFields(head, name, key); err != nil {
+			return nil, fmt.Errorf("updating decryption store: %w", err)
+		}
+	}
+	return fac.LoadWithDecryption(ctx, head, name, key)
+}
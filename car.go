@@ -0,0 +1,344 @@
+package wnfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	mh "github.com/multiformats/go-multihash"
+	base "github.com/functionland/wnfs-go/base"
+	private "github.com/functionland/wnfs-go/private"
+)
+
+const (
+	// carV2PragmaSize is the length of the fixed CARv2 pragma, which decodes
+	// as a CARv1 header with version 2
+	carV2PragmaSize = 11
+	// carV2HeaderSize is the length of the CARv2 header following the pragma
+	carV2HeaderSize = 40
+	// carIndexSorted is the multicodec of the CARv2 sorted index format
+	carIndexSorted = 0x0400
+	// maxCARSectionSize caps the size of a single block read from a CAR file
+	maxCARSectionSize = 32 << 20
+)
+
+var carV2Pragma = []byte{0x0a, 0xa1, 0x67, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x02}
+
+// CAROptions configures CAR export
+type CAROptions struct {
+	// Version is the CAR format version to write, 1 or 2. Defaults to 1. CARv2
+	// files wrap a CARv1 payload with a sorted index of block offsets
+	Version int
+}
+
+// ExportCAR writes all blocks of the filesystem at root to w as a CAR file
+// with root as its only root. Blocks include the root header & history, the
+// public DAG, the private HAMT & all ciphertext blocks of the private
+// hierarchy & its history. Walking the private hierarchy requires decryption
+// fields for root in the factory's decryption store
+func (fac Factory) ExportCAR(ctx context.Context, root cid.Cid, w io.Writer, opts CAROptions) error {
+	ids, err := fac.carBlocks(ctx, root)
+	if err != nil {
+		return err
+	}
+
+	switch opts.Version {
+	case 0, 1:
+		_, _, err = fac.writeCARv1(ctx, w, []cid.Cid{root}, ids)
+		return err
+	case 2:
+		return fac.writeCARv2(ctx, w, root, ids)
+	default:
+		return fmt.Errorf("unsupported CAR version %d", opts.Version)
+	}
+}
+
+// carBlocks lists the CIDs of all blocks of the filesystem at root
+func (fac Factory) carBlocks(ctx context.Context, root cid.Cid) ([]cid.Cid, error) {
+	var (
+		ids  []cid.Cid
+		seen = map[cid.Cid]struct{}{}
+	)
+	visit := func(id cid.Cid) bool {
+		if _, ok := seen[id]; ok {
+			return false
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+		return true
+	}
+
+	if err := base.WalkBlocks(ctx, fac.BlockService, root, visit); err != nil {
+		return nil, err
+	}
+
+	blk, err := fac.BlockService.GetBlock(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	h, err := decodeRootHeader(blk)
+	if err != nil {
+		return nil, err
+	}
+	if h.Private == nil {
+		return ids, nil
+	}
+
+	// private blocks are only reachable by decrypting headers
+	if fac.Decryption == nil || fac.Ratchets == nil {
+		return nil, fmt.Errorf("exporting private blocks requires a decryption & ratchet store")
+	}
+	name, key, err := fac.Decryption.DecryptionFields(root)
+	if err != nil {
+		return nil, fmt.Errorf("loading decryption fields for %s: %w", root, err)
+	}
+	pstore, err := private.LoadStore(ctx, fac.BlockService, fac.Ratchets, *h.Private)
+	if err != nil {
+		return nil, err
+	}
+	if err := private.WalkBlocks(ctx, pstore, name, key, visit); err != nil {
+		return nil, fmt.Errorf("walking private blocks: %w", err)
+	}
+	return ids, nil
+}
+
+// writeCARv1 writes a CARv1 header & a section for each block, returning the
+// offset of each section from the start of the CARv1 payload & the payload
+// size
+func (fac Factory) writeCARv1(ctx context.Context, w io.Writer, roots, ids []cid.Cid) (offsets []uint64, size uint64, err error) {
+	hdr, err := carHeader(roots)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return nil, 0, err
+	}
+
+	offsets = make([]uint64, len(ids))
+	offset := uint64(len(hdr))
+	buf := make([]byte, binary.MaxVarintLen64)
+	for i, id := range ids {
+		blk, err := fac.BlockService.GetBlock(ctx, id)
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading block %s: %w", id, err)
+		}
+		idBytes := id.Bytes()
+		n := binary.PutUvarint(buf, uint64(len(idBytes)+len(blk.RawData())))
+		for _, p := range [][]byte{buf[:n], idBytes, blk.RawData()} {
+			if _, err := w.Write(p); err != nil {
+				return nil, 0, err
+			}
+		}
+		offsets[i] = offset
+		offset += uint64(n + len(idBytes) + len(blk.RawData()))
+	}
+	return offsets, offset, nil
+}
+
+// writeCARv2 writes a CARv2 file. The CARv2 header records the payload size,
+// so the payload is measured before it's written
+func (fac Factory) writeCARv2(ctx context.Context, w io.Writer, root cid.Cid, ids []cid.Cid) error {
+	offsets, dataSize, err := fac.writeCARv1(ctx, ioutil.Discard, []cid.Cid{root}, ids)
+	if err != nil {
+		return err
+	}
+
+	dataOffset := uint64(carV2PragmaSize + carV2HeaderSize)
+	v2hdr := make([]byte, carV2HeaderSize)
+	// the first 16 bytes are characteristics flags, none of which are set
+	binary.LittleEndian.PutUint64(v2hdr[16:], dataOffset)
+	binary.LittleEndian.PutUint64(v2hdr[24:], dataSize)
+	binary.LittleEndian.PutUint64(v2hdr[32:], dataOffset+dataSize)
+	if _, err := w.Write(carV2Pragma); err != nil {
+		return err
+	}
+	if _, err := w.Write(v2hdr); err != nil {
+		return err
+	}
+	if _, _, err := fac.writeCARv1(ctx, w, []cid.Cid{root}, ids); err != nil {
+		return err
+	}
+	return writeCARIndex(w, ids, offsets)
+}
+
+// writeCARIndex writes a CARv2 IndexSorted index: buckets of multihash digests
+// & payload offsets grouped by digest length, each sorted by digest
+func writeCARIndex(w io.Writer, ids []cid.Cid, offsets []uint64) error {
+	buckets := map[int][][]byte{}
+	for i, id := range ids {
+		dh, err := mh.Decode(id.Hash())
+		if err != nil {
+			return err
+		}
+		ent := make([]byte, len(dh.Digest)+8)
+		copy(ent, dh.Digest)
+		binary.LittleEndian.PutUint64(ent[len(dh.Digest):], offsets[i])
+		buckets[len(ent)] = append(buckets[len(ent)], ent)
+	}
+	widths := make([]int, 0, len(buckets))
+	for width := range buckets {
+		widths = append(widths, width)
+	}
+	sort.Ints(widths)
+
+	buf := &bytes.Buffer{}
+	varint := make([]byte, binary.MaxVarintLen64)
+	buf.Write(varint[:binary.PutUvarint(varint, carIndexSorted)])
+	binary.Write(buf, binary.LittleEndian, int32(len(widths)))
+	for _, width := range widths {
+		ents := buckets[width]
+		sort.Slice(ents, func(i, j int) bool { return bytes.Compare(ents[i], ents[j]) < 0 })
+		binary.Write(buf, binary.LittleEndian, uint32(width))
+		binary.Write(buf, binary.LittleEndian, int64(len(ents)*width))
+		for _, ent := range ents {
+			buf.Write(ent)
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func carHeader(roots []cid.Cid) ([]byte, error) {
+	data, err := cbornode.DumpObject(map[string]interface{}{
+		"roots":   roots,
+		"version": 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(data))
+	n := binary.PutUvarint(buf, uint64(len(data)))
+	return append(buf[:n], data...), nil
+}
+
+// ImportCAR adds all blocks of a CARv1 or CARv2 file read from r to the
+// factory's blockservice, returning the roots listed in the CAR header. Block
+// data is checked against block CIDs. Importing doesn't add decryption fields,
+// loading a private hierarchy from an imported root requires its key & private
+// name
+func (fac Factory) ImportCAR(ctx context.Context, r io.Reader) ([]cid.Cid, error) {
+	br := bufio.NewReader(r)
+	version, roots, err := readCARHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == 2 {
+		hdr := make([]byte, carV2HeaderSize)
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			return nil, fmt.Errorf("reading CARv2 header: %w", err)
+		}
+		dataOffset := binary.LittleEndian.Uint64(hdr[16:])
+		dataSize := binary.LittleEndian.Uint64(hdr[24:])
+		if dataOffset < carV2PragmaSize+carV2HeaderSize {
+			return nil, fmt.Errorf("invalid CARv2 data offset %d", dataOffset)
+		}
+		if _, err := io.CopyN(ioutil.Discard, br, int64(dataOffset-carV2PragmaSize-carV2HeaderSize)); err != nil {
+			return nil, err
+		}
+		// the index following the payload isn't needed to import blocks
+		br = bufio.NewReader(io.LimitReader(br, int64(dataSize)))
+		if version, roots, err = readCARHeader(br); err != nil {
+			return nil, err
+		}
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("unsupported CAR version %d", version)
+	}
+
+	for {
+		blk, err := readCARSection(br)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if err := fac.BlockService.Blockstore().Put(ctx, blk); err != nil {
+			return nil, err
+		}
+	}
+	return roots, nil
+}
+
+func readCARHeader(r *bufio.Reader) (version uint64, roots []cid.Cid, err error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("reading CAR header: %w", err)
+	}
+	if size > maxCARSectionSize {
+		return 0, nil, fmt.Errorf("CAR header of %d bytes is too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, fmt.Errorf("reading CAR header: %w", err)
+	}
+
+	hdr := map[string]interface{}{}
+	if err := cbornode.DecodeInto(data, &hdr); err != nil {
+		return 0, nil, fmt.Errorf("decoding CAR header: %w", err)
+	}
+	var v uint64
+	switch x := hdr["version"].(type) {
+	case uint64:
+		v = x
+	case int:
+		v = uint64(x)
+	case int64:
+		v = uint64(x)
+	default:
+		return 0, nil, fmt.Errorf("CAR header is missing a version")
+	}
+	if v != 1 {
+		// CARv2 pragma has no roots
+		return v, nil, nil
+	}
+	ids, ok := hdr["roots"].([]interface{})
+	if !ok {
+		return 0, nil, fmt.Errorf("CAR header is missing roots")
+	}
+	for _, id := range ids {
+		c, ok := id.(cid.Cid)
+		if !ok {
+			return 0, nil, fmt.Errorf("CAR header has an invalid root %v", id)
+		}
+		roots = append(roots, c)
+	}
+	return v, roots, nil
+}
+
+func readCARSection(r *bufio.Reader) (blocks.Block, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxCARSectionSize {
+		return nil, fmt.Errorf("CAR section of %d bytes is too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("reading CAR section: %w", io.ErrUnexpectedEOF)
+	}
+
+	n, id, err := cid.CidFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("reading section CID: %w", err)
+	}
+	data = data[n:]
+	sum, err := id.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	if !sum.Equals(id) {
+		return nil, fmt.Errorf("block data doesn't match CID %s", id)
+	}
+	return blocks.NewBlockWithCid(data, id)
+}
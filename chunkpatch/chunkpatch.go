@@ -0,0 +1,473 @@
+// Package chunkpatch edits file DAGs built by size-chunking content into
+// fixed-size leaves arranged in a balanced UnixFS tree. Edits are held in
+// memory & written by Flush, which re-encodes only the leaves that changed &
+// links all other leaves of the existing DAG into a new tree
+package chunkpatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	cidutil "github.com/ipfs/go-cidutil"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	unixfs "github.com/ipfs/go-unixfs"
+	pb "github.com/ipfs/go-unixfs/pb"
+	multihash "github.com/multiformats/go-multihash"
+)
+
+// MaxLinks is the number of children of each internal node, matching the
+// DAG builder parameters used to write files
+const MaxLinks = 1024
+
+var (
+	// ErrUnsupportedLayout is returned by Open when a DAG isn't made of
+	// fixed-size leaves
+	ErrUnsupportedLayout = errors.New("file DAG is not made of fixed-size leaves")
+	// ErrBaseChanged is returned when applying edits to a file that has been
+	// written since the edits were opened
+	ErrBaseChanged = errors.New("file changed since it was opened")
+)
+
+// Codec converts between leaf nodes & the content bytes they store
+type Codec interface {
+	// ChunkSize is the number of content bytes stored in each leaf. All leaves
+	// but the last store exactly ChunkSize bytes
+	ChunkSize() int
+	// EncodeLeaf creates a leaf node storing data as the chunk at index,
+	// returning the size recorded for the leaf in the blocksizes of its parent
+	EncodeLeaf(index int, data []byte) (nd ipld.Node, blockSize uint64, err error)
+	// DecodeLeaf returns the content bytes stored in a leaf node
+	DecodeLeaf(nd ipld.Node) ([]byte, error)
+}
+
+// CidBuilder returns the CID builder used for internal nodes: CIDv1 sha2-256
+// hashes, inlining nodes of 32 bytes or less
+func CidBuilder() cid.Builder {
+	prefix, _ := merkledag.PrefixForCidVersion(1)
+	prefix.MhType = multihash.SHA2_256
+	return cidutil.InlineBuilder{Builder: prefix, Limit: 32}
+}
+
+// leaf is a link to a node at the bottom of a file DAG
+type leaf struct {
+	cid       cid.Cid
+	blockSize uint64 // size recorded in the parent's unixfs blocksizes
+	dagSize   uint64 // cumulative size of the node, recorded in the parent link
+}
+
+// File is a file DAG opened for editing. File is not safe for concurrent use
+type File struct {
+	ctx   context.Context
+	dag   ipld.DAGService
+	codec Codec
+	base  cid.Cid
+
+	size    int64
+	leaves  []leaf         // leaves of base, truncated to the current size
+	dirty   map[int][]byte // changed chunks, by index
+	reenc   bool           // re-encode every chunk on the next flush
+	cached  int            // index of the leaf held in cache, -1 if empty
+	cacheBs []byte
+}
+
+// Open loads the file DAG rooted at root for editing. size is the length of
+// the file's contents. An undefined root opens an empty file
+func Open(ctx context.Context, dag ipld.DAGService, codec Codec, root cid.Cid, size int64) (*File, error) {
+	f := &File{
+		ctx:    ctx,
+		dag:    dag,
+		codec:  codec,
+		base:   root,
+		size:   size,
+		dirty:  map[int][]byte{},
+		cached: -1,
+	}
+	if !root.Defined() {
+		if size != 0 {
+			return nil, fmt.Errorf("%w: no root for %d bytes of content", ErrUnsupportedLayout, size)
+		}
+		return f, nil
+	}
+
+	nd, err := dag.Get(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.loadLeaves(nd); err != nil {
+		return nil, err
+	}
+
+	n := f.numChunks(size)
+	if size == 0 && len(f.leaves) == 1 {
+		// empty files are stored as a single empty leaf
+		f.leaves = nil
+	} else if len(f.leaves) != n {
+		return nil, fmt.Errorf("%w: %d leaves for %d bytes of content", ErrUnsupportedLayout, len(f.leaves), size)
+	}
+	return f, nil
+}
+
+// Base is the root of the DAG edits apply to, updated by each Flush
+func (f *File) Base() cid.Cid { return f.base }
+
+// Codec returns the leaf codec of f
+func (f *File) Codec() Codec { return f.codec }
+
+// Size is the current length of the file, including unflushed edits
+func (f *File) Size() int64 { return f.size }
+
+// Dirty returns true if f has edits that haven't been flushed
+func (f *File) Dirty() bool { return len(f.dirty) > 0 || f.reenc || !f.base.Defined() }
+
+// Reencode marks every chunk for re-encoding on the next Flush, for when the
+// existing leaves can be decoded but not reused, like a change of key
+func (f *File) Reencode() { f.reenc = true }
+
+// ReadAt implements io.ReaderAt, reading edited file contents
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("chunkpatch: negative offset")
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+
+	cs := int64(f.codec.ChunkSize())
+	for n < len(p) && off < f.size {
+		data, err := f.chunk(int(off / cs))
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], data[off%cs:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt implements io.WriterAt. Writing past the end of the file extends
+// it, filling any gap with zeros
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("chunkpatch: negative offset")
+	}
+	if end := off + int64(len(p)); end > f.size {
+		if err := f.Truncate(end); err != nil {
+			return 0, err
+		}
+	}
+
+	cs := int64(f.codec.ChunkSize())
+	for n < len(p) {
+		i := int(off / cs)
+		data, err := f.writableChunk(i)
+		if err != nil {
+			return n, err
+		}
+		c := copy(data[off%cs:], p[n:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+// Truncate changes the size of the file. Growing the file fills new content
+// with zeros
+func (f *File) Truncate(size int64) error {
+	if size < 0 {
+		return errors.New("chunkpatch: negative size")
+	}
+	if size == f.size {
+		return nil
+	}
+
+	// only the last chunk before & after the change can change length, the
+	// contents of any other chunk are unaffected
+	n := f.numChunks(size)
+	for _, i := range []int{f.numChunks(f.size) - 1, n - 1} {
+		if i < 0 || i >= n {
+			continue
+		}
+		want := chunkLen(i, size, f.codec.ChunkSize())
+		if chunkLen(i, f.size, f.codec.ChunkSize()) == want {
+			continue
+		}
+		if _, ok := f.dirty[i]; !ok && i >= len(f.leaves) {
+			// chunks past the end of the stored leaves are zeros of any length
+			continue
+		}
+		data, err := f.writableChunk(i)
+		if err != nil {
+			return err
+		}
+		if len(data) > want {
+			data = data[:want]
+		} else {
+			data = append(data, make([]byte, want-len(data))...)
+		}
+		f.dirty[i] = data
+	}
+
+	for i := range f.dirty {
+		if i >= n {
+			delete(f.dirty, i)
+		}
+	}
+	if len(f.leaves) > n {
+		f.leaves = f.leaves[:n]
+	}
+	if f.cached >= n {
+		f.cached, f.cacheBs = -1, nil
+	}
+	f.size = size
+	return nil
+}
+
+// Flush writes changed leaves & a new tree linking them with all unchanged
+// leaves, returning the new root. After Flush the returned root is the base
+// of subsequent edits
+func (f *File) Flush() (ipld.Node, error) {
+	n := f.numChunks(f.size)
+	links := make([]leaf, 0, n)
+	for i := 0; i < n; i++ {
+		data, ok := f.dirty[i]
+		if !ok && i < len(f.leaves) && !f.reenc {
+			links = append(links, f.leaves[i])
+			continue
+		}
+		if !ok {
+			var err error
+			if data, err = f.chunk(i); err != nil {
+				return nil, err
+			}
+		}
+		l, err := f.putLeaf(i, data)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+
+	var (
+		root ipld.Node
+		err  error
+	)
+	if n == 0 {
+		root, _, err = f.codec.EncodeLeaf(0, nil)
+		if err == nil {
+			err = f.dag.Add(f.ctx, root)
+		}
+	} else {
+		root, err = f.putTree(links)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.base = root.Cid()
+	f.leaves = links
+	f.dirty = map[int][]byte{}
+	f.reenc = false
+	f.cached, f.cacheBs = -1, nil
+	return root, nil
+}
+
+func (f *File) putLeaf(index int, data []byte) (leaf, error) {
+	nd, blockSize, err := f.codec.EncodeLeaf(index, data)
+	if err != nil {
+		return leaf{}, err
+	}
+	if err := f.dag.Add(f.ctx, nd); err != nil {
+		return leaf{}, err
+	}
+	dagSize, err := nd.Size()
+	if err != nil {
+		return leaf{}, err
+	}
+	return leaf{cid: nd.Cid(), blockSize: blockSize, dagSize: dagSize}, nil
+}
+
+// putTree writes layers of internal nodes above links until a single root
+// remains, matching the shape of a balanced layout. A single leaf is its own
+// root
+func (f *File) putTree(links []leaf) (ipld.Node, error) {
+	if len(links) == 1 {
+		return f.dag.Get(f.ctx, links[0].cid)
+	}
+
+	builder := CidBuilder()
+	for {
+		var (
+			layer []leaf
+			nd    *merkledag.ProtoNode
+		)
+		for start := 0; start < len(links); start += MaxLinks {
+			end := start + MaxLinks
+			if end > len(links) {
+				end = len(links)
+			}
+
+			nd = &merkledag.ProtoNode{}
+			nd.SetCidBuilder(builder)
+			fsn := unixfs.NewFSNode(pb.Data_File)
+			for _, l := range links[start:end] {
+				if err := nd.AddRawLink("", &ipld.Link{Cid: l.cid, Size: l.dagSize}); err != nil {
+					return nil, err
+				}
+				fsn.AddBlockSize(l.blockSize)
+			}
+			data, err := fsn.GetBytes()
+			if err != nil {
+				return nil, err
+			}
+			nd.SetData(data)
+			if err := f.dag.Add(f.ctx, nd); err != nil {
+				return nil, err
+			}
+			dagSize, err := nd.Size()
+			if err != nil {
+				return nil, err
+			}
+			layer = append(layer, leaf{cid: nd.Cid(), blockSize: fsn.FileSize(), dagSize: dagSize})
+		}
+
+		if len(layer) == 1 {
+			return nd, nil
+		}
+		links = layer
+	}
+}
+
+// loadLeaves appends the leaves below nd to f.leaves. Leaves of a balanced
+// DAG all have the same depth, only internal nodes are fetched
+func (f *File) loadLeaves(nd ipld.Node) error {
+	if isLeaf(nd) {
+		l, err := leafOf(nd)
+		if err != nil {
+			return err
+		}
+		f.leaves = append(f.leaves, l)
+		return nil
+	}
+
+	fsn, err := unixfs.ExtractFSNode(nd)
+	if err != nil {
+		return err
+	}
+	links := nd.Links()
+	if fsn.NumChildren() != len(links) {
+		return fmt.Errorf("%w: node %s has %d links & %d blocksizes", ErrUnsupportedLayout, nd.Cid(), len(links), fsn.NumChildren())
+	}
+
+	first, err := links[0].GetNode(f.ctx, f.dag)
+	if err != nil {
+		return err
+	}
+	if isLeaf(first) {
+		for i, l := range links {
+			f.leaves = append(f.leaves, leaf{cid: l.Cid, blockSize: fsn.BlockSize(i), dagSize: l.Size})
+		}
+		return nil
+	}
+
+	for i, l := range links {
+		child := first
+		if i > 0 {
+			if child, err = l.GetNode(f.ctx, f.dag); err != nil {
+				return err
+			}
+		}
+		if err := f.loadLeaves(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isLeaf(nd ipld.Node) bool {
+	return len(nd.Links()) == 0
+}
+
+func leafOf(nd ipld.Node) (leaf, error) {
+	dagSize, err := nd.Size()
+	if err != nil {
+		return leaf{}, err
+	}
+	l := leaf{cid: nd.Cid(), dagSize: dagSize, blockSize: uint64(len(nd.RawData()))}
+	if pn, ok := nd.(*merkledag.ProtoNode); ok {
+		fsn, err := unixfs.FSNodeFromBytes(pn.Data())
+		if err != nil {
+			return leaf{}, err
+		}
+		l.blockSize = fsn.FileSize()
+	}
+	return l, nil
+}
+
+// chunk returns the contents of chunk i. The returned slice must not be
+// modified unless i is dirty
+func (f *File) chunk(i int) ([]byte, error) {
+	if data, ok := f.dirty[i]; ok {
+		return data, nil
+	}
+	if i >= len(f.leaves) {
+		return make([]byte, chunkLen(i, f.size, f.codec.ChunkSize())), nil
+	}
+	if f.cached == i {
+		return f.cacheBs, nil
+	}
+
+	nd, err := f.dag.Get(f.ctx, f.leaves[i].cid)
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.codec.DecodeLeaf(nd)
+	if err != nil {
+		return nil, err
+	}
+	if want := chunkLen(i, f.size, f.codec.ChunkSize()); len(data) != want {
+		return nil, fmt.Errorf("%w: leaf %d holds %d bytes, expected %d", ErrUnsupportedLayout, i, len(data), want)
+	}
+	f.cached, f.cacheBs = i, data
+	return data, nil
+}
+
+// writableChunk returns the contents of chunk i, marking it dirty
+func (f *File) writableChunk(i int) ([]byte, error) {
+	if data, ok := f.dirty[i]; ok {
+		return data, nil
+	}
+	data, err := f.chunk(i)
+	if err != nil {
+		return nil, err
+	}
+	if f.cached == i {
+		data = append([]byte(nil), data...)
+	}
+	f.dirty[i] = data
+	return data, nil
+}
+
+func (f *File) numChunks(size int64) int {
+	cs := int64(f.codec.ChunkSize())
+	return int((size + cs - 1) / cs)
+}
+
+// chunkLen is the length of chunk i in a file of size bytes
+func chunkLen(i int, size int64, chunkSize int) int {
+	l := size - int64(i)*int64(chunkSize)
+	if l < 0 {
+		return 0
+	}
+	if l > int64(chunkSize) {
+		return chunkSize
+	}
+	return int(l)
+}
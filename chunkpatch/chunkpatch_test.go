@@ -0,0 +1,129 @@
+package chunkpatch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	mockblocks "github.com/functionland/wnfs-go/mockblocks"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+// rawCodec stores content in raw leaves of a small chunk size, to exercise
+// multi-level trees with little data
+type rawCodec struct{}
+
+func (rawCodec) ChunkSize() int { return 7 }
+
+func (rawCodec) EncodeLeaf(_ int, data []byte) (ipld.Node, uint64, error) {
+	nd, err := merkledag.NewRawNodeWPrefix(append([]byte(nil), data...), CidBuilder())
+	return nd, uint64(len(data)), err
+}
+
+func (rawCodec) DecodeLeaf(nd ipld.Node) ([]byte, error) {
+	return append([]byte(nil), nd.RawData()...), nil
+}
+
+func TestFileEdits(t *testing.T) {
+	ctx := context.Background()
+	dag := merkledag.NewDAGService(mockblocks.NewOfflineMemBlockservice())
+	rnd := rand.New(rand.NewSource(1))
+
+	f, err := Open(ctx, dag, rawCodec{}, cid.Undef, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expect []byte
+
+	for i := 0; i < 300; i++ {
+		switch op := rnd.Intn(4); op {
+		case 0, 1:
+			off := rnd.Int63n(int64(len(expect)) + 20)
+			p := make([]byte, rnd.Intn(40))
+			rnd.Read(p)
+			if _, err := f.WriteAt(p, off); err != nil {
+				t.Fatal(err)
+			}
+			if end := off + int64(len(p)); end > int64(len(expect)) {
+				expect = append(expect, make([]byte, end-int64(len(expect)))...)
+			}
+			copy(expect[off:], p)
+		case 2:
+			size := rnd.Int63n(int64(len(expect)) + 20)
+			if err := f.Truncate(size); err != nil {
+				t.Fatal(err)
+			}
+			if size < int64(len(expect)) {
+				expect = expect[:size]
+			} else {
+				expect = append(expect, make([]byte, size-int64(len(expect)))...)
+			}
+		case 3:
+			root, err := f.Flush()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// reopen from the flushed DAG
+			if f, err = Open(ctx, dag, rawCodec{}, root.Cid(), int64(len(expect))); err != nil {
+				t.Fatalf("step %d reopening: %s", i, err)
+			}
+		}
+
+		if f.Size() != int64(len(expect)) {
+			t.Fatalf("step %d size mismatch. want: %d got: %d", i, len(expect), f.Size())
+		}
+		got := make([]byte, len(expect))
+		if _, err := f.ReadAt(got, 0); err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expect, got) {
+			t.Fatalf("step %d content mismatch.\nwant: %x\ngot:  %x", i, expect, got)
+		}
+	}
+}
+
+func TestFlushReusesLeaves(t *testing.T) {
+	ctx := context.Background()
+	dag := merkledag.NewDAGService(mockblocks.NewOfflineMemBlockservice())
+
+	f, err := Open(ctx, dag, rawCodec{}, cid.Undef, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz"), 1000)
+	if _, err := f.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	before := append([]leaf(nil), f.leaves...)
+	if len(before) <= MaxLinks {
+		t.Fatalf("expected more than %d leaves, got %d", MaxLinks, len(before))
+	}
+
+	if _, err := f.WriteAt([]byte("!"), 100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("appended"), f.Size()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := 0
+	for i, l := range before {
+		if !f.leaves[i].cid.Equals(l.cid) {
+			changed++
+		}
+	}
+	// the leaf holding offset 100 & the last partial leaf change
+	if changed != 2 {
+		t.Errorf("expected 2 changed leaves, got %d", changed)
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"io/ioutil"
 	"os"
@@ -19,6 +21,7 @@ import (
 	base "github.com/functionland/wnfs-go/base"
 	fsdiff "github.com/functionland/wnfs-go/fsdiff"
 	gateway "github.com/functionland/wnfs-go/gateway"
+	ciphersuite "github.com/functionland/wnfs-go/private/ciphersuite"
 	public "github.com/functionland/wnfs-go/public"
 	cli "github.com/urfave/cli/v2"
 )
@@ -42,13 +45,23 @@ func main() {
 				Aliases: []string{"v"},
 				Usage:   "print verbose output",
 			},
+			&cli.StringFlag{
+				Name:    "cipher",
+				Usage:   "cipher suite to encrypt new private data with: aes-gcm, chacha20-poly1305 or xchacha20-poly1305",
+				EnvVars: []string{"WNFS_CIPHER"},
+				Value:   ciphersuite.Default.String(),
+			},
 		},
 		Before: func(c *cli.Context) (err error) {
 			if c.Bool("verbose") {
 				golog.SetLogLevel("wnfs", "debug")
 			}
+			suite, err := ciphersuite.Parse(c.String("cipher"))
+			if err != nil {
+				return err
+			}
 
-			repo, err = OpenRepo(ctx)
+			repo, err = OpenRepo(ctx, wnfs.CipherSuite(suite))
 			return err
 		},
 		Commands: []*cli.Command{
@@ -83,7 +96,9 @@ func main() {
 cid:	%s
 type:	%s
 size:	%d
-`[1:], n.Cid(), n.Type(), n.Size())
+mode:	%s
+mtime:	%s
+`[1:], n.Cid(), n.Type(), n.Size(), n.Mode(), n.ModTime().Format(time.RFC3339Nano))
 
 					return nil
 				},
@@ -93,12 +108,17 @@ size:	%d
 				Usage: "list the contents of a directory",
 				Action: func(c *cli.Context) error {
 					fs := repo.WNFS()
-					entries, err := fs.Ls(c.Args().Get(0))
+					dir := c.Args().Get(0)
+					entries, err := fs.Ls(dir)
 					if err != nil {
 						return err
 					}
 
 					for _, entry := range entries {
+						if target, err := fs.Readlink(filepath.Join(dir, entry.Name())); err == nil {
+							fmt.Printf("%s -> %s\n", entry.Name(), target)
+							continue
+						}
 						fmt.Println(entry.Name())
 					}
 					return nil
@@ -138,7 +158,7 @@ size:	%d
 
 					fmt.Println("date\tsize\tcid\tkey\tprivate name")
 					for _, entry := range entries {
-						ts := time.Unix(entry.Mtime, 0)
+						ts := base.DecodeTimestamp(entry.Mtime)
 						fmt.Printf("%s\t%s\t%s\t%s\t%s\n", ts.Format(time.RFC3339), humanize.Bytes(uint64(entry.Size)), entry.Cid, entry.Key, entry.PrivateName)
 					}
 					return nil
@@ -148,8 +168,6 @@ size:	%d
 				Name:  "diff",
 				Usage: "",
 				Action: func(c *cli.Context) error {
-					cmdCtx, cancel := context.WithCancel(ctx)
-					defer cancel()
 					fs := repo.WNFS()
 
 					entries, err := fs.History(context.TODO(), ".", 2)
@@ -161,12 +179,7 @@ size:	%d
 						return nil
 					}
 
-					key := &wnfs.Key{}
-					if err := key.Decode(entries[1].Key); err != nil {
-						return err
-					}
-
-					prev, err := wnfs.FromCID(cmdCtx, repo.Store().Blockservice(), repo.RatchetStore(), entries[1].Cid, *key, wnfs.PrivateName(entries[1].PrivateName))
+					prev, err := fs.AtVersion(ctx, entries[1])
 					if err != nil {
 						errExit("error: opening previous WNFS %s:\n%s\n", entries[1].Cid, err.Error())
 					}
@@ -262,6 +275,243 @@ size:	%d
 					return repo.Commit(fs)
 				},
 			},
+			{
+				Name:      "import",
+				Usage:     "recursively import a local directory into wnfs",
+				ArgsUsage: "[wnfs path] [local directory]",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "include",
+						Usage: "only import paths matching a gitignore-style pattern",
+					},
+					&cli.StringSliceFlag{
+						Name:  "exclude",
+						Usage: "skip paths matching a gitignore-style pattern",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-unchanged",
+						Value: true,
+						Usage: "skip files that have the same size and are no newer than the existing file",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					wnfsPath := c.Args().Get(0)
+					localPath, err := filepath.Abs(c.Args().Get(1))
+					if err != nil {
+						return err
+					}
+
+					fs := repo.WNFS()
+					res, err := fs.Import(ctx, wnfsPath, os.DirFS(localPath), wnfs.ImportOptions{
+						Include:       c.StringSlice("include"),
+						Exclude:       c.StringSlice("exclude"),
+						SkipUnchanged: c.Bool("skip-unchanged"),
+						Progress: func(p wnfs.ImportProgress) {
+							if p.Err != nil {
+								fmt.Fprintf(os.Stderr, "error importing %s: %s\n", p.Path, p.Err)
+								return
+							}
+							fmt.Printf("\r%d files (%s), %d unchanged", p.Files, humanize.Bytes(uint64(p.Bytes)), p.Skipped)
+						},
+					})
+					fmt.Println()
+					var importErr *wnfs.ImportError
+					if err != nil && !errors.As(err, &importErr) {
+						return err
+					}
+					if res.Files > 0 {
+						if commitErr := repo.Commit(fs); commitErr != nil {
+							return commitErr
+						}
+					}
+					return err
+				},
+			},
+			{
+				Name:      "export",
+				Usage:     "write a wnfs file or directory to the local filesystem",
+				ArgsUsage: "[wnfs path] [local path]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "tar",
+						Usage: "write a tar archive to local path, use \"-\" for stdout",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					wnfsPath, localPath := c.Args().Get(0), c.Args().Get(1)
+					if localPath == "" {
+						return fmt.Errorf("local path is required")
+					}
+
+					fs := repo.WNFS()
+					if !c.Bool("tar") {
+						return fs.Export(ctx, wnfsPath, wnfs.NewDirTarget(localPath))
+					}
+					if localPath == "-" {
+						return fs.Export(ctx, wnfsPath, wnfs.NewTarTarget(os.Stdout))
+					}
+					f, err := os.Create(localPath)
+					if err != nil {
+						return err
+					}
+					if err := fs.Export(ctx, wnfsPath, wnfs.NewTarTarget(f)); err != nil {
+						f.Close()
+						return err
+					}
+					return f.Close()
+				},
+			},
+			{
+				Name:  "car",
+				Usage: "move filesystem blocks in and out of CAR files",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "export",
+						Usage:     "write all blocks of the current version to a CAR file, use \"-\" for stdout",
+						ArgsUsage: "[local path]",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "v2",
+								Usage: "write a CARv2 file with an index",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							localPath := c.Args().Get(0)
+							if localPath == "" {
+								return fmt.Errorf("local path is required")
+							}
+							opts := wnfs.CAROptions{Version: 1}
+							if c.Bool("v2") {
+								opts.Version = 2
+							}
+
+							fac, root := repo.Factory(), repo.WNFS().Cid()
+							if localPath == "-" {
+								return fac.ExportCAR(ctx, root, os.Stdout, opts)
+							}
+							f, err := os.Create(localPath)
+							if err != nil {
+								return err
+							}
+							if err := fac.ExportCAR(ctx, root, f, opts); err != nil {
+								f.Close()
+								return err
+							}
+							return f.Close()
+						},
+					},
+					{
+						Name:      "import",
+						Usage:     "add all blocks of a CAR file to the repo & print its roots, reading stdin when no path is given",
+						ArgsUsage: "[local path]",
+						Action: func(c *cli.Context) error {
+							var r io.Reader = os.Stdin
+							if localPath := c.Args().Get(0); localPath != "" && localPath != "-" {
+								f, err := os.Open(localPath)
+								if err != nil {
+									return err
+								}
+								defer f.Close()
+								r = f
+							}
+
+							roots, err := repo.Factory().ImportCAR(ctx, r)
+							if err != nil {
+								return err
+							}
+							for _, root := range roots {
+								fmt.Println(root)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "bundle",
+				Usage: "sync with other repos through files instead of a network",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "create",
+						Usage:     "write blocks of the current version missing from a known version to a bundle file, use \"-\" for stdout",
+						ArgsUsage: "[local path]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "since",
+								Usage: "root CID of the latest version the receiving repo has, omit to bundle all blocks",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							localPath := c.Args().Get(0)
+							if localPath == "" {
+								return fmt.Errorf("local path is required")
+							}
+							since := cid.Undef
+							if s := c.String("since"); s != "" {
+								id, err := cid.Parse(s)
+								if err != nil {
+									return fmt.Errorf("parsing since CID: %w", err)
+								}
+								since = id
+							}
+
+							fac, head := repo.Factory(), repo.WNFS().Cid()
+							if localPath == "-" {
+								return fac.CreateBundle(ctx, head, since, os.Stdout)
+							}
+							f, err := os.Create(localPath)
+							if err != nil {
+								return err
+							}
+							if err := fac.CreateBundle(ctx, head, since, f); err != nil {
+								f.Close()
+								return err
+							}
+							if err := f.Close(); err != nil {
+								return err
+							}
+							fmt.Printf("wrote bundle of %s to %s\n", head, localPath)
+							return nil
+						},
+					},
+					{
+						Name:      "apply",
+						Usage:     "add the blocks of a bundle file & merge its version into the current version, reading stdin when no path is given",
+						ArgsUsage: "[local path]",
+						Action: func(c *cli.Context) error {
+							var r io.Reader = os.Stdin
+							if localPath := c.Args().Get(0); localPath != "" && localPath != "-" {
+								f, err := os.Open(localPath)
+								if err != nil {
+									return err
+								}
+								defer f.Close()
+								r = f
+							}
+
+							fs := repo.WNFS()
+							head, err := repo.Factory().ApplyBundle(ctx, fs, r)
+							if err != nil {
+								return err
+							}
+							fmt.Printf("merged %s\n", head)
+							return repo.Commit(fs)
+						},
+					},
+				},
+			},
+			{
+				Name:    "symlink",
+				Aliases: []string{"ln"},
+				Usage:   "create a symbolic link: symlink [target] [link path]",
+				Action: func(c *cli.Context) error {
+					fs := repo.WNFS()
+					if err := fs.Symlink(c.Args().Get(0), c.Args().Get(1)); err != nil {
+						return err
+					}
+					return repo.Commit(fs)
+				},
+			},
 			{
 				Name:  "rm",
 				Usage: "remove files and directories",
@@ -273,6 +523,91 @@ size:	%d
 					return repo.Commit(fs)
 				},
 			},
+			{
+				Name:    "move",
+				Aliases: []string{"mv"},
+				Usage:   "move or rename a file or directory",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "reencrypt",
+						Value: false,
+						Usage: "allow moving between /public and /private by encrypting or decrypting contents",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					fs := repo.WNFS()
+					from, to := c.Args().Get(0), c.Args().Get(1)
+
+					mv := fs.Mv
+					if c.Bool("reencrypt") {
+						mv = fs.MvAcross
+					}
+					if err := mv(from, to); err != nil {
+						return err
+					}
+					return repo.Commit(fs)
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "restore a prior version of a file or directory",
+				ArgsUsage: "path cid",
+				Action: func(c *cli.Context) error {
+					cmdCtx, cancel := context.WithCancel(ctx)
+					defer cancel()
+					fs := repo.WNFS()
+
+					id, err := cid.Parse(c.Args().Get(1))
+					if err != nil {
+						return err
+					}
+					if err := fs.Restore(cmdCtx, c.Args().Get(0), id); err != nil {
+						return err
+					}
+					return repo.Commit(fs)
+				},
+			},
+			{
+				Name:      "tag",
+				Usage:     "name the current version, or list tags when no name is given",
+				ArgsUsage: "[name]",
+				Action: func(c *cli.Context) error {
+					fac := repo.Factory()
+					name := c.Args().Get(0)
+					if name == "" {
+						tags, err := fac.ListTags()
+						if err != nil {
+							return err
+						}
+						for _, t := range tags {
+							fmt.Printf("%s\t%s\t%s\n", t.Name, t.Root, time.Unix(t.Created, 0).Format(time.RFC3339))
+						}
+						return nil
+					}
+
+					t, err := fac.Tag(repo.WNFS(), name)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("tagged %s as %q\n", t.Root, t.Name)
+					return nil
+				},
+			},
+			{
+				Name:      "checkout",
+				Usage:     "set the current version to a tag",
+				ArgsUsage: "tag",
+				Action: func(c *cli.Context) error {
+					cmdCtx, cancel := context.WithCancel(ctx)
+					defer cancel()
+
+					if err := repo.Checkout(cmdCtx, c.Args().Get(0)); err != nil {
+						return err
+					}
+					fmt.Printf("checked out %q: %s\n", c.Args().Get(0), repo.WNFS().Cid())
+					return nil
+				},
+			},
 			{
 				Name:  "merge",
 				Usage: "",
@@ -368,9 +703,39 @@ size:	%d
 			{
 				Name:  "gateway",
 				Usage: "",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "write-token",
+						EnvVars: []string{"WNFS_GATEWAY_TOKEN"},
+						Usage:   "enable PUT, DELETE & POST write endpoints for requests with this bearer token",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					s := &gateway.Server{
+						Factory: repo.Factory(),
+					}
+					if token := c.String("write-token"); token != "" {
+						s.Authorize = gateway.BearerToken(token)
+					}
+
+					port := c.Args().Get(0)
+					if port == "" {
+						port = ":8080"
+					} else if !strings.HasPrefix(port, ":") {
+						port = ":" + port
+					}
+
+					return s.Serve(port)
+				},
+			},
+			{
+				Name:      "serve-webdav",
+				Usage:     "serve the filesystem as a writable WebDAV network drive",
+				ArgsUsage: "[port]",
 				Action: func(c *cli.Context) error {
 					s := &gateway.Server{
 						Factory: repo.Factory(),
+						WebDAV:  gateway.NewFileSystem(repo.WNFS(), repo.Commit),
 					}
 
 					port := c.Args().Get(0)
@@ -380,6 +745,7 @@ size:	%d
 						port = ":" + port
 					}
 
+					fmt.Printf("mount WebDAV drive at http://localhost%s%s\n", port, gateway.WebDAVPrefix)
 					return s.Serve(port)
 				},
 			},
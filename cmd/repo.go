@@ -7,12 +7,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 
 	blockservice "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
 	flatfs "github.com/ipfs/go-ds-flatfs"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	wnfs "github.com/functionland/wnfs-go"
+	base "github.com/functionland/wnfs-go/base"
 	private "github.com/functionland/wnfs-go/private"
 	ratchet "github.com/functionland/wnfs-go/private/ratchet"
 	public "github.com/functionland/wnfs-go/public"
@@ -44,17 +46,18 @@ type Repo struct {
 	dec   private.WritableDecryptionStore
 	store public.Store
 	state *State
+	opts  []wnfs.Option
 }
 
-func OpenRepo(ctx context.Context) (*Repo, error) {
+func OpenRepo(ctx context.Context, opts ...wnfs.Option) (*Repo, error) {
 	path, err := RepoPath()
 	if err != nil {
 		return nil, err
 	}
-	return OpenRepoPath(ctx, path)
+	return OpenRepoPath(ctx, path, opts...)
 }
 
-func OpenRepoPath(ctx context.Context, path string) (*Repo, error) {
+func OpenRepoPath(ctx context.Context, path string, opts ...wnfs.Option) (*Repo, error) {
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
 	}
@@ -89,12 +92,12 @@ func OpenRepoPath(ctx context.Context, path string) (*Repo, error) {
 	var fs wnfs.WNFS
 	if state.RootCID.Equals(cid.Cid{}) {
 		fmt.Printf("creating new wnfs filesystem...")
-		if fs, err = wnfs.NewEmptyFS(ctx, store.Blockservice(), rs, state.GetRootKey()); err != nil {
+		if fs, err = wnfs.NewEmptyFS(ctx, store.Blockservice(), rs, state.GetRootKey(), opts...); err != nil {
 			return nil, fmt.Errorf("error: creating empty WNFS: %w", err)
 		}
 		fmt.Println("done")
 	} else {
-		if fs, err = wnfs.FromCID(ctx, store.Blockservice(), rs, state.RootCID, state.GetRootKey(), state.GetPrivateName()); err != nil {
+		if fs, err = wnfs.FromCID(ctx, store.Blockservice(), rs, state.RootCID, state.GetRootKey(), state.GetPrivateName(), opts...); err != nil {
 			return nil, fmt.Errorf("error: opening WNFS CID %s:\n%w", state.RootCID, err)
 		}
 	}
@@ -106,6 +109,7 @@ func OpenRepoPath(ctx context.Context, path string) (*Repo, error) {
 		rs:    rs,
 		dec:   dec,
 		state: state,
+		opts:  opts,
 	}, nil
 }
 
@@ -117,11 +121,32 @@ func (r *Repo) Factory() wnfs.Factory {
 		BlockService: r.store.Blockservice(),
 		Ratchets:     r.rs,
 		Decryption:   r.dec,
+		Tags:         r.state,
+		Options:      r.opts,
 	}
 }
 
+// Checkout sets the repo head to the version of the filesystem referenced by
+// a tag. Commits made after a checkout continue history from the tagged version
+func (r *Repo) Checkout(ctx context.Context, name string) error {
+	t, err := r.state.GetTag(name)
+	if err != nil {
+		return err
+	}
+	fs, err := r.Factory().LoadTag(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	r.fs = fs
+	r.state.RootCID = t.Root
+	r.state.PrivateRootName = t.PrivateName
+	r.state.RootKey = t.Key
+	return r.state.Write()
+}
+
 func (r *Repo) Commit(fs wnfs.WNFS) error {
-	res, err := fs.Commit()
+	res, err := r.Factory().Commit(fs)
 	if err != nil {
 		return err
 	}
@@ -130,12 +155,6 @@ func (r *Repo) Commit(fs wnfs.WNFS) error {
 	r.state.PrivateRootName = res.PrivateName
 	r.state.RootKey = res.PrivateKey
 
-	if r.state.PrivateRootName != nil && r.state.RootKey != nil {
-		if err = r.dec.PutDecryptionFields(r.state.RootCID, *r.state.PrivateRootName, *r.state.RootKey); err != nil {
-			return fmt.Errorf("updating decryption store: %w", err)
-		}
-	}
-
 	fmt.Printf("writing root cid: %s ...", r.state.RootCID)
 	if err := r.state.Write(); err != nil {
 		fmt.Printf("\n")
@@ -150,8 +169,11 @@ type State struct {
 	RootCID         cid.Cid
 	RootKey         *wnfs.Key
 	PrivateRootName *wnfs.PrivateName
+	Tags            map[string]wnfs.Tag `json:",omitempty"`
 }
 
+var _ wnfs.TagStore = (*State)(nil)
+
 func loadOrCreateState(ctx context.Context, path string) (*State, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -198,6 +220,31 @@ func (s *State) GetPrivateName() wnfs.PrivateName {
 	return *s.PrivateRootName
 }
 
+func (s *State) GetTag(name string) (wnfs.Tag, error) {
+	t, ok := s.Tags[name]
+	if !ok {
+		return t, fmt.Errorf("tag %q: %w", name, base.ErrNotFound)
+	}
+	return t, nil
+}
+
+func (s *State) PutTag(t wnfs.Tag) error {
+	if s.Tags == nil {
+		s.Tags = map[string]wnfs.Tag{}
+	}
+	s.Tags[t.Name] = t
+	return s.Write()
+}
+
+func (s *State) ListTags() ([]wnfs.Tag, error) {
+	tags := make([]wnfs.Tag, 0, len(s.Tags))
+	for _, t := range s.Tags {
+		tags = append(tags, t)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
 func (s *State) Write() error {
 	data, err := json.Marshal(s)
 	if err != nil {
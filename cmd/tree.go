@@ -56,6 +56,10 @@ func walkAdd(p treeprint.Tree, v interface{}) error {
 	return nil
 }
 
+type readlinker interface {
+	Readlink(pathStr string) (string, error)
+}
+
 func fileTree(fsys fs.FS, path string, f fs.File) (interface{}, error) {
 	fi, err := f.Stat()
 	if err != nil {
@@ -75,6 +79,14 @@ func fileTree(fsys fs.FS, path string, f fs.File) (interface{}, error) {
 	tree := make([]interface{}, 0, len(dir))
 	for _, ent := range dir {
 		name := ent.Name()
+		// show symlink targets instead of following links, which may form cycles
+		if rl, ok := fsys.(readlinker); ok {
+			if target, err := rl.Readlink(filepath.Join(path, name)); err == nil {
+				tree = append(tree, fmt.Sprintf("%s -> %s", name, target))
+				continue
+			}
+		}
+
 		if ent.IsDir() {
 			subPath := filepath.Join(path, name)
 			f, err := fsys.Open(subPath)
@@ -0,0 +1,355 @@
+package wnfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	base "github.com/functionland/wnfs-go/base"
+)
+
+// ExportTarget receives the directories, files & symlinks of a tree written by
+// Export. Paths are slash-separated & relative to the exported directory,
+// which is passed to Mkdir as ".". Parent directories are always written
+// before their contents. Export calls Close once all entries are written
+type ExportTarget interface {
+	Mkdir(p string, fi fs.FileInfo) error
+	WriteFile(p string, fi fs.FileInfo, r io.Reader) error
+	Symlink(p, target string) error
+	Close() error
+}
+
+// Export writes the file or directory at srcPath & all of its descendants to
+// dst. Files in /private are decrypted. Symlinks are exported as links, not
+// followed. Export holds a read lock on the filesystem until it returns
+func (fsys *fileSystem) Export(ctx context.Context, srcPath string, dst ExportTarget) (err error) {
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	log.Debugw("fileSystem.Export", "srcPath", srcPath)
+	defer func() {
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	f, err := fsys.open(srcPath)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fsys.exportNode(ctx, srcPath, path.Base(srcPath), dst)
+	}
+	return fsys.exportNode(ctx, srcPath, ".", dst)
+}
+
+func (fsys *fileSystem) exportNode(ctx context.Context, pathStr, rel string, dst ExportTarget) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if rel != "." {
+		tree, relPath, err := fsys.fsHierarchyDirectoryNode(pathStr)
+		if err != nil {
+			return err
+		}
+		if target, err := tree.Readlink(relPath); err == nil {
+			return dst.Symlink(rel, relativeLinkTarget(relPath, target))
+		}
+	}
+
+	f, err := fsys.open(pathStr)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		var r io.Reader = f
+		if _, ok := f.(base.LDFile); ok {
+			// structured data is encoded on read, buffer to get an accurate size
+			data, err := ioutil.ReadAll(f)
+			if err != nil {
+				return err
+			}
+			fi = sizedFileInfo{FileInfo: fi, size: int64(len(data))}
+			r = bytes.NewReader(data)
+		}
+		if err := dst.WriteFile(rel, fi, r); err != nil {
+			return fmt.Errorf("exporting %q: %w", pathStr, err)
+		}
+		return nil
+	}
+
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return fmt.Errorf("cannot read directory %q", pathStr)
+	}
+	ents, err := dir.ReadDir(-1)
+	if err != nil {
+		return err
+	}
+	if err := dst.Mkdir(rel, fi); err != nil {
+		return fmt.Errorf("exporting %q: %w", pathStr, err)
+	}
+	for _, ent := range ents {
+		if err := fsys.exportNode(ctx, path.Join(pathStr, ent.Name()), path.Join(rel, ent.Name()), dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sizedFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi sizedFileInfo) Size() int64 { return fi.size }
+
+// exportPerm returns permission bits for an exported node, always granting
+// the owner access
+func exportPerm(fi fs.FileInfo, isDir bool) fs.FileMode {
+	if isDir {
+		return fi.Mode().Perm() | 0700
+	}
+	return fi.Mode().Perm() | 0600
+}
+
+func modTime(fi fs.FileInfo) time.Time {
+	if fi.ModTime().IsZero() {
+		return base.Timestamp()
+	}
+	return fi.ModTime()
+}
+
+// dirTarget exports to a directory on the host filesystem
+type dirTarget struct {
+	root string
+	dirs []dirMtime
+}
+
+type dirMtime struct {
+	path  string
+	mtime time.Time
+}
+
+// NewDirTarget creates an ExportTarget that writes to the host directory at
+// root, creating it if necessary. Mode bits & modification times are restored
+// from node headers
+func NewDirTarget(root string) ExportTarget {
+	return &dirTarget{root: root}
+}
+
+func (t *dirTarget) hostPath(p string) string {
+	return filepath.Join(t.root, filepath.FromSlash(p))
+}
+
+func (t *dirTarget) Mkdir(p string, fi fs.FileInfo) error {
+	hp := t.hostPath(p)
+	if err := os.MkdirAll(hp, exportPerm(fi, true)); err != nil {
+		return err
+	}
+	if err := os.Chmod(hp, exportPerm(fi, true)); err != nil {
+		return err
+	}
+	// directory mtimes change as contents are written, set them on Close
+	t.dirs = append(t.dirs, dirMtime{path: hp, mtime: modTime(fi)})
+	return nil
+}
+
+func (t *dirTarget) WriteFile(p string, fi fs.FileInfo, r io.Reader) error {
+	hp := t.hostPath(p)
+	f, err := os.OpenFile(hp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, exportPerm(fi, false))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(hp, exportPerm(fi, false)); err != nil {
+		return err
+	}
+	mtime := modTime(fi)
+	return os.Chtimes(hp, mtime, mtime)
+}
+
+func (t *dirTarget) Symlink(p, target string) error {
+	hp := t.hostPath(p)
+	if err := os.Remove(hp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(target, hp)
+}
+
+func (t *dirTarget) Close() error {
+	// children were appended after parents, set deepest directories first
+	for i := len(t.dirs) - 1; i >= 0; i-- {
+		d := t.dirs[i]
+		if err := os.Chtimes(d.path, d.mtime, d.mtime); err != nil {
+			return err
+		}
+	}
+	t.dirs = nil
+	return nil
+}
+
+// tarTarget exports to a tar stream
+type tarTarget struct {
+	w *tar.Writer
+}
+
+// NewTarTarget creates an ExportTarget that writes a tar archive to w. Close
+// writes the tar footer but doesn't close w
+func NewTarTarget(w io.Writer) ExportTarget {
+	return &tarTarget{w: tar.NewWriter(w)}
+}
+
+func (t *tarTarget) Mkdir(p string, fi fs.FileInfo) error {
+	if p == "." {
+		return nil
+	}
+	return t.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     p + "/",
+		Mode:     int64(exportPerm(fi, true)),
+		ModTime:  modTime(fi),
+	})
+}
+
+func (t *tarTarget) WriteFile(p string, fi fs.FileInfo, r io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     p,
+		Mode:     int64(exportPerm(fi, false)),
+		ModTime:  modTime(fi),
+		Size:     fi.Size(),
+	}
+	if err := t.w.WriteHeader(hdr); err != nil {
+		return err
+	}
+	n, err := io.Copy(t.w, r)
+	if err != nil {
+		return err
+	}
+	if n != hdr.Size {
+		return fmt.Errorf("%q: expected %d bytes, read %d", p, hdr.Size, n)
+	}
+	return nil
+}
+
+func (t *tarTarget) Symlink(p, target string) error {
+	return t.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     p,
+		Linkname: target,
+		Mode:     0777,
+		ModTime:  base.Timestamp(),
+	})
+}
+
+func (t *tarTarget) Close() error {
+	return t.w.Close()
+}
+
+// zipTarget exports to a zip archive
+type zipTarget struct {
+	w *zip.Writer
+}
+
+// NewZipTarget creates an ExportTarget that writes a zip archive to w. Files
+// are compressed as they're written, without seeking or buffering whole files.
+// Close writes the zip central directory but doesn't close w
+func NewZipTarget(w io.Writer) ExportTarget {
+	return &zipTarget{w: zip.NewWriter(w)}
+}
+
+func (t *zipTarget) Mkdir(p string, fi fs.FileInfo) error {
+	if p == "." {
+		return nil
+	}
+	hdr := &zip.FileHeader{Name: p + "/", Modified: modTime(fi)}
+	hdr.SetMode(fs.ModeDir | exportPerm(fi, true))
+	_, err := t.w.CreateHeader(hdr)
+	return err
+}
+
+func (t *zipTarget) WriteFile(p string, fi fs.FileInfo, r io.Reader) error {
+	hdr := &zip.FileHeader{Name: p, Method: zip.Deflate, Modified: modTime(fi)}
+	hdr.SetMode(exportPerm(fi, false))
+	w, err := t.w.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return err
+	}
+	if n != fi.Size() {
+		return fmt.Errorf("%q: expected %d bytes, read %d", p, fi.Size(), n)
+	}
+	return nil
+}
+
+func (t *zipTarget) Symlink(p, target string) error {
+	hdr := &zip.FileHeader{Name: p, Modified: base.Timestamp()}
+	hdr.SetMode(fs.ModeSymlink | 0777)
+	w, err := t.w.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, target)
+	return err
+}
+
+func (t *zipTarget) Close() error {
+	return t.w.Close()
+}
+
+// relativeLinkTarget rewrites an absolute target of the symlink at linkPath
+// relative to the link's directory. WNFS resolves absolute targets from the
+// hierarchy root, which means nothing outside the filesystem
+func relativeLinkTarget(linkPath base.Path, target string) string {
+	if !path.IsAbs(target) {
+		return target
+	}
+	dir := linkPath[:len(linkPath)-1]
+	dst := strings.Split(strings.TrimPrefix(path.Clean(target), "/"), "/")
+	if dst[0] == "" {
+		dst = nil
+	}
+	i := 0
+	for i < len(dir) && i < len(dst) && dir[i] == dst[i] {
+		i++
+	}
+	parts := make([]string, 0, len(dir)-i+len(dst)-i)
+	for range dir[i:] {
+		parts = append(parts, "..")
+	}
+	if rel := path.Join(append(parts, dst[i:]...)...); rel != "" {
+		return rel
+	}
+	return "."
+}
@@ -37,10 +37,43 @@ func (t DeltaType) String() string {
 	}
 }
 
+// MarshalText encodes a delta type as a word, used for JSON encoding
+func (t DeltaType) MarshalText() ([]byte, error) {
+	switch t {
+	case DTUnchanged:
+		return []byte("unchanged"), nil
+	case DTAdd:
+		return []byte("add"), nil
+	case DTChange:
+		return []byte("change"), nil
+	case DTRemove:
+		return []byte("remove"), nil
+	default:
+		return nil, fmt.Errorf("unknown delta type %d", t)
+	}
+}
+
+// UnmarshalText decodes a delta type encoded by MarshalText
+func (t *DeltaType) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "unchanged":
+		*t = DTUnchanged
+	case "add":
+		*t = DTAdd
+	case "change":
+		*t = DTChange
+	case "remove":
+		*t = DTRemove
+	default:
+		return fmt.Errorf("unknown delta type %q", text)
+	}
+	return nil
+}
+
 type Delta struct {
-	Type   DeltaType
-	Name   string
-	Deltas []*Delta
+	Type   DeltaType `json:"type"`
+	Name   string    `json:"name"`
+	Deltas []*Delta  `json:"deltas,omitempty"`
 }
 
 func (d Delta) String() string {
@@ -1,9 +1,14 @@
 package gateway
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
 
 	"github.com/ipfs/go-cid"
 	golog "github.com/ipfs/go-log"
@@ -21,38 +26,79 @@ func init() {
 
 type Server struct {
 	Factory wnfs.Factory
+	// WebDAV, if set, is served as a writable network drive under WebDAVPrefix
+	WebDAV *FileSystem
+	// Authorize checks requests to the PUT, DELETE & POST write endpoints,
+	// which are only served when Authorize is set
+	Authorize func(r *http.Request) error
 }
 
 func (s *Server) Serve(addr string) error {
+	return s.router().Start(addr)
+}
+
+func (s *Server) router() *echo.Echo {
 	e := echo.New()
 	e.HideBanner = true
+	if s.WebDAV != nil {
+		e.Pre(webDAVMiddleware(WebDAVPrefix, s.WebDAV))
+	}
 	e.GET("/:cid", s.HandleIndex)
 	e.GET("/:cid/*", s.HandleIndex)
+	e.HEAD("/:cid", s.HandleIndex)
+	e.HEAD("/:cid/*", s.HandleIndex)
 	e.GET("/history/:cid/*", s.HandleHistory)
 	e.GET("/diff/:cid/*", s.HandleDiff)
-	return e.Start(addr)
+	if s.Authorize != nil {
+		e.PUT("/:cid/*", s.HandlePut, s.authorize)
+		e.DELETE("/:cid/*", s.HandleDelete, s.authorize)
+		e.POST("/:cid/*", s.HandlePost, s.authorize)
+	}
+	return e
 }
 
 func (s *Server) HandleIndex(e echo.Context) error {
 	ctx := e.Request().Context()
-	n, err := s.open(ctx, e)
+	fsys, n, err := s.open(ctx, e)
 	if err != nil {
 		return err
 	}
 
+	setCacheHeaders(e, n)
+
+	if format := e.QueryParam("format"); format != "" && n.Type() == base.NTDir {
+		if notModified(e) {
+			return e.NoContent(http.StatusNotModified)
+		}
+		return serveArchive(e, fsys, fsPath(e.Param("*")), n, format)
+	}
+
+	if wantsJSON(e) && n.Type() != base.NTLDFile {
+		if notModified(e) {
+			return e.NoContent(http.StatusNotModified)
+		}
+		if n.Type() == base.NTDir {
+			return s.listingJSON(e, fsPath(e.Param("*")), n)
+		}
+		return e.JSON(http.StatusOK, newEntry(n))
+	}
+
 	switch n.Type() {
 	case base.NTFile:
-		if _, err = io.Copy(e.Response(), n); err != nil {
+		if err = serveFile(e, n); err != nil {
 			log.Errorw("writing response error", "err", err)
 			return err
 		}
 	case base.NTLDFile:
 		e.Response().Header().Set("Content-Type", "application/json")
-		if _, err = io.Copy(e.Response(), n); err != nil {
+		if err = serveFile(e, n); err != nil {
 			log.Errorw("writing response error", "err", err)
 			return err
 		}
 	case base.NTDir:
+		if notModified(e) {
+			return e.NoContent(http.StatusNotModified)
+		}
 		if err = RenderIndex(e.Response(), e.Request().URL.Path, n); err != nil {
 			log.Errorw("rendering node error", "err", err)
 			return err
@@ -64,16 +110,31 @@ func (s *Server) HandleIndex(e echo.Context) error {
 
 func (s *Server) HandleHistory(e echo.Context) error {
 	ctx := e.Request().Context()
-	n, err := s.open(ctx, e)
+	_, n, err := s.open(ctx, e)
 	if err != nil {
 		return err
 	}
 
-	hist, err := n.History(ctx, 100)
+	offset, limit, err := historyPage(e)
+	if err != nil {
+		return err
+	}
+	hist, err := n.History(ctx, offset+limit+1)
 	if err != nil {
 		log.Errorw("history", "err", err)
 		return err
 	}
+	hist, more := paginate(hist, offset, limit)
+
+	if wantsJSON(e) {
+		return e.JSON(http.StatusOK, HistoryPage{
+			Path:    fsPath(e.Param("*")),
+			Offset:  offset,
+			Limit:   limit,
+			More:    more,
+			Entries: hist,
+		})
+	}
 
 	if err = RenderHistory(e.Response(), e.Request().URL.Path, n, hist); err != nil {
 		log.Errorw("rendering history error", "err", err)
@@ -85,7 +146,7 @@ func (s *Server) HandleHistory(e echo.Context) error {
 
 func (s *Server) HandleDiff(e echo.Context) error {
 	ctx := e.Request().Context()
-	idstr, path := e.Param("cid"), e.Param("*")
+	idstr, path := e.Param("cid"), fsPath(e.Param("*"))
 	log.Infow("open", "cid", idstr, "path", path)
 
 	id, err := cid.Parse(idstr)
@@ -119,6 +180,20 @@ func (s *Server) HandleDiff(e echo.Context) error {
 		return err
 	}
 
+	if wantsJSON(e) {
+		delta, err := fsdiff.Tree(path, path, prev, fs)
+		if err != nil {
+			log.Errorw("constructing diff", "err", err)
+			return err
+		}
+		return e.JSON(http.StatusOK, DiffResult{
+			Path:     path,
+			Root:     id,
+			Previous: entries[1].Cid,
+			Delta:    delta,
+		})
+	}
+
 	diff, err := fsdiff.Unix(path, path, prev, fs)
 	if err != nil {
 		log.Errorw("constructing diff", "err", err)
@@ -133,27 +208,143 @@ func (s *Server) HandleDiff(e echo.Context) error {
 	return nil
 }
 
-func (s *Server) open(ctx context.Context, e echo.Context) (wnfs.Node, error) {
-	idstr, path := e.Param("cid"), e.Param("*")
+func (s *Server) open(ctx context.Context, e echo.Context) (wnfs.WNFS, wnfs.Node, error) {
+	idstr, path := e.Param("cid"), fsPath(e.Param("*"))
 	log.Infow("open", "cid", idstr, "path", path)
 
 	id, err := cid.Parse(idstr)
 	if err != nil {
 		log.Infow("parsing input CID", "cidstr", idstr, "err", err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	fs, err := s.Factory.Load(ctx, id)
 	if err != nil {
 		log.Errorw("loading FS", "cid", idstr, "err", err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	f, err := fs.Open(path)
 	if err != nil {
 		log.Infow("opening path", "cidstr", idstr, "path", path, "err", err)
-		return nil, err
+		return nil, nil, err
 	}
 
-	return f.(base.Node), nil
+	return fs, f.(base.Node), nil
+}
+
+// setCacheHeaders marks responses for a node as cacheable forever. Gateway
+// URLs start with a root CID, so the node at a URL never changes. Decrypted
+// private content is only cacheable by the client
+func setCacheHeaders(e echo.Context, n base.Node) {
+	id := n.Cid()
+	if !id.Defined() {
+		return
+	}
+	h := e.Response().Header()
+	// JSON, archive & HTML representations of a node need distinct ETags
+	etag := id.String()
+	if format := e.QueryParam("format"); format != "" && n.Type() == base.NTDir {
+		etag += "." + format
+	} else if wantsJSON(e) && n.Type() != base.NTLDFile {
+		etag += ".json"
+	}
+	h.Set("Etag", `"`+etag+`"`)
+	h.Set("Vary", "Accept")
+	if wnfs.NodeIsPrivate(n) {
+		h.Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+}
+
+// notModified reports whether the request's If-None-Match header matches the
+// response ETag
+func notModified(e echo.Context) bool {
+	etag := e.Response().Header().Get("Etag")
+	if etag == "" {
+		return false
+	}
+	for _, v := range strings.Split(e.Request().Header.Get("If-None-Match"), ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == etag || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// serveFile writes file contents, sniffing Content-Type from the file
+// extension or contents when it isn't already set. Seekable files support
+// range requests & conditional requests against the ETag
+func serveFile(e echo.Context, n base.Node) error {
+	w, r := e.Response(), e.Request()
+	rs, ok := n.(io.ReadSeeker)
+	if ok {
+		_, err := rs.Seek(0, io.SeekStart)
+		ok = err == nil
+	}
+	if ok {
+		w.Header().Set("Accept-Ranges", "bytes")
+		http.ServeContent(w, r, n.Name(), n.ModTime(), rs)
+		return nil
+	}
+
+	if notModified(e) {
+		return e.NoContent(http.StatusNotModified)
+	}
+	var body io.Reader = n
+	if w.Header().Get("Content-Type") == "" {
+		ctype := mime.TypeByExtension(path.Ext(n.Name()))
+		if ctype == "" {
+			buf := make([]byte, 512)
+			k, _ := io.ReadFull(n, buf)
+			ctype = http.DetectContentType(buf[:k])
+			body = io.MultiReader(bytes.NewReader(buf[:k]), n)
+		}
+		w.Header().Set("Content-Type", ctype)
+	}
+	_, err := io.Copy(w, body)
+	return err
+}
+
+// serveArchive streams the directory at p as a tar or zip archive. Entries are
+// relative to the directory. Export errors after the response starts can't
+// change the status, so they abort the response instead
+func serveArchive(e echo.Context, fsys wnfs.WNFS, p string, n base.Node, format string) error {
+	var (
+		w      = e.Response()
+		target wnfs.ExportTarget
+		ctype  string
+	)
+	switch format {
+	case "tar":
+		target, ctype = wnfs.NewTarTarget(w), "application/x-tar"
+	case "zip":
+		target, ctype = wnfs.NewZipTarget(w), "application/zip"
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unsupported archive format %q, expected tar or zip", format))
+	}
+
+	name := n.Name()
+	if p == "." || name == "" {
+		name = e.Param("cid")
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+	w.WriteHeader(http.StatusOK)
+
+	if err := fsys.Export(e.Request().Context(), p, target); err != nil {
+		log.Errorw("writing archive", "path", p, "format", format, "err", err)
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
+// fsPath converts a URL path to an io/fs path, where the root is "."
+func fsPath(urlPath string) string {
+	if p := strings.Trim(urlPath, "/"); p != "" {
+		return p
+	}
+	return "."
 }
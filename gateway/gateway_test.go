@@ -0,0 +1,317 @@
+package gateway
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/functionland/wnfs-go"
+	"github.com/functionland/wnfs-go/base"
+	"github.com/functionland/wnfs-go/fsdiff"
+	mockblocks "github.com/functionland/wnfs-go/mockblocks"
+	"github.com/functionland/wnfs-go/private"
+	ratchet "github.com/functionland/wnfs-go/private/ratchet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleIndex(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dec, err := private.NewDecryptionStore(filepath.Join(t.TempDir(), "decryption.json"))
+	require.Nil(err)
+	fac := wnfs.Factory{
+		BlockService: mockblocks.NewOfflineMemBlockservice(),
+		Ratchets:     ratchet.NewMemStore(ctx),
+		Decryption:   dec,
+	}
+	fsys, err := wnfs.NewEmptyFS(ctx, fac.BlockService, fac.Ratchets, wnfs.NewKey())
+	require.Nil(err)
+
+	big := bytes.Repeat([]byte("0123456789"), 50000)
+	require.Nil(fsys.Mkdir("public/dir"))
+	require.Nil(fsys.Write("public/dir/hello.txt", base.NewMemfileBytes("hello.txt", []byte("hello world"))))
+	require.Nil(fsys.Write("public/dir/big", base.NewMemfileBytes("big", big)))
+	require.Nil(fsys.Write("public/dir/page", base.NewMemfileBytes("page", []byte("<html><body>hi</body></html>"))))
+	require.Nil(fsys.Write("private/secret.txt", base.NewMemfileBytes("secret.txt", []byte("secret"))))
+	res, err := fac.Commit(fsys)
+	require.Nil(err)
+
+	gw := &Server{Factory: fac}
+	s := httptest.NewServer(gw.router())
+	defer s.Close()
+
+	get := func(method, p string, header map[string]string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+"/"+res.Root.String()+p, nil)
+		require.Nil(err)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		r, err := http.DefaultClient.Do(req)
+		require.Nil(err)
+		defer r.Body.Close()
+		data, err := ioutil.ReadAll(r.Body)
+		require.Nil(err)
+		return r, data
+	}
+
+	r, body := get("GET", "/public/dir/hello.txt", nil)
+	require.Equal(http.StatusOK, r.StatusCode)
+	require.Equal("hello world", string(body))
+	require.Equal("text/plain; charset=utf-8", r.Header.Get("Content-Type"))
+	require.Equal("bytes", r.Header.Get("Accept-Ranges"))
+	require.Equal("public, max-age=31536000, immutable", r.Header.Get("Cache-Control"))
+	etag := r.Header.Get("Etag")
+	require.NotEmpty(etag)
+
+	r, _ = get("GET", "/public/dir/hello.txt", map[string]string{"If-None-Match": etag})
+	require.Equal(http.StatusNotModified, r.StatusCode)
+
+	r, body = get("GET", "/public/dir/hello.txt", map[string]string{"Range": "bytes=6-"})
+	require.Equal(http.StatusPartialContent, r.StatusCode)
+	require.Equal("world", string(body))
+
+	r, body = get("GET", "/public/dir/big", map[string]string{"Range": "bytes=300000-300009"})
+	require.Equal(http.StatusPartialContent, r.StatusCode)
+	require.Equal(string(big[300000:300010]), string(body))
+	require.Equal("bytes 300000-300009/500000", r.Header.Get("Content-Range"))
+
+	r, body = get("HEAD", "/public/dir/big", nil)
+	require.Equal(http.StatusOK, r.StatusCode)
+	require.Equal("500000", r.Header.Get("Content-Length"))
+	require.Empty(body)
+
+	r, _ = get("GET", "/public/dir/page", nil)
+	require.Equal("text/html; charset=utf-8", r.Header.Get("Content-Type"))
+
+	r, body = get("GET", "/private/secret.txt", nil)
+	require.Equal("secret", string(body))
+	require.Equal("private, max-age=31536000, immutable", r.Header.Get("Cache-Control"))
+
+	r, _ = get("GET", "/public/dir", nil)
+	require.Equal(http.StatusOK, r.StatusCode)
+	dirTag := r.Header.Get("Etag")
+	require.NotEmpty(dirTag)
+	require.NotEqual(etag, dirTag)
+	r, _ = get("GET", "/public/dir", map[string]string{"If-None-Match": dirTag})
+	require.Equal(http.StatusNotModified, r.StatusCode)
+}
+
+func TestJSONAPI(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dec, err := private.NewDecryptionStore(filepath.Join(t.TempDir(), "decryption.json"))
+	require.Nil(err)
+	fac := wnfs.Factory{
+		BlockService: mockblocks.NewOfflineMemBlockservice(),
+		Ratchets:     ratchet.NewMemStore(ctx),
+		Decryption:   dec,
+	}
+	fsys, err := wnfs.NewEmptyFS(ctx, fac.BlockService, fac.Ratchets, wnfs.NewKey())
+	require.Nil(err)
+
+	var res wnfs.CommitResult
+	for i := 0; i < 5; i++ {
+		require.Nil(fsys.Write("public/dir/file.txt", base.NewMemfileBytes("file.txt", []byte(fmt.Sprintf("version %d", i)))))
+		require.Nil(fsys.Write("private/dir/file.txt", base.NewMemfileBytes("file.txt", []byte(fmt.Sprintf("version %d", i)))))
+		res, err = fac.Commit(fsys)
+		require.Nil(err)
+	}
+	require.Nil(fsys.Write("public/dir/added.txt", base.NewMemfileBytes("added.txt", []byte("added"))))
+	res, err = fac.Commit(fsys)
+	require.Nil(err)
+
+	gw := &Server{Factory: fac}
+	s := httptest.NewServer(gw.router())
+	defer s.Close()
+
+	getJSON := func(p string, v interface{}) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest("GET", s.URL+p, nil)
+		require.Nil(err)
+		req.Header.Set("Accept", "application/json")
+		r, err := http.DefaultClient.Do(req)
+		require.Nil(err)
+		defer r.Body.Close()
+		require.Equal(http.StatusOK, r.StatusCode)
+		require.Equal("application/json; charset=UTF-8", r.Header.Get("Content-Type"))
+		require.Nil(json.NewDecoder(r.Body).Decode(v))
+		return r
+	}
+
+	for _, dir := range []string{"public", "private"} {
+		t.Run(dir, func(t *testing.T) {
+			l := Listing{}
+			getJSON("/"+res.Root.String()+"/"+dir+"/dir", &l)
+			require.Equal(dir+"/dir", l.Path)
+			require.Equal(dir == "private", l.Private)
+			require.Equal(base.NTDir, l.Entry.Type)
+			names := []string{}
+			for _, ent := range l.Entries {
+				names = append(names, ent.Name)
+				if ent.Name == "file.txt" {
+					require.Equal(base.NTFile, ent.Type)
+					require.Equal(int64(len("version 4")), ent.Size)
+					require.NotNil(ent.Cid)
+				}
+			}
+			require.Contains(names, "file.txt")
+
+			ent := Entry{}
+			getJSON("/"+res.Root.String()+"/"+dir+"/dir/file.txt", &ent)
+			require.Equal("file.txt", ent.Name)
+			require.NotNil(ent.Cid)
+
+			page := HistoryPage{}
+			getJSON("/history/"+res.Root.String()+"/"+dir+"/dir/file.txt?limit=2&offset=1", &page)
+			require.Equal(2, len(page.Entries))
+			require.True(page.More)
+			page = HistoryPage{}
+			getJSON("/history/"+res.Root.String()+"/"+dir+"/dir/file.txt?limit=10&offset=3", &page)
+			require.Equal(2, len(page.Entries))
+			require.False(page.More)
+
+			// offsets that overflow the number of entries to load are rejected
+			r, err := http.Get(s.URL + "/history/" + res.Root.String() + "/" + dir + "/dir/file.txt?offset=" + strconv.Itoa(math.MaxInt))
+			require.Nil(err)
+			r.Body.Close()
+			require.Equal(http.StatusBadRequest, r.StatusCode)
+		})
+	}
+
+	diff := DiffResult{}
+	getJSON("/diff/"+res.Root.String()+"/public/dir", &diff)
+	require.Equal(res.Root, diff.Root)
+	require.NotNil(diff.Delta)
+	types := map[string]fsdiff.DeltaType{}
+	for _, d := range diff.Delta.Deltas {
+		types[d.Name] = d.Type
+	}
+	require.Equal(map[string]fsdiff.DeltaType{"added.txt": fsdiff.DTAdd, "file.txt": fsdiff.DTUnchanged}, types)
+}
+
+func TestArchiveDownload(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dec, err := private.NewDecryptionStore(filepath.Join(t.TempDir(), "decryption.json"))
+	require.Nil(err)
+	fac := wnfs.Factory{
+		BlockService: mockblocks.NewOfflineMemBlockservice(),
+		Ratchets:     ratchet.NewMemStore(ctx),
+		Decryption:   dec,
+	}
+	fsys, err := wnfs.NewEmptyFS(ctx, fac.BlockService, fac.Ratchets, wnfs.NewKey())
+	require.Nil(err)
+
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	files := map[string]string{
+		"a.txt":     "alpha",
+		"sub/b.txt": "bravo",
+	}
+	for _, dir := range []string{"public/dir", "private/dir"} {
+		require.Nil(fsys.Mkdir(dir + "/sub"))
+		for name, content := range files {
+			require.Nil(fsys.Write(dir+"/"+name, base.NewMemfileBytes(path.Base(name), []byte(content))))
+			require.Nil(fsys.Chtimes(dir+"/"+name, mtime))
+		}
+		require.Nil(fsys.Chmod(dir+"/a.txt", 0640))
+	}
+	res, err := fac.Commit(fsys)
+	require.Nil(err)
+
+	gw := &Server{Factory: fac}
+	s := httptest.NewServer(gw.router())
+	defer s.Close()
+
+	download := func(p string) (*http.Response, []byte) {
+		t.Helper()
+		r, err := http.Get(s.URL + "/" + res.Root.String() + p)
+		require.Nil(err)
+		defer r.Body.Close()
+		data, err := ioutil.ReadAll(r.Body)
+		require.Nil(err)
+		require.Equal(http.StatusOK, r.StatusCode, string(data))
+		return r, data
+	}
+
+	for _, dir := range []string{"public/dir", "private/dir"} {
+		t.Run(dir+"/tar", func(t *testing.T) {
+			r, data := download("/" + dir + "?format=tar")
+			require.Equal("application/x-tar", r.Header.Get("Content-Type"))
+			require.Equal(`attachment; filename=dir.tar`, r.Header.Get("Content-Disposition"))
+
+			got := map[string]string{}
+			tr := tar.NewReader(bytes.NewReader(data))
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				require.Nil(err)
+				if hdr.Typeflag == tar.TypeDir {
+					require.Equal("sub/", hdr.Name)
+					continue
+				}
+				content, err := ioutil.ReadAll(tr)
+				require.Nil(err)
+				got[hdr.Name] = string(content)
+				require.True(mtime.Equal(hdr.ModTime), "%s mtime: %s", hdr.Name, hdr.ModTime)
+				if hdr.Name == "a.txt" {
+					require.Equal(int64(0640), hdr.Mode)
+				}
+			}
+			require.Equal(files, got)
+		})
+
+		t.Run(dir+"/zip", func(t *testing.T) {
+			r, data := download("/" + dir + "?format=zip")
+			require.Equal("application/zip", r.Header.Get("Content-Type"))
+
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			require.Nil(err)
+			got := map[string]string{}
+			for _, f := range zr.File {
+				if f.FileInfo().IsDir() {
+					require.Equal("sub/", f.Name)
+					continue
+				}
+				rc, err := f.Open()
+				require.Nil(err)
+				content, err := ioutil.ReadAll(rc)
+				rc.Close()
+				require.Nil(err)
+				got[f.Name] = string(content)
+				require.True(mtime.Equal(f.Modified), "%s mtime: %s", f.Name, f.Modified)
+				if f.Name == "a.txt" {
+					require.Equal(fs.FileMode(0640), f.Mode())
+				}
+			}
+			require.Equal(files, got)
+		})
+	}
+
+	r, err := http.Get(s.URL + "/" + res.Root.String() + "/public/dir?format=rar")
+	require.Nil(err)
+	r.Body.Close()
+	require.Equal(http.StatusBadRequest, r.StatusCode)
+}
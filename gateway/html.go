@@ -76,10 +76,10 @@ func newTemplate(name string) (*template.Template, error) {
 			return humanize.Bytes(uint64(i))
 		},
 		"RelTimestamp": func(i int64) string {
-			return humanize.Time(time.Unix(i, 0))
+			return humanize.Time(base.DecodeTimestamp(i))
 		},
 		"Timestamp": func(i int64) string {
-			return time.Unix(i, 0).Format(time.RFC3339)
+			return base.DecodeTimestamp(i).Format(time.RFC3339)
 		},
 		"DiffHTML": func(file fsdiff.FileDiff) template.HTML {
 			return template.HTML(fsdiff.HTMLPrintFileDiff(file))
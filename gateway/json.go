@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	"io/fs"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/labstack/echo/v4"
+	"github.com/functionland/wnfs-go"
+	"github.com/functionland/wnfs-go/base"
+	"github.com/functionland/wnfs-go/fsdiff"
+)
+
+const (
+	// defaultHistoryLimit is the number of history entries returned when a
+	// request doesn't specify a limit
+	defaultHistoryLimit = 100
+	// maxHistoryLimit caps the number of history entries in a single response
+	maxHistoryLimit = 1000
+)
+
+// Entry describes a file or directory in JSON responses
+type Entry struct {
+	Name  string        `json:"name"`
+	Cid   *cid.Cid      `json:"cid,omitempty"`
+	Type  base.NodeType `json:"type"`
+	Size  int64         `json:"size"`
+	Mode  fs.FileMode   `json:"mode"`
+	Mtime int64         `json:"mtime"`
+}
+
+// Listing is the JSON response for a directory
+type Listing struct {
+	Path    string  `json:"path"`
+	Private bool    `json:"private"`
+	Entry   Entry   `json:"entry"`
+	Entries []Entry `json:"entries"`
+}
+
+// HistoryPage is the JSON response for a page of history entries. More is
+// true when older entries follow the page
+type HistoryPage struct {
+	Path    string              `json:"path"`
+	Offset  int                 `json:"offset"`
+	Limit   int                 `json:"limit"`
+	More    bool                `json:"more"`
+	Entries []base.HistoryEntry `json:"entries"`
+}
+
+// DiffResult is the JSON response for changes to a path between a version of
+// a filesystem & the version before it
+type DiffResult struct {
+	Path     string        `json:"path"`
+	Root     cid.Cid       `json:"root"`
+	Previous cid.Cid       `json:"previous"`
+	Delta    *fsdiff.Delta `json:"delta"`
+}
+
+// WriteResult is the JSON response for write endpoints
+type WriteResult struct {
+	Root cid.Cid `json:"root"`
+}
+
+// wantsJSON reports whether the request accepts JSON responses
+func wantsJSON(e echo.Context) bool {
+	return strings.Contains(e.Request().Header.Get("Accept"), echo.MIMEApplicationJSON)
+}
+
+func newEntry(fi fs.FileInfo) Entry {
+	ent := Entry{
+		Name:  fi.Name(),
+		Size:  fi.Size(),
+		Mode:  fi.Mode(),
+		Mtime: base.EncodeTimestamp(fi.ModTime()),
+		Type:  base.NTFile,
+	}
+	if fi.IsDir() {
+		ent.Type = base.NTDir
+	}
+	if nd, ok := fi.(base.Node); ok {
+		ent.Type = nd.Type()
+		if id := nd.Cid(); id.Defined() {
+			ent.Cid = &id
+		}
+	}
+	return ent
+}
+
+func (s *Server) listingJSON(e echo.Context, path string, n base.Node) error {
+	dir, ok := n.(fs.ReadDirFile)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "not a directory")
+	}
+	ents, err := dir.ReadDir(-1)
+	if err != nil {
+		return err
+	}
+
+	l := Listing{
+		Path:    path,
+		Private: wnfs.NodeIsPrivate(n),
+		Entry:   newEntry(n),
+		Entries: make([]Entry, 0, len(ents)),
+	}
+	for _, ent := range ents {
+		fi, err := ent.Info()
+		if err != nil {
+			log.Infow("listing entry", "path", path, "name", ent.Name(), "err", err)
+			l.Entries = append(l.Entries, Entry{Name: ent.Name(), Type: base.NTFile})
+			continue
+		}
+		l.Entries = append(l.Entries, newEntry(fi))
+	}
+	return e.JSON(http.StatusOK, l)
+}
+
+// historyPage reads offset & limit query params, loading one extra entry to
+// detect if more entries follow
+func historyPage(e echo.Context) (offset, limit int, err error) {
+	limit = defaultHistoryLimit
+	if v := e.QueryParam("offset"); v != "" {
+		// offset+limit+1 history entries are loaded, reject offsets that
+		// overflow the sum
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 || offset > math.MaxInt-maxHistoryLimit-1 {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid offset")
+		}
+	}
+	if v := e.QueryParam("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	return offset, limit, nil
+}
+
+func paginate(hist []base.HistoryEntry, offset, limit int) (page []base.HistoryEntry, more bool) {
+	if offset >= len(hist) {
+		return []base.HistoryEntry{}, false
+	}
+	hist = hist[offset:]
+	if len(hist) > limit {
+		return hist[:limit], true
+	}
+	return hist, false
+}
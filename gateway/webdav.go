@@ -0,0 +1,271 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/functionland/wnfs-go"
+	"golang.org/x/net/webdav"
+)
+
+// WebDAVPrefix is the URL path the gateway serves WebDAV requests under
+const WebDAVPrefix = "/dav"
+
+// CommitFunc persists changes made to a filesystem
+type CommitFunc func(fsys wnfs.WNFS) error
+
+// FileSystem adapts a WNFS to http.FileSystem & webdav.FileSystem. Mkdir,
+// RemoveAll & Rename commit immediately, files opened for writing commit when
+// they're closed
+type FileSystem struct {
+	fsys   wnfs.WNFS
+	commit CommitFunc
+	lk     sync.Mutex
+	// crossHierarchyMoves enables re-encrypting moves between /public &
+	// /private
+	crossHierarchyMoves bool
+}
+
+var (
+	_ http.FileSystem   = (*FileSystem)(nil)
+	_ webdav.FileSystem = (*FileSystem)(nil)
+)
+
+// FileSystemOption configures a FileSystem
+type FileSystemOption func(dfs *FileSystem)
+
+// AllowCrossHierarchyMoves lets Rename move files between the public & private
+// hierarchies, encrypting or decrypting their contents. Without it moving
+// across hierarchies fails with fs.ErrPermission
+func AllowCrossHierarchyMoves(dfs *FileSystem) {
+	dfs.crossHierarchyMoves = true
+}
+
+// NewFileSystem wraps fsys, calling commit to persist each change. A nil
+// commit func calls fsys.Commit
+func NewFileSystem(fsys wnfs.WNFS, commit CommitFunc, opts ...FileSystemOption) *FileSystem {
+	if commit == nil {
+		commit = func(fsys wnfs.WNFS) error {
+			_, err := fsys.Commit()
+			return err
+		}
+	}
+	dfs := &FileSystem{fsys: fsys, commit: commit}
+	for _, opt := range opts {
+		opt(dfs)
+	}
+	return dfs
+}
+
+func (dfs *FileSystem) commitChanges() error {
+	dfs.lk.Lock()
+	defer dfs.lk.Unlock()
+	return dfs.commit(dfs.fsys)
+}
+
+// Open opens name for reading, implementing http.FileSystem
+func (dfs *FileSystem) Open(name string) (http.File, error) {
+	return dfs.open(name)
+}
+
+func (dfs *FileSystem) open(name string) (*readFile, error) {
+	f, err := dfs.fsys.Open(fsPath(name))
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &readFile{File: f}, nil
+}
+
+// Mkdir creates the directory name. The parent directory must exist. perm is
+// ignored, directories are created with the default mode
+func (dfs *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	p := fsPath(name)
+	if _, err := dfs.fsys.Stat(p); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if err := dfs.checkParent(p); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	if err := dfs.fsys.Mkdir(p); err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return dfs.commitChanges()
+}
+
+// OpenFile opens name with os.OpenFile-style flags. Files opened for writing
+// commit changes on Close
+func (dfs *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		return dfs.open(name)
+	}
+
+	p := fsPath(name)
+	if flag&os.O_CREATE != 0 {
+		if err := dfs.checkParent(p); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	f, err := dfs.fsys.OpenFile(p, flag, perm)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &writeFile{File: f, dfs: dfs}, nil
+}
+
+// RemoveAll removes name & any children. Removing a missing file is not an
+// error
+func (dfs *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	p := fsPath(name)
+	if p == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	if err := dfs.fsys.Rm(p); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return pathError("remove", name, err)
+	}
+	return dfs.commitChanges()
+}
+
+// Rename moves oldName to newName. Moving between the public & private
+// hierarchies fails with fs.ErrPermission unless the FileSystem was created
+// with AllowCrossHierarchyMoves
+func (dfs *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	from, to := fsPath(oldName), fsPath(newName)
+	err := dfs.fsys.Mv(from, to)
+	if errors.Is(err, wnfs.ErrCrossHierarchyMove) {
+		if !dfs.crossHierarchyMoves {
+			return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrPermission}
+		}
+		err = dfs.fsys.MvAcross(from, to)
+	}
+	if err != nil {
+		return pathError("rename", oldName, err)
+	}
+	return dfs.commitChanges()
+}
+
+// Stat returns file info for name
+func (dfs *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	fi, err := dfs.fsys.Stat(fsPath(name))
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return fi, nil
+}
+
+// checkParent errors if the parent directory of p doesn't exist
+func (dfs *FileSystem) checkParent(p string) error {
+	fi, err := dfs.fsys.Stat(path.Dir(p))
+	if err != nil {
+		return fs.ErrNotExist
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%q is not a directory", path.Dir(p))
+	}
+	return nil
+}
+
+// pathError wraps not exist & exist errors in a form os.IsNotExist &
+// os.IsExist recognize, which the webdav package uses to pick status codes
+func pathError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		err = fs.ErrNotExist
+	case errors.Is(err, fs.ErrExist):
+		err = fs.ErrExist
+	default:
+		return err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// readFile is a read-only file, implementing http.File & webdav.File
+type readFile struct {
+	fs.File
+}
+
+func (f *readFile) Readdir(count int) ([]fs.FileInfo, error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, errors.New("not a directory")
+	}
+	ents, err := dir.ReadDir(count)
+	infos := make([]fs.FileInfo, 0, len(ents))
+	for _, ent := range ents {
+		fi, err := ent.Info()
+		if err != nil {
+			return infos, err
+		}
+		infos = append(infos, fi)
+	}
+	return infos, err
+}
+
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, errors.New("file is not seekable")
+	}
+	return s.Seek(offset, whence)
+}
+
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, errors.New("file is not open for writing")
+}
+
+// writeFile is a file opened for writing that commits changes on Close
+type writeFile struct {
+	wnfs.File
+	dfs *FileSystem
+}
+
+func (f *writeFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
+
+func (f *writeFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return f.dfs.commitChanges()
+}
+
+// WebDAVHandler serves fsys over WebDAV for requests under prefix
+func WebDAVHandler(prefix string, fsys webdav.FileSystem) http.Handler {
+	return &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: fsys,
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Infow("webdav", "method", r.Method, "path", r.URL.Path, "err", err)
+			}
+		},
+	}
+}
+
+// webDAVMiddleware passes requests under prefix to a WebDAV handler before
+// routing. echo can't route WebDAV methods like MKCOL & MOVE
+func webDAVMiddleware(prefix string, fsys webdav.FileSystem) echo.MiddlewareFunc {
+	h := WebDAVHandler(prefix, fsys)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if p := c.Request().URL.Path; p == prefix || strings.HasPrefix(p, prefix+"/") {
+				h.ServeHTTP(c.Response(), c.Request())
+				return nil
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"context"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/functionland/wnfs-go"
+	mockblocks "github.com/functionland/wnfs-go/mockblocks"
+	ratchet "github.com/functionland/wnfs-go/private/ratchet"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebDAV(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fsys, err := wnfs.NewEmptyFS(ctx, mockblocks.NewOfflineMemBlockservice(), ratchet.NewMemStore(ctx), wnfs.NewKey())
+	require.Nil(err)
+
+	commits := 0
+	dav := NewFileSystem(fsys, func(fsys wnfs.WNFS) error {
+		commits++
+		_, err := fsys.Commit()
+		return err
+	})
+
+	e := echo.New()
+	e.Pre(webDAVMiddleware(WebDAVPrefix, dav))
+	s := httptest.NewServer(e)
+	defer s.Close()
+
+	do := func(method, p, body string, header map[string]string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+WebDAVPrefix+p, strings.NewReader(body))
+		require.Nil(err)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.Nil(err)
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		require.Nil(err)
+		return res.StatusCode, string(data)
+	}
+
+	for _, dir := range []string{"public", "private"} {
+		t.Run(dir, func(t *testing.T) {
+			status, _ := do("MKCOL", "/"+dir+"/docs", "", nil)
+			require.Equal(http.StatusCreated, status)
+			status, _ = do("MKCOL", "/"+dir+"/docs", "", nil)
+			require.Equal(http.StatusMethodNotAllowed, status)
+			status, _ = do("MKCOL", "/"+dir+"/missing/docs", "", nil)
+			require.Equal(http.StatusConflict, status)
+
+			status, _ = do("PUT", "/"+dir+"/docs/hello.txt", "hello world", nil)
+			require.Equal(http.StatusCreated, status)
+			status, body := do("GET", "/"+dir+"/docs/hello.txt", "", nil)
+			require.Equal(http.StatusOK, status)
+			require.Equal("hello world", body)
+			got, err := fsys.Cat(dir + "/docs/hello.txt")
+			require.Nil(err)
+			require.Equal("hello world", string(got))
+
+			status, body = do("PROPFIND", "/"+dir+"/docs", "", map[string]string{"Depth": "1"})
+			require.Equal(http.StatusMultiStatus, status)
+			require.Contains(body, "hello.txt")
+
+			status, _ = do("MOVE", "/"+dir+"/docs/hello.txt", "", map[string]string{"Destination": s.URL + WebDAVPrefix + "/" + dir + "/moved.txt"})
+			require.Equal(http.StatusCreated, status)
+			status, body = do("GET", "/"+dir+"/moved.txt", "", nil)
+			require.Equal(http.StatusOK, status)
+			require.Equal("hello world", body)
+
+			status, _ = do("DELETE", "/"+dir+"/docs", "", nil)
+			require.Equal(http.StatusNoContent, status)
+			status, _ = do("GET", "/"+dir+"/docs", "", nil)
+			require.Equal(http.StatusNotFound, status)
+		})
+	}
+
+	// moves between hierarchies are forbidden unless the server opts in
+	status, _ := do("MOVE", "/private/moved.txt", "", map[string]string{"Destination": s.URL + WebDAVPrefix + "/public/from_private.txt"})
+	require.Equal(http.StatusForbidden, status)
+	_, err = fsys.Stat("public/from_private.txt")
+	require.ErrorIs(err, fs.ErrNotExist)
+	_, err = fsys.Stat("private/moved.txt")
+	require.Nil(err)
+
+	AllowCrossHierarchyMoves(dav)
+	status, _ = do("MOVE", "/public/moved.txt", "", map[string]string{"Destination": s.URL + WebDAVPrefix + "/private/from_public.txt"})
+	require.Equal(http.StatusCreated, status)
+	got, err := fsys.Cat("private/from_public.txt")
+	require.Nil(err)
+	require.Equal("hello world", string(got))
+
+	// mkdir, put, move & delete each commit once per hierarchy, plus the
+	// cross-hierarchy move
+	require.Equal(9, commits)
+
+	hist, err := fsys.History(ctx, ".", -1)
+	require.Nil(err)
+	require.Equal(commits+1, len(hist))
+}
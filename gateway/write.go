@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+
+	"github.com/ipfs/go-cid"
+	"github.com/labstack/echo/v4"
+	"github.com/functionland/wnfs-go"
+	"github.com/functionland/wnfs-go/base"
+)
+
+// RootCIDHeader is the response header write endpoints set to the root CID of
+// the committed filesystem. Clients pass the new root to the next request to
+// chain updates
+const RootCIDHeader = "X-Wnfs-Root"
+
+// BearerToken returns an authorization func that accepts requests with an
+// "Authorization: Bearer <token>" header
+func BearerToken(token string) func(r *http.Request) error {
+	want := []byte("Bearer " + token)
+	return func(r *http.Request) error {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			return errors.New("invalid or missing bearer token")
+		}
+		return nil
+	}
+}
+
+func (s *Server) authorize(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(e echo.Context) error {
+		if err := s.Authorize(e.Request()); err != nil {
+			log.Infow("unauthorized write", "method", e.Request().Method, "path", e.Request().URL.Path, "err", err)
+			return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+		}
+		return next(e)
+	}
+}
+
+// HandlePut writes the request body to the file at path
+func (s *Server) HandlePut(e echo.Context) error {
+	return s.write(e, http.StatusCreated, func(fsys wnfs.WNFS, p string) error {
+		return fsys.Write(p, base.NewMemfileReader(path.Base(p), e.Request().Body))
+	})
+}
+
+// HandleDelete removes the file or directory at path
+func (s *Server) HandleDelete(e echo.Context) error {
+	return s.write(e, http.StatusNoContent, func(fsys wnfs.WNFS, p string) error {
+		return fsys.Rm(p)
+	})
+}
+
+// HandlePost creates a directory at path when called with a mkdir query
+// parameter
+func (s *Server) HandlePost(e echo.Context) error {
+	if _, ok := e.QueryParams()["mkdir"]; !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unsupported operation, expected ?mkdir")
+	}
+	return s.write(e, http.StatusCreated, func(fsys wnfs.WNFS, p string) error {
+		return fsys.Mkdir(p)
+	})
+}
+
+// write applies fn to the filesystem at the requested CID, commits & responds
+// with the new root CID
+func (s *Server) write(e echo.Context, status int, fn func(fsys wnfs.WNFS, path string) error) error {
+	ctx := e.Request().Context()
+	idstr, p := e.Param("cid"), fsPath(e.Param("*"))
+	log.Infow("write", "method", e.Request().Method, "cid", idstr, "path", p)
+
+	id, err := cid.Parse(idstr)
+	if err != nil {
+		log.Infow("parsing input CID", "cidstr", idstr, "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid CID %q", idstr))
+	}
+
+	fsys, err := s.Factory.Load(ctx, id)
+	if err != nil {
+		log.Errorw("loading FS", "cid", idstr, "err", err)
+		return err
+	}
+
+	if err := fn(fsys, p); err != nil {
+		log.Infow("writing", "cid", idstr, "path", p, "err", err)
+		return writeError(err)
+	}
+
+	res, err := s.Factory.Commit(fsys)
+	if err != nil {
+		log.Errorw("committing", "cid", idstr, "err", err)
+		return err
+	}
+
+	e.Response().Header().Set(RootCIDHeader, res.Root.String())
+	if wantsJSON(e) {
+		if status == http.StatusNoContent {
+			status = http.StatusOK
+		}
+		return e.JSON(status, WriteResult{Root: res.Root})
+	}
+	return e.NoContent(status)
+}
+
+func writeError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, fs.ErrExist):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, wnfs.ErrReadOnly):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	default:
+		return err
+	}
+}
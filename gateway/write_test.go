@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/functionland/wnfs-go"
+	mockblocks "github.com/functionland/wnfs-go/mockblocks"
+	"github.com/functionland/wnfs-go/private"
+	ratchet "github.com/functionland/wnfs-go/private/ratchet"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteEndpoints(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dec, err := private.NewDecryptionStore(filepath.Join(t.TempDir(), "decryption.json"))
+	require.Nil(err)
+	fac := wnfs.Factory{
+		BlockService: mockblocks.NewOfflineMemBlockservice(),
+		Ratchets:     ratchet.NewMemStore(ctx),
+		Decryption:   dec,
+	}
+
+	fsys, err := wnfs.NewEmptyFS(ctx, fac.BlockService, fac.Ratchets, wnfs.NewKey())
+	require.Nil(err)
+	res, err := fac.Commit(fsys)
+	require.Nil(err)
+	root := res.Root
+
+	gw := &Server{Factory: fac, Authorize: BearerToken("secret")}
+	s := httptest.NewServer(gw.router())
+	defer s.Close()
+
+	do := func(method, p, body, token string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+p, strings.NewReader(body))
+		require.Nil(err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.Nil(err)
+		res.Body.Close()
+		return res
+	}
+	// write performs an authorized request against the current root, chaining
+	// to the returned root
+	write := func(method, p, body string, status int) {
+		t.Helper()
+		res := do(method, "/"+root.String()+p, body, "secret")
+		require.Equal(status, res.StatusCode)
+		if status < 300 {
+			root, err = cid.Parse(res.Header.Get(RootCIDHeader))
+			require.Nil(err)
+		}
+	}
+
+	require.Equal(http.StatusUnauthorized, do("PUT", "/"+root.String()+"/public/a.txt", "a", "").StatusCode)
+	require.Equal(http.StatusUnauthorized, do("PUT", "/"+root.String()+"/public/a.txt", "a", "wrong").StatusCode)
+
+	write("POST", "/public/docs?mkdir", "", http.StatusCreated)
+	write("PUT", "/public/docs/a.txt", "public file", http.StatusCreated)
+	write("POST", "/private/docs?mkdir", "", http.StatusCreated)
+	write("PUT", "/private/docs/b.txt", "private file", http.StatusCreated)
+	write("POST", "/private/docs", "", http.StatusBadRequest)
+	require.Equal(http.StatusBadRequest, do("PUT", "/notacid/public/a.txt", "a", "secret").StatusCode)
+
+	// the factory can open private files of the new root
+	fsys, err = fac.Load(ctx, root)
+	require.Nil(err)
+	data, err := fsys.Cat("public/docs/a.txt")
+	require.Nil(err)
+	require.Equal("public file", string(data))
+	data, err = fsys.Cat("private/docs/b.txt")
+	require.Nil(err)
+	require.Equal("private file", string(data))
+
+	res2, err := http.Get(s.URL + "/" + root.String() + "/private/docs/b.txt")
+	require.Nil(err)
+	data, err = ioutil.ReadAll(res2.Body)
+	res2.Body.Close()
+	require.Nil(err)
+	require.Equal("private file", string(data))
+
+	write("DELETE", "/private/docs", "", http.StatusNoContent)
+	fsys, err = fac.Load(ctx, root)
+	require.Nil(err)
+	_, err = fsys.Stat("private/docs")
+	require.NotNil(err)
+	data, err = fsys.Cat("public/docs/a.txt")
+	require.Nil(err)
+	require.Equal("public file", string(data))
+}
@@ -0,0 +1,216 @@
+package wnfs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+
+	base "github.com/functionland/wnfs-go/base"
+)
+
+// ImportOptions configure Import
+type ImportOptions struct {
+	// Include & Exclude are gitignore-style patterns (see base.GlobMatcher)
+	// matched against slash-separated paths relative to the import source.
+	// When Include is set only files that match, or are within a matching
+	// directory, are imported. Excluded files & directories are never imported
+	Include []string
+	Exclude []string
+	// SkipUnchanged skips files that already exist at the destination with the
+	// same size & a modification time no older than the source file
+	SkipUnchanged bool
+	// Progress is called after each file is imported, skipped or fails.
+	// Progress is called without holding the filesystem lock, & may read from
+	// the filesystem
+	Progress func(p ImportProgress)
+}
+
+// ImportProgress reports the state of a running import
+type ImportProgress struct {
+	Path    string // source path of the file just processed
+	Files   int    // number of files imported so far
+	Skipped int    // number of unchanged files skipped so far
+	Failed  int    // number of files that failed to import so far
+	Bytes   int64  // number of bytes imported so far
+	Err     error  // error importing Path, if any
+}
+
+// ImportResult summarizes a completed import
+type ImportResult struct {
+	Files   int
+	Skipped int
+	Bytes   int64
+}
+
+// ImportError is returned by Import when one or more files could not be
+// imported. All other files are still written
+type ImportError struct {
+	// Failed maps source paths to the error encountered importing them
+	Failed map[string]error
+}
+
+func (e *ImportError) Error() string {
+	paths := make([]string, 0, len(e.Failed))
+	for p := range e.Failed {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return fmt.Sprintf("%d files failed to import, first failure %q: %s", len(paths), paths[0], e.Failed[paths[0]])
+}
+
+// Import recursively copies the contents of src into the directory dst,
+// creating directories as needed. Unlike Cp, a file that fails to import
+// doesn't stop the import, failures are collected & returned as an
+// *ImportError once all other files are written. Import stops if ctx is
+// cancelled. The filesystem lock is held while writing each file rather than
+// for the whole import, so reads & writes can interleave with an import
+func (fsys *fileSystem) Import(ctx context.Context, dst string, src fs.FS, opts ImportOptions) (res ImportResult, err error) {
+	log.Debugw("fileSystem.Import", "dst", dst)
+
+	include, err := base.NewGlobMatcher(opts.Include)
+	if err != nil {
+		return res, fmt.Errorf("include: %w", err)
+	}
+	exclude, err := base.NewGlobMatcher(opts.Exclude)
+	if err != nil {
+		return res, fmt.Errorf("exclude: %w", err)
+	}
+	fsys.lk.RLock()
+	_, _, err = fsys.fsHierarchyDirectoryNode(dst)
+	fsys.lk.RUnlock()
+	if err != nil {
+		return res, err
+	}
+
+	var (
+		prog   ImportProgress
+		failed = map[string]error{}
+	)
+	report := func(p string, err error) {
+		prog.Path, prog.Err = p, err
+		if err != nil {
+			prog.Failed++
+			failed[p] = err
+		}
+		if opts.Progress != nil {
+			opts.Progress(prog)
+		}
+	}
+
+	err = fs.WalkDir(src, ".", func(p string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if p == "." {
+				return err
+			}
+			report(p, err)
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if p != "." && exclude.Match(p, true) {
+				return fs.SkipDir
+			}
+			// with include patterns, directories are created as files are added
+			if include.Len() == 0 {
+				if err := fsys.importDir(path.Join(dst, p)); err != nil {
+					report(p, err)
+					return fs.SkipDir
+				}
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() || exclude.Match(p, false) {
+			return nil
+		}
+		if include.Len() > 0 && !include.MatchAncestors(p, false) {
+			return nil
+		}
+
+		size, skipped, err := fsys.importFile(path.Join(dst, p), p, src, opts.SkipUnchanged)
+		switch {
+		case err != nil:
+		case skipped:
+			prog.Skipped++
+		default:
+			prog.Files++
+			prog.Bytes += size
+		}
+		report(p, err)
+		return nil
+	})
+
+	res = ImportResult{Files: prog.Files, Skipped: prog.Skipped, Bytes: prog.Bytes}
+	if err != nil {
+		return res, err
+	}
+	if len(failed) > 0 {
+		return res, &ImportError{Failed: failed}
+	}
+	return res, nil
+}
+
+// importDir creates the directory at pathStr if it doesn't exist
+func (fsys *fileSystem) importDir(pathStr string) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	tree, relPath, err := fsys.fsHierarchyDirectoryNode(pathStr)
+	if err != nil {
+		return err
+	}
+	if f, err := tree.Get(relPath); err == nil {
+		if fi, err := f.Stat(); err == nil && fi.IsDir() {
+			return nil
+		}
+		return fmt.Errorf("%q exists and is not a directory", pathStr)
+	}
+	_, err = tree.Mkdir(relPath)
+	return err
+}
+
+// importFile writes the file at srcPath to pathStr, returning the number of
+// bytes written. When skipUnchanged is true & the destination file has the
+// same size & is at least as new as the source, importFile reports the file as
+// skipped instead. src is opened before acquiring the filesystem lock, so
+// files can be imported from the filesystem itself
+func (fsys *fileSystem) importFile(pathStr, srcPath string, src fs.FS, skipUnchanged bool) (size int64, skipped bool, err error) {
+	f, err := src.Open(srcPath)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	tree, relPath, err := fsys.fsHierarchyDirectoryNode(pathStr)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if skipUnchanged {
+		if existing, err := tree.Get(relPath); err == nil {
+			efi, err := existing.Stat()
+			existing.Close()
+			if err == nil && !efi.IsDir() && efi.Size() == fi.Size() && efi.ModTime().Unix() >= fi.ModTime().Unix() {
+				return 0, true, nil
+			}
+		}
+	}
+
+	if _, err = tree.Add(relPath, f); err != nil {
+		return 0, false, fmt.Errorf("writing %q: %w", pathStr, err)
+	}
+	return fi.Size(), false, nil
+}
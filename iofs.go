@@ -0,0 +1,313 @@
+package wnfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	base "github.com/functionland/wnfs-go/base"
+)
+
+var errNotDir = errors.New("not a directory")
+
+// Stat returns file info for the file or directory at name, following
+// symlinks
+func (fsys *fileSystem) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	f, err := fsys.open(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// Lstat returns file info for name without following a final symlink
+func (fsys *fileSystem) Lstat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	fi, err := fsys.lstat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return fi, nil
+}
+
+func (fsys *fileSystem) lstat(name string) (fs.FileInfo, error) {
+	if tree, relPath, err := fsys.fsHierarchyDirectoryNode(name); err == nil && len(relPath) > 0 {
+		if _, err := tree.Readlink(relPath); err == nil {
+			// symlink info comes from the entry in the parent directory
+			return fsys.entryInfo(path.Dir(name), path.Base(name))
+		}
+	}
+	f, err := fsys.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+func (fsys *fileSystem) entryInfo(dir, name string) (fs.FileInfo, error) {
+	f, err := fsys.open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, errNotDir
+	}
+	ents, err := d.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+	for _, ent := range ents {
+		if ent.Name() == name {
+			return ent.Info()
+		}
+	}
+	return nil, base.ErrNotFound
+}
+
+// ReadLink returns the target of the symlink at name. ReadLink is Readlink
+// for io/fs paths
+func (fsys *fileSystem) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := fsys.Readlink(name)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return target, nil
+}
+
+// ReadDir lists the directory at name, sorted by filename
+func (fsys *fileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	f, err := fsys.open(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	defer f.Close()
+
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	if fi, err := dir.Stat(); err != nil || !fi.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	ents, err := dir.ReadDir(-1)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	sort.Slice(ents, func(i, j int) bool { return ents[i].Name() < ents[j].Name() })
+	return fsys.lockedDirEntries(ents), nil
+}
+
+// ReadFile reads the contents of the file at name
+func (fsys *fileSystem) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	f, err := fsys.open(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// Glob returns the names of all files matching pattern, holding a read lock
+// on the filesystem while matching
+func (fsys *fileSystem) Glob(pattern string) ([]string, error) {
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	return fs.Glob(unlockedFS{fsys}, pattern)
+}
+
+// Sub returns the filesystem rooted at directory dir
+func (fsys *fileSystem) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return fsys, nil
+	}
+	fi, err := fsys.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: errNotDir}
+	}
+	sub, err := fs.Sub(ioFS{fsys}, dir)
+	if err != nil {
+		return nil, err
+	}
+	return subFS{sub: sub, fsys: fsys, dir: dir}, nil
+}
+
+// subFS is a directory of a fileSystem returned by Sub. subFS keeps the
+// filesystem & directory it reads from, so Cp can copy from a subFS of the
+// filesystem it holds the lock of
+type subFS struct {
+	sub  fs.FS
+	fsys *fileSystem
+	dir  string
+}
+
+func (s subFS) Open(name string) (fs.File, error)          { return s.sub.Open(name) }
+func (s subFS) Stat(name string) (fs.FileInfo, error)      { return fs.Stat(s.sub, name) }
+func (s subFS) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(s.sub, name) }
+func (s subFS) ReadFile(name string) ([]byte, error)       { return fs.ReadFile(s.sub, name) }
+func (s subFS) Glob(pattern string) ([]string, error)      { return fs.Glob(s.sub, pattern) }
+
+func (s subFS) Lstat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrInvalid}
+	}
+	fi, err := s.fsys.Lstat(path.Join(s.dir, name))
+	return fi, s.trimErrPath(err)
+}
+
+func (s subFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := s.fsys.ReadLink(path.Join(s.dir, name))
+	return target, s.trimErrPath(err)
+}
+
+func (s subFS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return s, nil
+	}
+	sub, err := s.fsys.Sub(path.Join(s.dir, dir))
+	return sub, s.trimErrPath(err)
+}
+
+// trimErrPath makes the path of a PathError relative to the subFS directory
+func (s subFS) trimErrPath(err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) && strings.HasPrefix(pe.Path, s.dir+"/") {
+		pe.Path = strings.TrimPrefix(pe.Path, s.dir+"/")
+	}
+	return err
+}
+
+// ioFS exposes the io/fs methods of a fileSystem other than Sub, so fs.Sub
+// wraps it instead of calling back into fileSystem.Sub
+type ioFS struct {
+	fsys *fileSystem
+}
+
+func (f ioFS) Open(name string) (fs.File, error)          { return f.fsys.Open(name) }
+func (f ioFS) Stat(name string) (fs.FileInfo, error)      { return f.fsys.Stat(name) }
+func (f ioFS) Lstat(name string) (fs.FileInfo, error)     { return f.fsys.Lstat(name) }
+func (f ioFS) ReadLink(name string) (string, error)       { return f.fsys.ReadLink(name) }
+func (f ioFS) ReadDir(name string) ([]fs.DirEntry, error) { return f.fsys.ReadDir(name) }
+func (f ioFS) ReadFile(name string) ([]byte, error)       { return f.fsys.ReadFile(name) }
+func (f ioFS) Glob(pattern string) ([]string, error)      { return f.fsys.Glob(pattern) }
+
+// dirFile is a directory returned by Open. Trees are shared by all opens of a
+// directory, dirFile tracks the read position of paginated ReadDir calls
+type dirFile struct {
+	base.Tree
+	fsys *fileSystem
+	ents []fs.DirEntry
+	read bool
+}
+
+func (fsys *fileSystem) openDirFile(f fs.File) fs.File {
+	if t, ok := f.(base.Tree); ok && t.IsDir() {
+		return &dirFile{Tree: t, fsys: fsys}
+	}
+	return f
+}
+
+// ReadDir reads the next n entries of the directory, returning io.EOF once
+// all entries are read. If n <= 0, ReadDir returns all remaining entries
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		d.fsys.lk.RLock()
+		ents, err := d.Tree.ReadDir(-1)
+		d.fsys.lk.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		d.ents, d.read = d.fsys.lockedDirEntries(ents), true
+	}
+
+	if n <= 0 {
+		ents := d.ents
+		d.ents = nil
+		return ents, nil
+	}
+	if len(d.ents) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.ents) {
+		n = len(d.ents)
+	}
+	ents := d.ents[:n]
+	d.ents = d.ents[n:]
+	return ents, nil
+}
+
+func (d *dirFile) SetMetadata(v interface{}) error {
+	mn, ok := d.Tree.(base.WritableMetaNode)
+	if !ok {
+		return errors.New("cannot set metadata of directory")
+	}
+	return mn.SetMetadata(v)
+}
+
+// lockedDirEntries wraps entries to hold a read lock on the filesystem while
+// loading entry info
+func (fsys *fileSystem) lockedDirEntries(ents []fs.DirEntry) []fs.DirEntry {
+	for i, ent := range ents {
+		ents[i] = lockedDirEntry{DirEntry: ent, lk: &fsys.lk}
+	}
+	return ents
+}
+
+type lockedDirEntry struct {
+	fs.DirEntry
+	lk *sync.RWMutex
+}
+
+func (e lockedDirEntry) Type() fs.FileMode {
+	e.lk.RLock()
+	defer e.lk.RUnlock()
+	return e.DirEntry.Type()
+}
+
+func (e lockedDirEntry) Info() (fs.FileInfo, error) {
+	e.lk.RLock()
+	defer e.lk.RUnlock()
+	return e.DirEntry.Info()
+}
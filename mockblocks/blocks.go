@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	block "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-blockservice"
@@ -27,6 +28,7 @@ func NewOfflineFileBlockservice(tmpFilePrefix string) (bserv blockservice.BlockS
 }
 
 type memBlockstore struct {
+	lk    sync.Mutex
 	data  map[cid.Cid]block.Block
 	stats blockstoreStats
 }
@@ -34,7 +36,7 @@ type memBlockstore struct {
 var _ blockstore.Blockstore = (*memBlockstore)(nil)
 
 func NewMemBlockstore() *memBlockstore {
-	return &memBlockstore{make(map[cid.Cid]block.Block), blockstoreStats{}}
+	return &memBlockstore{data: make(map[cid.Cid]block.Block)}
 }
 
 func (mb *memBlockstore) DeleteBlock(_ context.Context, id cid.Cid) error {
@@ -42,6 +44,8 @@ func (mb *memBlockstore) DeleteBlock(_ context.Context, id cid.Cid) error {
 }
 
 func (mb *memBlockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	mb.lk.Lock()
+	defer mb.lk.Unlock()
 	_, has := mb.data[c]
 	return has, nil
 }
@@ -54,6 +58,8 @@ func (mb *memBlockstore) GetSize(context.Context, cid.Cid) (int, error) {
 // PutMany puts a slice of blocks at the same time using batching
 // capabilities of the underlying datastore whenever possible.
 func (mb *memBlockstore) PutMany(_ context.Context, bs []block.Block) error {
+	mb.lk.Lock()
+	defer mb.lk.Unlock()
 	for _, blk := range bs {
 		mb.data[blk.Cid()] = blk
 	}
@@ -64,9 +70,16 @@ func (mb *memBlockstore) PutMany(_ context.Context, bs []block.Block) error {
 // the CIDs in the memBlockstore can be read. It should respect
 // the given context, closing the channel if it becomes Done.
 func (mb *memBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	mb.lk.Lock()
+	ids := make([]cid.Cid, 0, len(mb.data))
+	for id := range mb.data {
+		ids = append(ids, id)
+	}
+	mb.lk.Unlock()
+
 	cids := make(chan cid.Cid)
 	go func() {
-		for id := range mb.data {
+		for _, id := range ids {
 			cids <- id
 		}
 		close(cids)
@@ -81,6 +94,8 @@ func (mb *memBlockstore) HashOnRead(enabled bool) {
 }
 
 func (mb *memBlockstore) Get(_ context.Context, c cid.Cid) (block.Block, error) {
+	mb.lk.Lock()
+	defer mb.lk.Unlock()
 	mb.stats.evtcntGet++
 	d, ok := mb.data[c]
 	if ok {
@@ -90,6 +105,8 @@ func (mb *memBlockstore) Get(_ context.Context, c cid.Cid) (block.Block, error)
 }
 
 func (mb *memBlockstore) Put(_ context.Context, b block.Block) error {
+	mb.lk.Lock()
+	defer mb.lk.Unlock()
 	mb.stats.evtcntPut++
 	if _, exists := mb.data[b.Cid()]; exists {
 		mb.stats.evtcntPutDup++
@@ -105,6 +122,8 @@ type blockstoreStats struct {
 }
 
 func (mb *memBlockstore) totalBlockSizes() int {
+	mb.lk.Lock()
+	defer mb.lk.Unlock()
 	sum := 0
 	for _, v := range mb.data {
 		sum += len(v.RawData())
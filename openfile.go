@@ -0,0 +1,268 @@
+package wnfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	base "github.com/functionland/wnfs-go/base"
+	chunkpatch "github.com/functionland/wnfs-go/chunkpatch"
+	private "github.com/functionland/wnfs-go/private"
+	public "github.com/functionland/wnfs-go/public"
+)
+
+// File is a file opened by OpenFile. Writes are held in memory & written to
+// the filesystem as a new revision of the file by Sync or Close. Only chunks
+// of the file touched by writes are re-encoded, all others are shared with
+// the prior revision
+type File interface {
+	fs.File
+	io.Writer
+	io.ReaderAt
+	io.WriterAt
+	io.Seeker
+	// Truncate changes the size of the file, growing files fill with zeros
+	Truncate(size int64) error
+	// Sync writes pending changes as a new revision of the file
+	Sync() error
+}
+
+// ErrFileClosed is returned when using a File after it's closed
+var ErrFileClosed = errors.New("file already closed")
+
+// OpenFile opens the file at pathStr with os.OpenFile-style flags. O_CREATE
+// creates missing files with permissions perm, O_EXCL fails if the file
+// exists, O_TRUNC empties the file & O_APPEND writes at the end of the file.
+// Once a handle syncs changes to a file, other handles opened on the file
+// before the sync fail to sync with chunkpatch.ErrBaseChanged
+func (fsys *fileSystem) OpenFile(pathStr string, flag int, perm fs.FileMode) (File, error) {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	log.Debugw("fileSystem.OpenFile", "pathStr", pathStr, "flag", flag, "perm", perm)
+	tree, relPath, err := fsys.fsHierarchyDirectoryNode(pathStr)
+	if err != nil {
+		return nil, err
+	}
+	if len(relPath) == 0 {
+		return nil, fmt.Errorf("%q is not a file", pathStr)
+	}
+
+	p, err := openPatch(tree, relPath)
+	if errors.Is(err, base.ErrNotFound) && flag&os.O_CREATE != 0 {
+		if err = createEmpty(tree, relPath, perm); err != nil {
+			return nil, err
+		}
+		p, err = openPatch(tree, relPath)
+	} else if err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, fmt.Errorf("%q: %w", pathStr, fs.ErrExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := tree.Get(relPath)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	of := &openFile{fsys: fsys, path: pathStr, flag: flag, fi: fi, patch: p}
+	if flag&os.O_TRUNC != 0 && of.writable() {
+		if err := p.Truncate(0); err != nil {
+			return nil, err
+		}
+	}
+	return of, nil
+}
+
+func createEmpty(tree base.Tree, relPath base.Path, perm fs.FileMode) error {
+	fi := base.NewFSFileInfo(path.Base(relPath.String()), 0, perm.Perm(), base.Timestamp(), nil)
+	f, err := base.NewFileWithInfo(fi, strings.NewReader(""))
+	if err != nil {
+		return err
+	}
+	_, err = tree.Add(relPath, f)
+	return err
+}
+
+func openPatch(tree base.Tree, relPath base.Path) (*chunkpatch.File, error) {
+	switch t := tree.(type) {
+	case *public.Tree:
+		return t.OpenPatch(relPath)
+	case *private.Root:
+		return t.OpenPatch(relPath)
+	default:
+		return nil, fmt.Errorf("cannot open %q for writing", relPath)
+	}
+}
+
+// openFile implements File
+type openFile struct {
+	fsys *fileSystem
+	path string
+	flag int
+	fi   fs.FileInfo
+
+	lk     sync.Mutex
+	patch  *chunkpatch.File
+	offset int64
+	closed bool
+}
+
+var _ File = (*openFile)(nil)
+
+func (f *openFile) readable() bool { return f.flag&os.O_WRONLY == 0 }
+func (f *openFile) writable() bool { return f.flag&(os.O_WRONLY|os.O_RDWR) != 0 }
+
+func (f *openFile) check(write bool) error {
+	if f.closed {
+		return ErrFileClosed
+	}
+	if write && !f.writable() {
+		return fmt.Errorf("%q is not open for writing", f.path)
+	}
+	if !write && !f.readable() {
+		return fmt.Errorf("%q is not open for reading", f.path)
+	}
+	return nil
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return sizedFileInfo{FileInfo: f.fi, size: f.patch.Size()}, nil
+}
+
+func (f *openFile) Read(p []byte) (int, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if err := f.check(false); err != nil {
+		return 0, err
+	}
+	n, err := f.patch.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *openFile) ReadAt(p []byte, off int64) (int, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if err := f.check(false); err != nil {
+		return 0, err
+	}
+	return f.patch.ReadAt(p, off)
+}
+
+func (f *openFile) Write(p []byte) (int, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if err := f.check(true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = f.patch.Size()
+	}
+	n, err := f.patch.WriteAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *openFile) WriteAt(p []byte, off int64) (int, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if err := f.check(true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		return 0, errors.New("invalid use of WriteAt on file opened with O_APPEND")
+	}
+	return f.patch.WriteAt(p, off)
+}
+
+func (f *openFile) Seek(offset int64, whence int) (int64, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.patch.Size()
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *openFile) Truncate(size int64) error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if err := f.check(true); err != nil {
+		return err
+	}
+	return f.patch.Truncate(size)
+}
+
+func (f *openFile) Sync() error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.closed {
+		return ErrFileClosed
+	}
+	return f.sync()
+}
+
+func (f *openFile) sync() error {
+	if !f.patch.Dirty() {
+		return nil
+	}
+
+	f.fsys.lk.Lock()
+	defer f.fsys.lk.Unlock()
+	log.Debugw("openFile.Sync", "path", f.path, "size", f.patch.Size())
+	tree, relPath, err := f.fsys.fsHierarchyDirectoryNode(f.path)
+	if err != nil {
+		return err
+	}
+
+	switch t := tree.(type) {
+	case *public.Tree:
+		_, err = t.ApplyPatch(relPath, f.patch)
+	case *private.Root:
+		_, err = t.ApplyPatch(relPath, f.patch)
+	default:
+		err = fmt.Errorf("cannot write %q", f.path)
+	}
+	return err
+}
+
+// Close syncs pending changes & closes the file. The file is closed even if
+// syncing fails
+func (f *openFile) Close() error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if f.closed {
+		return ErrFileClosed
+	}
+	f.closed = true
+	return f.sync()
+}
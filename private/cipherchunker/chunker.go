@@ -1,33 +1,48 @@
 package cipherchunker
 
 import (
-	"crypto/cipher"
-	"crypto/rand"
+	"errors"
 	"io"
+	"math"
 
+	ciphersuite "github.com/functionland/wnfs-go/private/ciphersuite"
 	chunker "github.com/ipfs/go-ipfs-chunker"
 	pool "github.com/libp2p/go-buffer-pool"
 )
 
+// ContentNonceContext is the nonce context of file content chunks. Chunks are
+// sealed with their index as the nonce counter
+var ContentNonceContext = []byte("content")
+
+// ErrTooManyChunks is returned when content would be split into more chunks
+// than a key can seal with distinct nonce counters
+var ErrTooManyChunks = errors.New("content is too large to encrypt with a single key")
+
 type cipherSplitter struct {
-	cipher        cipher.AEAD
+	sealer        *ciphersuite.Sealer
 	r             io.Reader
 	size          uint32
 	plaintextSize int
-	nonceSize     int
+	index         uint64
 	err           error
 }
 
 var _ chunker.Splitter = (*cipherSplitter)(nil)
 
-// NewSizeSplitter returns a new size-based Splitter with the given block size.
-func NewCipherSplitter(r io.Reader, auth cipher.AEAD, size uint32) (chunker.Splitter, error) {
+// NewCipherSplitter returns a size-based Splitter that encrypts each chunk
+// with the AEAD of suite. size is the length of each encrypted chunk,
+// excluding the nonce. Nonces are derived from the index & plaintext of each
+// chunk, so key must be unique to the content being split
+func NewCipherSplitter(r io.Reader, suite ciphersuite.Suite, key []byte, size uint32) (chunker.Splitter, error) {
+	sealer, err := suite.NewSealer(key, ContentNonceContext)
+	if err != nil {
+		return nil, err
+	}
 	return &cipherSplitter{
-		cipher:        auth,
+		sealer:        sealer,
 		r:             r,
-		size:          size + uint32(auth.NonceSize()),
-		plaintextSize: int(size) - auth.Overhead(),
-		nonceSize:     auth.NonceSize(),
+		size:          size + uint32(sealer.NonceSize()),
+		plaintextSize: int(size) - sealer.Overhead(),
 	}, nil
 }
 
@@ -56,14 +71,13 @@ func (cs *cipherSplitter) NextBytes() ([]byte, error) {
 }
 
 func (cs *cipherSplitter) encryptBlock(plaintext []byte) ([]byte, error) {
-	ciphertext := pool.Get(int(cs.size))
-	if _, err := rand.Read(ciphertext[:cs.nonceSize]); err != nil {
-		pool.Put(ciphertext)
-		return nil, err
+	if cs.index > math.MaxUint32 {
+		return nil, ErrTooManyChunks
 	}
-
-	encrypted := cs.cipher.Seal(ciphertext[cs.nonceSize:cs.nonceSize], ciphertext[:cs.nonceSize], plaintext, nil)
-	return ciphertext[:cs.nonceSize+len(encrypted)], nil
+	ciphertext := pool.Get(int(cs.size))
+	ciphertext = cs.sealer.Seal(ciphertext[:0], uint32(cs.index), plaintext, nil)
+	cs.index++
+	return ciphertext, nil
 }
 
 // Reader returns the io.Reader associated to this Splitter.
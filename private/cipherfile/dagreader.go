@@ -7,6 +7,7 @@ import (
 	"errors"
 	"io"
 
+	ciphersuite "github.com/functionland/wnfs-go/private/ciphersuite"
 	ipld "github.com/ipfs/go-ipld-format"
 	mdag "github.com/ipfs/go-merkledag"
 	unixfs "github.com/ipfs/go-unixfs"
@@ -39,13 +40,24 @@ type ReadSeekCloser interface {
 }
 
 // NewDagReader creates a new reader object that reads the data represented by
-// the given node, using the passed in DAGService for data retrieval.
-func NewDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, auth cipher.AEAD) (DagReader, error) {
+// the given node, using the passed in DAGService for data retrieval. Leaves
+// are decrypted with the AEAD of suite. chunkSize is the size the file was
+// split into by cipherchunker.NewCipherSplitter
+func NewDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, suite ciphersuite.Suite, key []byte, chunkSize uint32) (DagReader, error) {
+	auth, err := suite.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return newDagReader(ctx, n, serv, auth, chunkSize)
+}
+
+func newDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, auth cipher.AEAD, chunkSize uint32) (DagReader, error) {
 	var size uint64
+	leafSize := uint64(chunkSize) + uint64(auth.NonceSize())
 
 	switch n := n.(type) {
 	case *mdag.RawNode:
-		size = uint64(len(n.RawData()))
+		size = plaintextSize(uint64(len(n.RawData())), leafSize, auth)
 
 	case *mdag.ProtoNode:
 		fsNode, err := unixfs.FSNodeFromBytes(n.Data())
@@ -55,7 +67,7 @@ func NewDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, auth c
 
 		switch fsNode.Type() {
 		case unixfs.TFile, unixfs.TRaw:
-			size = fsNode.FileSize()
+			size = plaintextSize(fsNode.FileSize(), leafSize, auth)
 
 		case unixfs.TDirectory, unixfs.THAMTShard:
 			// Dont allow reading directories
@@ -74,7 +86,7 @@ func NewDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, auth c
 			if !ok {
 				return nil, mdag.ErrNotProtobuf
 			}
-			return NewDagReader(ctx, childpb, serv, auth)
+			return newDagReader(ctx, childpb, serv, auth, chunkSize)
 		case unixfs.TSymlink:
 			return nil, ErrCantReadSymlinks
 		default:
@@ -88,6 +100,7 @@ func NewDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, auth c
 
 	return &dagReader{
 		cipher:    auth,
+		leafSize:  leafSize,
 		ctx:       ctxWithCancel,
 		cancel:    cancel,
 		serv:      serv,
@@ -101,6 +114,8 @@ func NewDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGetter, auth c
 type dagReader struct {
 	// decryption cipher
 	cipher cipher.AEAD
+	// size of a full encrypted leaf, including the nonce
+	leafSize uint64
 
 	// Structure to perform the DAG iteration and search, the reader
 	// just needs to add logic to the `Visitor` callback passed to
@@ -134,11 +149,25 @@ type dagReader struct {
 	serv ipld.NodeGetter
 }
 
-// Size returns the total size of the data from the DAG structured file.
+// Size returns the total size of the decrypted data from the DAG structured
+// file.
 func (dr *dagReader) Size() uint64 {
 	return dr.size
 }
 
+// plaintextSize converts the size of encrypted data recorded in the DAG to the
+// size of the plaintext it holds. Every leaf but the last is leafSize bytes,
+// and each leaf adds a nonce & authentication tag to its plaintext. Empty
+// files are stored as a single unencrypted empty leaf
+func plaintextSize(ciphertextSize, leafSize uint64, auth cipher.AEAD) uint64 {
+	leaves := (ciphertextSize + leafSize - 1) / leafSize
+	overhead := leaves * uint64(auth.NonceSize()+auth.Overhead())
+	if overhead > ciphertextSize {
+		return 0
+	}
+	return ciphertextSize - overhead
+}
+
 // Read implements the `io.Reader` interface through the `CtxReadFull`
 // method using the DAG reader's internal context.
 func (dr *dagReader) Read(b []byte) (int, error) {
@@ -219,6 +248,14 @@ func (dr *dagReader) saveNodeData(node ipld.Node) error {
 	if err != nil {
 		return err
 	}
+	if len(ciphertext) == 0 {
+		// empty files are stored as a single unencrypted empty leaf
+		dr.currentNodeData = bytes.NewReader(nil)
+		return nil
+	}
+	if len(ciphertext) < dr.cipher.NonceSize() {
+		return errors.New("encrypted leaf is too short")
+	}
 
 	plaintext := pool.Get(len(ciphertext))
 	plaintext, err = dr.cipher.Open(plaintext[:0], ciphertext[:dr.cipher.NonceSize()], ciphertext[dr.cipher.NonceSize():], nil)
@@ -411,7 +448,7 @@ func (dr *dagReader) Seek(offset int64, whence int) (int64, error) {
 				// `dagWalker`) to find where we need to go down to next in
 				// the search.
 				for {
-					childSize := fsNode.BlockSize(int(dr.dagWalker.ActiveChildIndex()))
+					childSize := plaintextSize(fsNode.BlockSize(int(dr.dagWalker.ActiveChildIndex())), dr.leafSize, dr.cipher)
 
 					if childSize > uint64(left) {
 						// This child's data contains the position requested
@@ -2,9 +2,9 @@ package cipherfile
 
 import (
 	"context"
-	"crypto/cipher"
 	"fmt"
 
+	ciphersuite "github.com/functionland/wnfs-go/private/ciphersuite"
 	files "github.com/ipfs/go-ipfs-files"
 	ipld "github.com/ipfs/go-ipld-format"
 	dag "github.com/ipfs/go-merkledag"
@@ -12,13 +12,15 @@ import (
 )
 
 type cipherFile struct {
-	cipher cipher.AEAD
 	DagReader
 }
 
 var _ files.File = (*cipherFile)(nil)
 
-func NewCipherFile(ctx context.Context, dserv ipld.DAGService, nd ipld.Node, auth cipher.AEAD) (files.Node, error) {
+// NewCipherFile opens an encrypted file DAG for reading, decrypting with the
+// AEAD of suite. chunkSize is the size the file was split into by
+// cipherchunker.NewCipherSplitter
+func NewCipherFile(ctx context.Context, dserv ipld.DAGService, nd ipld.Node, suite ciphersuite.Suite, key []byte, chunkSize uint32) (files.Node, error) {
 	switch dn := nd.(type) {
 	case *dag.ProtoNode:
 		fsn, err := unixfs.FSNodeFromBytes(dn.Data())
@@ -38,15 +40,12 @@ func NewCipherFile(ctx context.Context, dserv ipld.DAGService, nd ipld.Node, aut
 		return nil, fmt.Errorf("unknown node type: %T", nd)
 	}
 
-	dr, err := NewDagReader(ctx, nd, dserv, auth)
+	dr, err := NewDagReader(ctx, nd, dserv, suite, key, chunkSize)
 	if err != nil {
 		return nil, err
 	}
 
-	return &cipherFile{
-		cipher:    auth,
-		DagReader: dr,
-	}, nil
+	return &cipherFile{DagReader: dr}, nil
 }
 
 func (f *cipherFile) Size() (int64, error) {
@@ -0,0 +1,81 @@
+// Package ciphersuite identifies the AEAD ciphers private data is encrypted
+// with. Suite identifiers are only ever stored encrypted, keeping the choice
+// of cipher secret from anyone without a key
+package ciphersuite
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Suite identifies an AEAD cipher
+type Suite uint8
+
+const (
+	// AESGCM is AES-256 in Galois/Counter Mode, the suite used for all data
+	// written before suites were recorded. AES benefits from hardware
+	// acceleration on most desktop & server CPUs
+	AESGCM Suite = iota
+	// ChaCha20Poly1305 is the RFC 8439 construction with 96-bit nonces. It's
+	// faster than AES-GCM in pure software, typically on ARM & mobile devices
+	ChaCha20Poly1305
+	// XChaCha20Poly1305 is ChaCha20Poly1305 with extended 192-bit nonces,
+	// which makes collisions of random nonces negligible
+	XChaCha20Poly1305
+)
+
+// Default is the suite new data is encrypted with when no suite is configured
+const Default = AESGCM
+
+// Suites lists all supported suites
+var Suites = []Suite{AESGCM, ChaCha20Poly1305, XChaCha20Poly1305}
+
+var names = map[Suite]string{
+	AESGCM:            "aes-gcm",
+	ChaCha20Poly1305:  "chacha20-poly1305",
+	XChaCha20Poly1305: "xchacha20-poly1305",
+}
+
+// Parse reads a suite from its name
+func Parse(name string) (Suite, error) {
+	for s, n := range names {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown cipher suite %q", name)
+}
+
+func (s Suite) String() string {
+	if n, ok := names[s]; ok {
+		return n
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(s))
+}
+
+// Valid reports whether s is a supported suite
+func (s Suite) Valid() bool {
+	_, ok := names[s]
+	return ok
+}
+
+// New creates an AEAD cipher for s from a 32 byte key
+func (s Suite) New(key []byte) (cipher.AEAD, error) {
+	switch s {
+	case AESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case ChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	case XChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, fmt.Errorf("unknown cipher suite %d", uint8(s))
+	}
+}
@@ -0,0 +1,101 @@
+package ciphersuite
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+)
+
+// nonceCounterSize is the number of trailing nonce bytes holding the message
+// counter
+const nonceCounterSize = 4
+
+// nonceKeyLabel separates the key nonces are derived with from the
+// encryption key
+var nonceKeyLabel = []byte("wnfs nonce key")
+
+// Sealer encrypts messages with nonces derived from their position & content
+// instead of a random number generator. Each nonce ends with a big-endian 32
+// bit counter the caller assigns to a message, like the index of a chunk. The
+// remaining bytes are a synthetic prefix: an HMAC-SHA256 of the sealer's
+// context, the counter, the associated data & the plaintext, keyed with a
+// nonce key derived from the encryption key.
+//
+// Messages with different counters never share a nonce, so up to 2^32
+// messages can be sealed with a key without relying on the odds of random
+// nonces colliding. Messages sharing a key, context & counter, like revisions
+// written by diverged replicas from the same ratchet position, only share a
+// nonce when their plaintexts are equal, in which case their ciphertexts are
+// equal too & nothing leaks beyond that equality.
+//
+// Sealer is not safe for concurrent use
+type Sealer struct {
+	aead    cipher.AEAD
+	mac     hash.Hash
+	context []byte
+}
+
+// NewSealer creates a Sealer for s from a 32 byte key. context separates the
+// nonces of messages sealed with the same key at different revisions or for
+// different purposes
+func (s Suite) NewSealer(key, context []byte) (*Sealer, error) {
+	aead, err := s.New(key)
+	if err != nil {
+		return nil, err
+	}
+	kdf := hmac.New(sha256.New, key)
+	kdf.Write(nonceKeyLabel)
+	return &Sealer{
+		aead:    aead,
+		mac:     hmac.New(sha256.New, kdf.Sum(nil)),
+		context: context,
+	}, nil
+}
+
+// AEAD returns the cipher messages are sealed with. Sealed messages are opened
+// with the cipher directly, reading the nonce from the start of the message
+func (s *Sealer) AEAD() cipher.AEAD { return s.aead }
+
+// NonceSize is the length of the nonce prepended to each sealed message
+func (s *Sealer) NonceSize() int { return s.aead.NonceSize() }
+
+// Overhead is the length of the authentication tag added to each message
+func (s *Sealer) Overhead() int { return s.aead.Overhead() }
+
+// Nonce derives the nonce of the message at counter
+func (s *Sealer) Nonce(counter uint32, plaintext, additionalData []byte) []byte {
+	return s.nonce(make([]byte, s.aead.NonceSize()), counter, plaintext, additionalData)
+}
+
+// Seal encrypts & authenticates plaintext as the message at counter,
+// authenticating additionalData without encrypting it. The nonce & ciphertext
+// are appended to dst
+func (s *Sealer) Seal(dst []byte, counter uint32, plaintext, additionalData []byte) []byte {
+	n := len(dst)
+	dst = append(dst, make([]byte, s.aead.NonceSize())...)
+	nonce := s.nonce(dst[n:], counter, plaintext, additionalData)
+	return s.aead.Seal(dst, nonce, plaintext, additionalData)
+}
+
+func (s *Sealer) nonce(nonce []byte, counter uint32, plaintext, additionalData []byte) []byte {
+	var buf [4]byte
+	s.mac.Reset()
+	binary.BigEndian.PutUint32(buf[:], uint32(len(s.context)))
+	s.mac.Write(buf[:])
+	s.mac.Write(s.context)
+	binary.BigEndian.PutUint32(buf[:], counter)
+	s.mac.Write(buf[:])
+	// associated data is part of the nonce, as sealing a plaintext twice
+	// under one nonce with different associated data breaks authentication
+	binary.BigEndian.PutUint32(buf[:], uint32(len(additionalData)))
+	s.mac.Write(buf[:])
+	s.mac.Write(additionalData)
+	s.mac.Write(plaintext)
+
+	prefix := len(nonce) - nonceCounterSize
+	copy(nonce[:prefix], s.mac.Sum(nil))
+	binary.BigEndian.PutUint32(nonce[prefix:], counter)
+	return nonce
+}
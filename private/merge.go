@@ -31,6 +31,13 @@ func Merge(ctx context.Context, aNode, bNode base.Node) (result base.MergeResult
 	if err != nil {
 		return result, err
 	}
+	bName, err := b.PrivateName()
+	if err != nil {
+		return result, err
+	}
+	if err = copyNodeBlocks(ctx, srcStore, dstStore, bName, b.Ratchet().Key()); err != nil {
+		return result, fmt.Errorf("copying blocks of %s: %w", bName, err)
+	}
 
 	log.Debugw("Merge", "a", a.Cid(), "b", b.Cid())
 	result, err = merge(ctx, dstStore, a, b)
@@ -282,6 +289,13 @@ func mergeDivergedRoot(ctx context.Context, destfs Store, a *Root, b privateNode
 
 func mergeDivergedTrees(ctx context.Context, destfs Store, a, b *Tree) (res *Tree, err error) {
 	log.Debugw("mergeDivergedTrees", "a.name", a.name, "a", a.cid, "b", b.cid)
+	// links of loaded trees are read lazily
+	if err := a.ensureLinks(ctx); err != nil {
+		return nil, err
+	}
+	if err := b.ensureLinks(ctx); err != nil {
+		return nil, err
+	}
 	checked := map[string]struct{}{}
 
 	for remName, remInfo := range b.links {
@@ -302,11 +316,11 @@ func mergeDivergedTrees(ctx context.Context, destfs Store, a, b *Tree) (res *Tre
 		}
 
 		// node exists in both trees & CIDs are inequal. merge recursively
-		lcl, err := LoadNode(ctx, a.store, localInfo.Name, localInfo.Cid, localInfo.Key)
+		lcl, err := LoadNode(ctx, a.store, localInfo.Name, localInfo.Cid, localInfo.Key, localInfo.Pointer)
 		if err != nil {
 			return res, err
 		}
-		rem, err := LoadNode(ctx, b.store, remInfo.Name, remInfo.Cid, remInfo.Key)
+		rem, err := LoadNode(ctx, b.store, remInfo.Name, remInfo.Cid, remInfo.Key, remInfo.Pointer)
 		if err != nil {
 			return res, err
 		}
@@ -347,7 +361,7 @@ func mergeDivergedTrees(ctx context.Context, destfs Store, a, b *Tree) (res *Tre
 		}
 	}
 
-	a.header.Info.Mtime = base.Timestamp().Unix()
+	a.header.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
 
 	merged := &Tree{
 		store:   destfs,
@@ -401,6 +415,16 @@ func mergeDivergedNode(ctx context.Context, destfs Store, a, b privateNode) (res
 		}
 		_, err = merged.Put()
 		return merged, err
+	case *Symlink:
+		merged := &Symlink{
+			store:   destfs,
+			ratchet: t.ratchet,
+			header:  t.header,
+			name:    t.name,
+			cid:     t.cid,
+		}
+		_, err = merged.Put()
+		return merged, err
 	default:
 		return nil, fmt.Errorf("unexpected node type for private merge: %T", a)
 	}
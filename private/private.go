@@ -12,6 +12,7 @@ import (
 	"io/fs"
 	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 
 	cbor "github.com/fxamacker/cbor/v2"
@@ -21,6 +22,8 @@ import (
 	golog "github.com/ipfs/go-log"
 	multihash "github.com/multiformats/go-multihash"
 	base "github.com/functionland/wnfs-go/base"
+	chunkpatch "github.com/functionland/wnfs-go/chunkpatch"
+	ciphersuite "github.com/functionland/wnfs-go/private/ciphersuite"
 	ratchet "github.com/functionland/wnfs-go/private/ratchet"
 	public "github.com/functionland/wnfs-go/public"
 )
@@ -102,7 +105,7 @@ func LoadRoot(ctx context.Context, store Store, name string, rootKey Key, rootNa
 		return nil, fmt.Errorf("reading CID bytes: %w", err)
 	}
 
-	tree, err := LoadTree(store, name, rootKey, privateRoot)
+	tree, err := LoadTree(store, name, rootKey, privateRoot, rootName)
 	if err != nil {
 		return nil, err
 	}
@@ -112,6 +115,24 @@ func LoadRoot(ctx context.Context, store Store, name string, rootKey Key, rootNa
 	}, nil
 }
 
+// LoadLatestRoot opens the most recent revision of the private root in store
+// that follows the revision named by rootName. Holders of a revision's key can
+// find later revisions written by others by ratcheting forward
+func LoadLatestRoot(ctx context.Context, store Store, name string, rootKey Key, rootName Name) (*Root, error) {
+	root, err := LoadRoot(ctx, store, name, rootKey, rootName)
+	if err != nil {
+		return nil, err
+	}
+	if err := fastForwardRatchet(ctx, store, root.Tree); err != nil {
+		return nil, err
+	}
+	pn, err := root.PrivateName()
+	if err != nil {
+		return nil, err
+	}
+	return LoadRoot(ctx, store, name, root.Key(), pn)
+}
+
 func (r *Root) Context() context.Context { return r.ctx }
 func (r *Root) Cid() cid.Cid {
 	if r.store.HAMT() == nil {
@@ -165,6 +186,46 @@ func (r *Root) Mkdir(path base.Path) (res base.PutResult, err error) {
 	return res, r.putRoot()
 }
 
+func (r *Root) Mv(from, to base.Path) (res base.PutResult, err error) {
+	res, err = r.Tree.Mv(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return res, r.putRoot()
+}
+
+func (r *Root) Restore(path base.Path, id cid.Cid, key Key, pn Name) (res base.PutResult, err error) {
+	res, err = r.Tree.Restore(path, id, key, pn)
+	if err != nil {
+		return nil, err
+	}
+	return res, r.putRoot()
+}
+
+func (r *Root) Chmod(path base.Path, mode fs.FileMode) (res base.PutResult, err error) {
+	res, err = r.Tree.Chmod(path, mode)
+	if err != nil {
+		return nil, err
+	}
+	return res, r.putRoot()
+}
+
+func (r *Root) Chtimes(path base.Path, mtime time.Time) (res base.PutResult, err error) {
+	res, err = r.Tree.Chtimes(path, mtime)
+	if err != nil {
+		return nil, err
+	}
+	return res, r.putRoot()
+}
+
+func (r *Root) ApplyPatch(path base.Path, p *chunkpatch.File) (res base.PutResult, err error) {
+	res, err = r.Tree.ApplyPatch(path, p)
+	if err != nil {
+		return nil, err
+	}
+	return res, r.putRoot()
+}
+
 func (r *Root) Put() (base.PutResult, error) {
 	ctx := context.TODO()
 	log.Debugw("Root.Put", "name", r.name, "hamtCID", r.store.HAMT().CID(), "key", Key(r.ratchet.Key()).Encode())
@@ -183,6 +244,10 @@ func (r *Root) Put() (base.PutResult, error) {
 
 func (r *Root) putRoot() error {
 	ctx := context.TODO()
+	if r.dirty {
+		// deferred changes are written with the tree by the next Put
+		return nil
+	}
 	if r.store.HAMT() != nil {
 		if err := r.store.HAMT().Write(ctx); err != nil {
 			return err
@@ -205,6 +270,14 @@ type Tree struct {
 	ratchet  *ratchet.Spiral
 	metadata *LDFile
 	links    PrivateLinks
+	// lk guards lazy loading of links & metadata by concurrent readers
+	lk sync.Mutex
+
+	// deferred trees mark themselves dirty on change instead of writing.
+	// modified child trees are kept in children & written bottom-up by Put
+	deferred bool
+	dirty    bool
+	children map[string]*Tree
 }
 
 var (
@@ -233,11 +306,12 @@ func NewEmptyTree(store Store, parent BareNamefilter, name string) (*Tree, error
 	}, nil
 }
 
-func LoadTree(store Store, name string, key Key, id cid.Cid) (*Tree, error) {
+// LoadTree loads the tree with header id, stored at private name pn
+func LoadTree(store Store, name string, key Key, id cid.Cid, pn Name) (*Tree, error) {
 	log.Debugw("LoadTree", "name", name, "cid", id)
 	ctx := context.TODO()
 
-	header, err := loadHeader(ctx, store, key, id)
+	header, err := loadNodeHeader(ctx, store, key, id, pn)
 	if err != nil {
 		return nil, err
 	}
@@ -262,13 +336,14 @@ func LoadTreeFromName(ctx context.Context, fs Store, key Key, name string, pn Na
 	if err != nil {
 		return nil, err
 	}
-	return LoadTree(fs, name, key, id)
+	return LoadTree(fs, name, key, id, pn)
 }
 
 func (pt *Tree) Name() string                   { return pt.name }
 func (pt *Tree) Size() int64                    { return pt.header.Info.Size }
-func (pt *Tree) ModTime() time.Time             { return time.Unix(pt.header.Info.Mtime, 0) }
-func (pt *Tree) Mode() fs.FileMode              { return fs.FileMode(pt.header.Info.Ctime) }
+func (pt *Tree) ModTime() time.Time             { return base.DecodeTimestamp(pt.header.Info.Mtime) }
+func (pt *Tree) Ctime() time.Time               { return base.DecodeTimestamp(pt.header.Info.Ctime) }
+func (pt *Tree) Mode() fs.FileMode              { return fs.ModeDir | base.DecodeMode(pt.header.Info.Mode) }
 func (pt *Tree) Type() base.NodeType            { return pt.header.Info.Type }
 func (pt *Tree) IsDir() bool                    { return true }
 func (pt *Tree) Sys() interface{}               { return pt.store }
@@ -292,28 +367,36 @@ func (pt *Tree) AsHistoryEntry() base.HistoryEntry {
 
 func (pt *Tree) SetMetadata(md interface{}) (err error) {
 	log.Debugw("setting tree metadata", "name", pt.name)
-	pt.metadata, err = newLDFileRatchet(pt.store, "", md, pt.BareNamefilter(), pt.ratchet)
+	pt.metadata, err = newMetadataLDFile(pt.store, "", md, pt.BareNamefilter(), pt.ratchet)
 	return err
 }
 
 func (pt *Tree) Metadata() (f base.LDFile, err error) {
+	pt.lk.Lock()
+	defer pt.lk.Unlock()
 	if pt.metadata == nil {
 		if !pt.header.Metadata.Defined() {
 			return nil, base.ErrNoLink
 		}
-		pt.metadata, err = LoadLDFile(pt.store.Context(), pt.store, base.MetadataLinkName, pt.header.Metadata, pt.Key())
+		var pn Name
+		if pn, err = pt.PrivateName(); err != nil {
+			return nil, err
+		}
+		pt.metadata, err = LoadLDFile(pt.store.Context(), pt.store, base.MetadataLinkName, pt.header.Metadata, pt.Key(), pn)
 	}
 	return pt.metadata, err
 }
 
 func (pt *Tree) ensureLinks(ctx context.Context) error {
+	pt.lk.Lock()
+	defer pt.lk.Unlock()
 	if pt.links == nil {
 		blk, err := pt.store.Blockservice().GetBlock(ctx, pt.header.ContentID)
 		if err != nil {
 			return err
 		}
 
-		pt.links, err = unmarshalPrivateLinksBlock(blk, pt.Key())
+		pt.links, err = unmarshalPrivateLinksBlock(blk, pt.header, pt.Key())
 		return err
 	}
 	return nil
@@ -333,22 +416,29 @@ func (pt *Tree) Read(p []byte) (n int, err error) {
 }
 func (pt *Tree) Close() error { return nil }
 
+// ReadDir lists the first n entries of pt sorted by name, or all entries if
+// n <= 0. Trees are shared between opens & don't track a read position.
+// Entry info is loaded on demand & doesn't follow symlinks
 func (pt *Tree) ReadDir(n int) ([]fs.DirEntry, error) {
 	if err := pt.ensureLinks(context.TODO()); err != nil {
 		return nil, err
 	}
 
-	if n < 0 {
-		n = len(pt.links)
+	links := pt.links.SortedSlice()
+	if n <= 0 || n > len(links) {
+		n = len(links)
 	}
 
 	entries := make([]fs.DirEntry, 0, n)
-	for i, link := range pt.links.SortedSlice() {
-		entries = append(entries, base.NewFSDirEntry(link.Name, link.IsFile))
-
-		if i == n {
-			break
-		}
+	for _, link := range links[:n] {
+		name := link.Name
+		entries = append(entries, base.NewFSDirEntryStat(name, link.IsFile, func() (fs.FileInfo, error) {
+			f, err := pt.get(base.Path{name}, false)
+			if err != nil {
+				return nil, err
+			}
+			return f.Stat()
+		}))
 	}
 	return entries, nil
 }
@@ -387,8 +477,9 @@ func (pt *Tree) Add(path base.Path, f fs.File) (res base.PutResult, err error) {
 	}
 
 	pt.updateUserlandLink(head, res)
-	// contents of tree have changed, write an update.
-	return pt.Put()
+	// contents of tree have changed, write an update. deferred trees batch
+	// updates until the next Put
+	return pt.changed()
 }
 
 func (pt *Tree) Copy(path base.Path, srcPathStr string, srcFS fs.FS) (res base.PutResult, err error) {
@@ -422,36 +513,98 @@ func (pt *Tree) Copy(path base.Path, srcPathStr string, srcFS fs.FS) (res base.P
 	}
 
 	pt.updateUserlandLink(head, res)
-	// contents of tree have changed, write an update.
-	return pt.Put()
+	// contents of tree have changed, write an update. deferred trees batch
+	// updates until the next Put
+	return pt.changed()
 }
 
+// Get opens the node at path, following any symlinks encountered along the
+// way. Absolute symlink targets resolve relative to pt
 func (pt *Tree) Get(path base.Path) (fs.File, error) {
-	head, tail := path.Shift()
-	if head == "" {
-		return pt, nil
-	}
-
-	if err := pt.ensureLinks(context.TODO()); err != nil {
-		return nil, err
-	}
+	return pt.get(path, true)
+}
 
-	link := pt.links.Get(head)
-	if link == nil {
-		return nil, base.ErrNotFound
+// Readlink returns the target of the symlink at path
+func (pt *Tree) Readlink(path base.Path) (string, error) {
+	f, err := pt.get(path, false)
+	if err != nil {
+		return "", err
 	}
+	sl, ok := f.(*Symlink)
+	if !ok {
+		return "", fmt.Errorf("%q is not a symlink", path)
+	}
+	return sl.Target(), nil
+}
+
+// get resolves path, following symlinks for all intermediate path components.
+// the final path component is followed only if follow is true
+func (pt *Tree) get(path base.Path, follow bool) (fs.File, error) {
+	var (
+		ctx      = context.TODO()
+		dirs     = []*Tree{pt}
+		seen     = map[string]struct{}{}
+		followed = 0
+		err      error
+	)
+
+	for len(path) > 0 {
+		head, tail := path.Shift()
+		path = tail
+		switch head {
+		case "", ".":
+			continue
+		case "..":
+			if len(dirs) > 1 {
+				dirs = dirs[:len(dirs)-1]
+			}
+			continue
+		}
 
-	if tail != nil {
-		ch, err := LoadTree(pt.store, head, link.Key, link.Cid)
-		if err != nil {
+		dir := dirs[len(dirs)-1]
+		if err := dir.ensureLinks(ctx); err != nil {
+			return nil, err
+		}
+		link := dir.links.Get(head)
+		if link == nil {
+			return nil, base.ErrNotFound
+		}
+		var n privateNode
+		if ch, ok := dir.children[head]; ok {
+			n = ch
+		} else if n, err = LoadNode(ctx, pt.store, head, link.Cid, link.Key, link.Pointer); err != nil {
 			return nil, err
 		}
 
-		// recurse
-		return ch.Get(tail)
+		if sl, ok := n.(*Symlink); ok && (follow || len(path) > 0) {
+			key := sl.Cid().String() + ":" + path.String()
+			if _, ok := seen[key]; ok {
+				return nil, base.ErrSymlinkLoop
+			}
+			seen[key] = struct{}{}
+			if followed++; followed > base.MaxSymlinkDepth {
+				return nil, fmt.Errorf("following more than %d symlinks: %w", base.MaxSymlinkDepth, base.ErrSymlinkLoop)
+			}
+
+			target, abs := base.SymlinkPath(sl.Target())
+			if abs {
+				dirs = dirs[:1]
+			}
+			path = append(target, path...)
+			continue
+		}
+
+		if len(path) == 0 {
+			return n, nil
+		}
+		ch, ok := n.(*Tree)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a directory", head)
+		}
+		dirs = append(dirs, ch)
 	}
 
-	return LoadNode(context.TODO(), pt.store, head, link.Cid, link.Key)
+	return dirs[len(dirs)-1], nil
 }
 
 func (pt *Tree) Rm(path base.Path) (base.PutResult, error) {
@@ -470,7 +623,7 @@ func (pt *Tree) Rm(path base.Path) (base.PutResult, error) {
 		if link == nil {
 			return nil, base.ErrNotFound
 		}
-		child, err := LoadTree(pt.store, link.Name, link.Key, link.Cid)
+		child, err := pt.childTree(*link)
 		if err != nil {
 			return nil, err
 		}
@@ -484,7 +637,416 @@ func (pt *Tree) Rm(path base.Path) (base.PutResult, error) {
 	}
 
 	// contents of tree have changed, write an update.
-	return pt.Put()
+	return pt.changed()
+}
+
+// Mv relinks the node at from to the path to. The moved node itself isn't
+// rewritten, keeping its CID, INumber & ratchet. Only directories along the
+// paths of from and to are updated
+func (pt *Tree) Mv(from, to base.Path) (base.PutResult, error) {
+	fromHead, fromTail := from.Shift()
+	toHead, toTail := to.Shift()
+	if fromHead == "" || toHead == "" {
+		return nil, fmt.Errorf("invalid path: empty")
+	}
+	if err := pt.ensureLinks(context.TODO()); err != nil {
+		return nil, err
+	}
+
+	if fromHead == toHead && fromTail != nil && toTail != nil {
+		// both paths share this child directory, recurse
+		link := pt.links.Get(fromHead)
+		if link == nil {
+			return nil, base.ErrNotFound
+		}
+		child, err := pt.childTree(*link)
+		if err != nil {
+			return nil, err
+		}
+		res, err := child.Mv(fromTail, toTail)
+		if err != nil {
+			return nil, err
+		}
+		pt.updateUserlandLink(fromHead, res)
+		return pt.changed()
+	}
+
+	// detach modifies the tree, check to before anything is removed
+	if err := pt.checkAttach(to); err != nil {
+		return nil, err
+	}
+	link, err := pt.detach(from)
+	if err != nil {
+		return nil, err
+	}
+	if err = pt.attach(to, link); err != nil {
+		return nil, err
+	}
+
+	// contents of tree have changed, write an update.
+	return pt.changed()
+}
+
+// detach removes the link at path, writing updates to all descendant trees
+// along path. pt itself is modified but not written
+func (pt *Tree) detach(path base.Path) (PrivateLink, error) {
+	head, tail := path.Shift()
+	if err := pt.ensureLinks(context.TODO()); err != nil {
+		return PrivateLink{}, err
+	}
+	link := pt.links.Get(head)
+	if link == nil {
+		return PrivateLink{}, base.ErrNotFound
+	}
+
+	if tail == nil {
+		// detached links must point to written nodes
+		if ch, ok := pt.children[head]; ok && ch.dirty {
+			res, err := ch.Put()
+			if err != nil {
+				return PrivateLink{}, err
+			}
+			pt.updateUserlandLink(head, res)
+			link = pt.links.Get(head)
+		}
+		pt.removeUserlandLink(head)
+		return *link, nil
+	}
+
+	child, err := pt.childTree(*link)
+	if err != nil {
+		return PrivateLink{}, err
+	}
+	detached, err := child.detach(tail)
+	if err != nil {
+		return PrivateLink{}, err
+	}
+	res, err := child.changed()
+	if err != nil {
+		return PrivateLink{}, err
+	}
+	pt.updateUserlandLink(head, res)
+	return detached, nil
+}
+
+// checkAttach returns an error if a link can't be attached at path, which is
+// the case when a parent along path exists & isn't a directory
+func (pt *Tree) checkAttach(path base.Path) error {
+	head, tail := path.Shift()
+	if tail == nil {
+		return nil
+	}
+	if err := pt.ensureLinks(context.TODO()); err != nil {
+		return err
+	}
+	link := pt.links.Get(head)
+	if link == nil {
+		// missing directories are created
+		return nil
+	}
+	if link.IsFile {
+		return fmt.Errorf("%q is not a directory", head)
+	}
+	child, err := pt.childTree(*link)
+	if err != nil {
+		return err
+	}
+	return child.checkAttach(tail)
+}
+
+// attach adds a detached link at path, creating any missing directories.
+// attach writes updates to all descendant trees along path. pt itself is
+// modified but not written
+func (pt *Tree) attach(path base.Path, link PrivateLink) error {
+	head, tail := path.Shift()
+	if tail == nil {
+		if err := pt.ensureLinks(context.TODO()); err != nil {
+			return err
+		}
+		link.Name = head
+		pt.links.Add(link)
+		pt.header.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+		return nil
+	}
+
+	child, err := pt.getOrCreateDirectChildTree(head)
+	if err != nil {
+		return err
+	}
+	if err = child.attach(tail, link); err != nil {
+		return err
+	}
+	res, err := child.changed()
+	if err != nil {
+		return err
+	}
+	pt.updateUserlandLink(head, res)
+	return nil
+}
+
+// Restore writes the historical revision of a node stored at id & private name
+// pn, encrypted with key, to path as a new revision, creating any missing
+// directories. The node's ratchet is advanced past the latest revision written
+// to the HAMT, so the restored revision extends the node's existing history.
+// The new revision's previous link points to the restored revision. If a
+// different node exists at path it's recorded as the merge link, so no history
+// is lost
+func (pt *Tree) Restore(path base.Path, id cid.Cid, key Key, pn Name) (base.PutResult, error) {
+	ctx := context.TODO()
+	head, tail := path.Shift()
+	if head == "" {
+		return nil, fmt.Errorf("invalid path: empty")
+	}
+
+	if tail != nil {
+		child, err := pt.getOrCreateDirectChildTree(head)
+		if err != nil {
+			return nil, err
+		}
+		res, err := child.Restore(tail, id, key, pn)
+		if err != nil {
+			return nil, err
+		}
+		pt.updateUserlandLink(head, res)
+		return pt.changed()
+	}
+
+	if err := pt.ensureLinks(ctx); err != nil {
+		return nil, err
+	}
+	n, err := LoadNode(ctx, pt.store, head, id, key, pn)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		header *Header
+		put    func() (base.PutResult, error)
+	)
+	// contents must be read before advancing the ratchet changes the key
+	switch n := n.(type) {
+	case *File:
+		header, put, err = &n.header, func() (base.PutResult, error) { return n.Put() }, n.ensureContent()
+	case *Tree:
+		header, put, err = &n.header, n.Put, n.ensureLinks(ctx)
+	case *Symlink:
+		header, put = &n.header, func() (base.PutResult, error) { return n.Put() }
+	default:
+		err = fmt.Errorf("cannot restore node of type %T", n)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = fastForwardRatchet(ctx, pt.store, n); err != nil {
+		return nil, err
+	}
+
+	header.Previous = id
+	if link := pt.links.Get(head); link != nil && !link.Cid.Equals(id) {
+		header.Merge = link.Cid
+	}
+	header.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+	res, err := put()
+	// later revisions of n don't link to the restored revision
+	header.Previous, header.Merge = cid.Undef, cid.Undef
+	if err != nil {
+		return nil, err
+	}
+
+	pt.updateUserlandLink(head, res)
+	return pt.changed()
+}
+
+// Chmod sets the permission bits of the node at path. Chmod changes the node
+// itself, symlinks aren't followed. An empty path changes pt
+func (pt *Tree) Chmod(path base.Path, mode fs.FileMode) (base.PutResult, error) {
+	return pt.setInfo(path, func(hi *HeaderInfo) { hi.Mode = base.EncodeMode(mode) })
+}
+
+// Chtimes sets the modification time of the node at path, stored with
+// millisecond precision. Chtimes changes the node itself, symlinks aren't
+// followed. An empty path changes pt
+func (pt *Tree) Chtimes(path base.Path, mtime time.Time) (base.PutResult, error) {
+	return pt.setInfo(path, func(hi *HeaderInfo) { hi.Mtime = base.EncodeTimestamp(mtime) })
+}
+
+// OpenPatch opens the contents of the file at path for random-access editing.
+// Edits are held in memory until written with ApplyPatch
+func (pt *Tree) OpenPatch(path base.Path) (*chunkpatch.File, error) {
+	ctx := context.TODO()
+	if err := pt.ensureLinks(ctx); err != nil {
+		return nil, err
+	}
+	head, tail := path.Shift()
+	if head == "" {
+		return nil, errors.New("invalid path: empty")
+	}
+	link := pt.links.Get(head)
+	if link == nil {
+		return nil, base.ErrNotFound
+	}
+
+	if tail != nil {
+		child, err := pt.childTree(*link)
+		if err != nil {
+			return nil, err
+		}
+		return child.OpenPatch(tail)
+	}
+
+	n, err := LoadNode(ctx, pt.store, head, link.Cid, link.Key, link.Pointer)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := n.(*File)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a file", head)
+	}
+	return f.OpenPatch()
+}
+
+// ApplyPatch writes the edited contents of p to the file at path as a new
+// revision. Only leaves changed by p are encrypted & written, all others are
+// shared with the prior revision. ApplyPatch fails with
+// chunkpatch.ErrBaseChanged if the file has been written since p was opened
+func (pt *Tree) ApplyPatch(path base.Path, p *chunkpatch.File) (res base.PutResult, err error) {
+	ctx := context.TODO()
+	if err := pt.ensureLinks(ctx); err != nil {
+		return nil, err
+	}
+	head, tail := path.Shift()
+	if head == "" {
+		return nil, errors.New("invalid path: empty")
+	}
+	link := pt.links.Get(head)
+	if link == nil {
+		return nil, base.ErrNotFound
+	}
+
+	if tail != nil {
+		child, err := pt.childTree(*link)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = child.ApplyPatch(tail, p); err != nil {
+			return nil, err
+		}
+	} else {
+		n, err := LoadNode(ctx, pt.store, head, link.Cid, link.Key, link.Pointer)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := n.(*File)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a file", head)
+		}
+		if res, err = f.applyPatch(p); err != nil {
+			return nil, err
+		}
+	}
+
+	pt.updateUserlandLink(head, res)
+	return pt.changed()
+}
+
+// setInfo applies update to the header info of the node at path, writing it
+// as a new revision
+func (pt *Tree) setInfo(path base.Path, update func(hi *HeaderInfo)) (base.PutResult, error) {
+	ctx := context.TODO()
+	if err := pt.ensureLinks(ctx); err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		update(&pt.header.Info)
+		return pt.changed()
+	}
+
+	head, tail := path.Shift()
+	link := pt.links.Get(head)
+	if link == nil {
+		return nil, base.ErrNotFound
+	}
+
+	var (
+		res base.PutResult
+		err error
+	)
+	if tail != nil {
+		child, err := pt.childTree(*link)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = child.setInfo(tail, update); err != nil {
+			return nil, err
+		}
+	} else if ch, ok := pt.children[head]; ok {
+		update(&ch.header.Info)
+		if res, err = ch.changed(); err != nil {
+			return nil, err
+		}
+	} else {
+		n, err := LoadNode(ctx, pt.store, head, link.Cid, link.Key, link.Pointer)
+		if err != nil {
+			return nil, err
+		}
+		// contents must be read before advancing the ratchet changes the key
+		switch n := n.(type) {
+		case *Tree:
+			if err = n.ensureLinks(ctx); err != nil {
+				return nil, err
+			}
+			pt.cacheChild(head, n)
+			update(&n.header.Info)
+			res, err = n.changed()
+		case *File:
+			update(&n.header.Info)
+			res, err = n.Put()
+		case *Symlink:
+			update(&n.header.Info)
+			res, err = n.Put()
+		case *LDFile:
+			update(&n.header.Info)
+			res, err = n.Put()
+		default:
+			return nil, fmt.Errorf("cannot change %q, unexpected node type %T", head, n)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// keep the parent's modification time, only the node at path has changed
+	mtime := pt.header.Info.Mtime
+	pt.updateUserlandLink(head, res)
+	pt.header.Info.Mtime = mtime
+	return pt.changed()
+}
+
+// fastForwardRatchet advances the ratchet of n to the latest revision of n
+// written to the HAMT
+func fastForwardRatchet(ctx context.Context, store Store, n privateNode) error {
+	r := n.Ratchet()
+	for {
+		next := r.Copy()
+		next.Inc()
+		knf, err := AddKey(n.BareNamefilter(), Key(next.Key()))
+		if err != nil {
+			return err
+		}
+		pn, err := ToName(knf)
+		if err != nil {
+			return err
+		}
+		exists, _, err := store.HAMT().Root().FindRaw(ctx, string(pn))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return nil
+		}
+		r.Inc()
+	}
 }
 
 func (pt *Tree) Mkdir(path base.Path) (res base.PutResult, err error) {
@@ -499,19 +1061,19 @@ func (pt *Tree) Mkdir(path base.Path) (res base.PutResult, err error) {
 	}
 
 	if tail == nil {
-		res, err = childDir.Put()
+		res, err = childDir.changed()
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		res, err = pt.Mkdir(tail)
+		res, err = childDir.Mkdir(tail)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	pt.updateUserlandLink(head, res)
-	return pt.Put()
+	return pt.changed()
 }
 
 func (pt *Tree) History(ctx context.Context, maxRevs int) ([]base.HistoryEntry, error) {
@@ -550,8 +1112,8 @@ func history(ctx context.Context, n privateNode, maxRevs int) ([]base.HistoryEnt
 
 	log.Debugw("History", "name", st.Name(), "len(ratchets)", len(ratchets), "oldest_ratchet", old.Encode())
 
-	hist := make([]base.HistoryEntry, len(ratchets))
-	for i, rcht := range ratchets {
+	hist := make([]base.HistoryEntry, 0, len(ratchets))
+	for _, rcht := range ratchets {
 		key := Key(rcht.Key())
 		knf, err := AddKey(bnf, key)
 		if err != nil {
@@ -562,17 +1124,20 @@ func history(ctx context.Context, n privateNode, maxRevs int) ([]base.HistoryEnt
 			return nil, err
 		}
 		headerID, err := cidFromPrivateName(ctx, store, pn)
-		if err != nil {
+		if errors.Is(err, base.ErrNotFound) {
+			// ratchets can be recorded before the first revision is written
+			continue
+		} else if err != nil {
 			log.Debugw("getting CID from private name", "err", err)
 			return nil, err
 		}
 
-		header, err := loadHeader(ctx, store, key, headerID)
+		header, err := loadHeader(ctx, store, key, headerID, pn)
 		if err != nil {
 			log.Debugw("loading historical header", "cid", headerID, "err", err)
 		}
 
-		hist[i] = base.HistoryEntry{
+		ent := base.HistoryEntry{
 			Cid:   headerID,
 			Size:  header.Info.Size,
 			Type:  header.Info.Type,
@@ -581,6 +1146,11 @@ func history(ctx context.Context, n privateNode, maxRevs int) ([]base.HistoryEnt
 			Key:         key.Encode(),
 			PrivateName: string(pn),
 		}
+		if header.Previous.Defined() {
+			prev := header.Previous
+			ent.Previous = &prev
+		}
+		hist = append(hist, ent)
 	}
 
 	log.Debugw("found history", "len(hist)", len(hist))
@@ -591,12 +1161,20 @@ func (pt *Tree) getOrCreateDirectChildTree(name string) (*Tree, error) {
 	if err := pt.ensureLinks(context.TODO()); err != nil {
 		return nil, err
 	}
+	if ch, ok := pt.children[name]; ok {
+		return ch, nil
+	}
 	link := pt.links.Get(name)
 	if link == nil {
-		return NewEmptyTree(pt.store, pt.header.Info.BareNamefilter, name)
+		ch, err := NewEmptyTree(pt.store, pt.header.Info.BareNamefilter, name)
+		if err != nil {
+			return nil, err
+		}
+		pt.cacheChild(name, ch)
+		return ch, nil
 	}
 
-	return LoadTree(pt.store, name, link.Key, link.Cid)
+	return pt.childTree(*link)
 }
 
 func (pt *Tree) createOrUpdateChild(srcPathStr, name string, f fs.File, srcFS fs.FS) (base.PutResult, error) {
@@ -619,21 +1197,13 @@ func (pt *Tree) createOrUpdateChildDirectory(srcPathStr, name string, f fs.File,
 	if err != nil {
 		return nil, fmt.Errorf("reading directory contents: %w", err)
 	}
-	if err := pt.ensureLinks(context.TODO()); err != nil {
+	tree, err := pt.getOrCreateDirectChildTree(name)
+	if err != nil {
 		return nil, err
 	}
 
-	var tree *Tree
-	if link := pt.links.Get(name); link != nil {
-		tree, err = LoadTree(pt.store, link.Name, link.Key, link.Cid)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		tree, err = NewEmptyTree(pt.store, pt.header.Info.BareNamefilter, name)
-		if err != nil {
-			return nil, err
-		}
+	if len(ents) == 0 {
+		return tree.changed()
 	}
 
 	var res base.PutResult
@@ -651,7 +1221,7 @@ func (pt *Tree) createOrUpdateChildFile(ctx context.Context, name string, f fs.F
 		return nil, err
 	}
 	if link := pt.links.Get(name); link != nil {
-		prev, err := LoadNode(ctx, pt.store, link.Name, link.Cid, link.Key)
+		prev, err := LoadNode(ctx, pt.store, link.Name, link.Cid, link.Key, link.Pointer)
 		if err != nil {
 			log.Debugw("createOrUpdateChildFile", "err", err)
 			return nil, err
@@ -671,6 +1241,14 @@ func (pt *Tree) createOrUpdateChildFile(ctx context.Context, name string, f fs.F
 		return df.Put()
 	}
 
+	if sl, ok := f.(base.Symlink); ok {
+		ch, err := NewSymlink(pt.store, name, sl.Target(), pt.header.Info.BareNamefilter)
+		if err != nil {
+			return nil, err
+		}
+		return ch.Put()
+	}
+
 	ch, err := NewFile(pt.store, pt.header.Info.BareNamefilter, f)
 	if err != nil {
 		return nil, err
@@ -678,19 +1256,86 @@ func (pt *Tree) createOrUpdateChildFile(ctx context.Context, name string, f fs.F
 	return ch.Put()
 }
 
+// SetDeferred sets whether pt defers writes. Deferred trees record changes in
+// memory & write all modified descendant trees bottom-up on the next call to
+// Put, instead of writing on every change. Child trees inherit the setting
+func (pt *Tree) SetDeferred(deferred bool) { pt.deferred = deferred }
+
+// Dirty returns true if pt has changes that have not been written
+func (pt *Tree) Dirty() bool { return pt.dirty }
+
+// changed records a modification to pt, writing pt unless writes are deferred.
+// deferred trees don't advance their ratchet until written, so pending results
+// carry the current key
+func (pt *Tree) changed() (base.PutResult, error) {
+	if !pt.deferred {
+		return pt.Put()
+	}
+	pt.dirty = true
+	return PutResult{
+		PutResult: public.PutResult{
+			Cid:  pt.cid,
+			Size: pt.links.SizeSum(),
+			Type: pt.header.Info.Type,
+		},
+		Key: pt.ratchet.Key(),
+	}, nil
+}
+
+// childTree loads the child tree link points to, reusing trees with deferred
+// changes
+func (pt *Tree) childTree(link PrivateLink) (*Tree, error) {
+	if ch, ok := pt.children[link.Name]; ok {
+		return ch, nil
+	}
+	ch, err := LoadTree(pt.store, link.Name, link.Key, link.Cid, link.Pointer)
+	if err != nil {
+		return nil, err
+	}
+	pt.cacheChild(link.Name, ch)
+	return ch, nil
+}
+
+func (pt *Tree) cacheChild(name string, ch *Tree) {
+	if !pt.deferred {
+		return
+	}
+	ch.deferred = true
+	if pt.children == nil {
+		pt.children = map[string]*Tree{}
+	}
+	pt.children[name] = ch
+}
+
 func (pt *Tree) Put() (base.PutResult, error) {
 	ctx := context.TODO()
+
+	// write deferred changes to child trees
+	for name, ch := range pt.children {
+		if !ch.dirty {
+			continue
+		}
+		res, err := ch.Put()
+		if err != nil {
+			return nil, err
+		}
+		pt.updateUserlandLink(name, res)
+	}
+
 	pt.ratchet.Inc()
 	log.Debugw("Tree.Put", "name", pt.name, "len(links)", len(pt.links), "newRatchet", pt.ratchet.Summary())
 	key := pt.ratchet.Key()
 	pt.header.Info.Ratchet = pt.ratchet.Encode()
 	pt.header.Info.Size = pt.links.SizeSum()
+	// links are re-encrypted on every write, switching to the store suite
+	pt.header.Info.CipherSuite = pt.store.CipherSuite()
 
-	linksBlk, err := pt.links.marshalEncryptedBlock(key)
+	linksBlk, err := pt.links.marshalEncryptedBlock(pt.header.Info, key)
 	if err != nil {
 		return nil, err
 	}
 	pt.header.ContentID = linksBlk.Cid()
+	pt.header.legacy = false
 
 	if pt.metadata != nil {
 		res, err := pt.metadata.Put()
@@ -701,20 +1346,20 @@ func (pt *Tree) Put() (base.PutResult, error) {
 		pt.header.Metadata = res.Cid
 	}
 
-	blk, err := pt.header.encryptHeaderBlock(key)
+	privName, err := pt.PrivateName()
 	if err != nil {
 		return nil, err
 	}
 
-	if err = pt.store.Blockservice().Blockstore().PutMany(ctx, []blocks.Block{blk, linksBlk}); err != nil {
+	blk, err := pt.header.encryptHeaderBlock(key, privName)
+	if err != nil {
 		return nil, err
 	}
-	pt.cid = blk.Cid()
 
-	privName, err := pt.PrivateName()
-	if err != nil {
+	if err = pt.store.Blockservice().Blockstore().PutMany(ctx, []blocks.Block{blk, linksBlk}); err != nil {
 		return nil, err
 	}
+	pt.cid = blk.Cid()
 
 	if _, err = pt.store.RatchetStore().PutRatchet(ctx, pt.header.Info.INumber.Encode(), pt.ratchet); err != nil {
 		return nil, err
@@ -725,6 +1370,7 @@ func (pt *Tree) Put() (base.PutResult, error) {
 		return nil, err
 	}
 
+	pt.dirty = false
 	log.Debugw("Tree.Put", "name", pt.name, "privateName", string(privName), "cid", pt.cid.String(), "size", pt.header.Info.Size)
 	return PutResult{
 		PutResult: public.PutResult{
@@ -738,13 +1384,18 @@ func (pt *Tree) Put() (base.PutResult, error) {
 }
 
 func (pt *Tree) updateUserlandLink(name string, res base.PutResult) {
+	if ch, ok := pt.children[name]; ok && !ch.cid.Equals(res.CID()) {
+		// child tree has been replaced
+		delete(pt.children, name)
+	}
 	pt.links.Add(res.(PutResult).ToPrivateLink(name))
-	pt.header.Info.Mtime = base.Timestamp().Unix()
+	pt.header.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
 }
 
 func (pt *Tree) removeUserlandLink(name string) {
+	delete(pt.children, name)
 	pt.links.Remove(name)
-	pt.header.Info.Mtime = base.Timestamp().Unix()
+	pt.header.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
 }
 
 type File struct {
@@ -756,6 +1407,7 @@ type File struct {
 	ratchet  *ratchet.Spiral
 	metadata *LDFile
 	content  io.ReadCloser
+	readerAt *base.ReaderAt
 }
 
 var (
@@ -769,14 +1421,15 @@ func NewFile(store Store, parent BareNamefilter, content fs.File) (*File, error)
 	var meta interface{}
 	if mdn, ok := content.(base.Metadata); ok {
 		md, err := mdn.Metadata()
-		if err != nil {
+		if err != nil && !errors.Is(err, base.ErrNoLink) {
 			return nil, err
 		}
-		meta, err = md.Data()
-		if err != nil {
-			return nil, err
+		if err == nil {
+			if meta, err = md.Data(); err != nil {
+				return nil, err
+			}
+			log.Debugw("setting file meta", "meta", meta)
 		}
-		log.Debugw("setting file meta", "meta", meta)
 	}
 
 	return NewFileMetadata(store, parent, content, meta)
@@ -794,25 +1447,27 @@ func NewFileMetadata(store Store, parent BareNamefilter, f fs.File, meta interfa
 	if meta != nil {
 		log.Debugw("creating file metadata", "meta", meta)
 		// need to construct a new file here to keep stores aligned
-		if md, err = newLDFileRatchet(store, base.MetadataLinkName, meta, bnf, r); err != nil {
+		if md, err = newMetadataLDFile(store, base.MetadataLinkName, meta, bnf, r); err != nil {
 			return nil, err
 		}
 	}
 
-	return &File{
+	pf := &File{
 		store:   store,
 		ratchet: r,
 		header: Header{
 			Info: NewHeaderInfo(base.NTFile, in, bnf),
 		},
 		metadata: md,
-		content:  f,
-	}, nil
+	}
+	pf.SetContents(f)
+	return pf, nil
 }
 
-func LoadFile(ctx context.Context, store Store, name string, key Key, id cid.Cid) (*File, error) {
+// LoadFile loads the file with header id, stored at private name pn
+func LoadFile(ctx context.Context, store Store, name string, key Key, id cid.Cid, pn Name) (*File, error) {
 	log.Debugw("LoadFile", "name", name, "cid", id, "key", key.Encode())
-	header, err := loadHeader(ctx, store, key, id)
+	header, err := loadNodeHeader(ctx, store, key, id, pn)
 	if err != nil {
 		log.Debugw("LoadFile", "err", err)
 		return nil, fmt.Errorf("decoding s-node %q header: %w", name, err)
@@ -840,8 +1495,9 @@ func (pf *File) Cid() cid.Cid                   { return pf.cid }
 func (pf *File) Content() cid.Cid               { return pf.header.ContentID }
 func (pf *File) PrivateFS() Store               { return pf.store }
 func (pf *File) IsDir() bool                    { return false }
-func (pf *File) ModTime() time.Time             { return time.Unix(pf.header.Info.Mtime, 0) }
-func (pf *File) Mode() fs.FileMode              { return fs.FileMode(pf.header.Info.Mode) }
+func (pf *File) ModTime() time.Time             { return base.DecodeTimestamp(pf.header.Info.Mtime) }
+func (pf *File) Ctime() time.Time               { return base.DecodeTimestamp(pf.header.Info.Ctime) }
+func (pf *File) Mode() fs.FileMode              { return base.DecodeMode(pf.header.Info.Mode) }
 func (pf *File) Type() base.NodeType            { return pf.header.Info.Type }
 func (pf *File) Name() string                   { return pf.name }
 func (pf *File) Size() int64                    { return pf.header.Info.Size }
@@ -850,7 +1506,7 @@ func (pf *File) Stat() (fs.FileInfo, error)     { return pf, nil }
 
 func (pf *File) SetMetadata(md interface{}) (err error) {
 	log.Debugw("setting file metadata", "name", pf.name)
-	pf.metadata, err = newLDFileRatchet(pf.store, "", md, pf.BareNamefilter(), pf.ratchet)
+	pf.metadata, err = newMetadataLDFile(pf.store, "", md, pf.BareNamefilter(), pf.ratchet)
 	return err
 }
 
@@ -859,7 +1515,11 @@ func (pf *File) Metadata() (f base.LDFile, err error) {
 		if !pf.header.Metadata.Defined() {
 			return nil, base.ErrNoLink
 		}
-		pf.metadata, err = LoadLDFile(pf.store.Context(), pf.store, base.MetadataLinkName, pf.header.Metadata, pf.Key())
+		var pn Name
+		if pn, err = pf.PrivateName(); err != nil {
+			return nil, err
+		}
+		pf.metadata, err = LoadLDFile(pf.store.Context(), pf.store, base.MetadataLinkName, pf.header.Metadata, pf.Key(), pn)
 	}
 	return pf.metadata, err
 }
@@ -887,7 +1547,36 @@ func (pf *File) Read(p []byte) (n int, err error) {
 	return pf.content.Read(p)
 }
 
+// Seek sets the offset for the next Read of file contents. Files loaded from
+// the store support seeking, fetching & decrypting only the blocks needed by
+// later reads
+func (pf *File) Seek(offset int64, whence int) (int64, error) {
+	if err := pf.ensureContent(); err != nil {
+		return 0, err
+	}
+	return base.Seek(pf.content, offset, whence)
+}
+
+// ReadAt reads len(p) bytes of the stored file contents starting at off,
+// using a reader separate from Read
+func (pf *File) ReadAt(p []byte, off int64) (int, error) {
+	if pf.readerAt == nil {
+		r, err := pf.store.GetEncryptedFile(pf.header.ContentID, pf.header.Info.CipherSuite, pf.contentKey())
+		if err != nil {
+			return 0, err
+		}
+		if pf.readerAt, err = base.NewReaderAt(r); err != nil {
+			return 0, err
+		}
+	}
+	return pf.readerAt.ReadAt(p, off)
+}
+
 func (pf *File) Close() error {
+	if pf.readerAt != nil {
+		pf.readerAt.Close()
+		pf.readerAt = nil
+	}
 	if pf.content == nil {
 		return nil
 	}
@@ -898,17 +1587,88 @@ func (pf *File) History(ctx context.Context, maxRevs int) ([]base.HistoryEntry,
 	return history(ctx, pf, maxRevs)
 }
 
-func (pf *File) SetContents(f fs.File) {
-	pf.content = f
+// SetContents replaces the contents of pf with f, recording the mode &
+// modification time of f
+func (pf *File) SetContents(f fs.File) {
+	pf.content = f
+	var fi fs.FileInfo
+	if f != nil {
+		fi, _ = f.Stat()
+	}
+	pf.header.Info.Mode, pf.header.Info.Mtime = base.SourceAttrs(fi, pf.header.Info.Mode)
+}
+
+func (pf *File) ensureContent() (err error) {
+	if pf.content == nil {
+		pf.content, err = pf.store.GetEncryptedFile(pf.header.ContentID, pf.header.Info.CipherSuite, pf.contentKey())
+		log.Debugw("opening file contents", "name", pf.name, "cid", pf.cid, "err", err)
+	}
+	return err
+}
+
+// contentKey returns the key file content is encrypted with
+func (pf *File) contentKey() []byte {
+	if len(pf.header.Info.ContentKey) > 0 {
+		return pf.header.Info.ContentKey
+	}
+	key := pf.ratchet.Key()
+	return key[:]
+}
+
+// OpenPatch opens the contents of pf for random-access editing. Edits keep the
+// content key of pf, so a revision shares unchanged leaves with the revision
+// before it. Files without a content key are re-encrypted with a new content
+// key when the patch is applied
+func (pf *File) OpenPatch() (*chunkpatch.File, error) {
+	suite := pf.header.Info.CipherSuite
+	dec, err := suite.New(pf.contentKey())
+	if err != nil {
+		return nil, err
+	}
+	key := pf.header.Info.ContentKey
+	reencrypt := len(key) == 0
+	if reencrypt {
+		newKey := NewKey()
+		key, suite = newKey[:], pf.store.CipherSuite()
+	}
+	codec, err := newCipherLeafCodec(dec, suite, key, pf.ratchet.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := chunkpatch.Open(pf.store.Context(), pf.store.DAGService(), codec, pf.header.ContentID, pf.header.Info.Size)
+	if err != nil {
+		return nil, err
+	}
+	if reencrypt {
+		p.Reencode()
+	}
+	return p, nil
 }
 
-func (pf *File) ensureContent() (err error) {
-	if pf.content == nil {
-		key := pf.ratchet.Key()
-		pf.content, err = pf.store.GetEncryptedFile(pf.header.ContentID, key[:])
-		log.Debugw("opening file contents", "name", pf.name, "cid", pf.cid, "err", err)
+// applyPatch writes the edited contents of p as a new revision of pf
+func (pf *File) applyPatch(p *chunkpatch.File) (PutResult, error) {
+	codec, ok := p.Codec().(*cipherLeafCodec)
+	if !ok {
+		return PutResult{}, fmt.Errorf("%q: patch was not opened on a private file", pf.name)
 	}
-	return err
+	if !p.Base().Equals(pf.header.ContentID) {
+		return PutResult{}, fmt.Errorf("%q: %w", pf.name, chunkpatch.ErrBaseChanged)
+	}
+	root, err := p.Flush()
+	if err != nil {
+		return PutResult{}, err
+	}
+	// all leaves are now encrypted with the content key
+	codec.dec = codec.enc.AEAD()
+
+	pf.header.ContentID = root.Cid()
+	pf.header.Info.Size = p.Size()
+	pf.header.Info.ContentKey = codec.key
+	pf.header.Info.CipherSuite = codec.suite
+	pf.header.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+	pf.content = nil
+	return pf.Put()
 }
 
 func (pf *File) Update(change fs.File) (result PutResult, err error) {
@@ -930,22 +1690,30 @@ func (pf *File) Update(change fs.File) (result PutResult, err error) {
 		}
 		df.SetContents(v)
 		df.header.Info.Type = base.NTLDFile
+		df.header.Info.ContentKey = nil
 		return df.Put()
 	}
 
+	if sl, ok := change.(base.Symlink); ok {
+		// update is changing from file to symlink
+		return pf.toSymlink(sl.Target()).Put()
+	}
+
 	if mdn, ok := change.(base.Metadata); ok {
 		md, err := mdn.Metadata()
-		if err != nil {
-			return PutResult{}, err
-		}
-		meta, err := md.Data()
-		if err != nil {
+		if err != nil && !errors.Is(err, base.ErrNoLink) {
 			return PutResult{}, err
 		}
-		log.Debugw("setting update file meta", "meta", meta)
-		pf.metadata, err = newLDFileRatchet(pf.store, base.MetadataLinkName, meta, pf.BareNamefilter(), pf.ratchet)
-		if err != nil {
-			return PutResult{}, err
+		if err == nil {
+			meta, err := md.Data()
+			if err != nil {
+				return PutResult{}, err
+			}
+			log.Debugw("setting update file meta", "meta", meta)
+			pf.metadata, err = newMetadataLDFile(pf.store, base.MetadataLinkName, meta, pf.BareNamefilter(), pf.ratchet)
+			if err != nil {
+				return PutResult{}, err
+			}
 		}
 	}
 
@@ -953,19 +1721,57 @@ func (pf *File) Update(change fs.File) (result PutResult, err error) {
 	return pf.Put()
 }
 
+func (pf *File) toSymlink(target string) *Symlink {
+	s := &Symlink{
+		store:   pf.store,
+		name:    pf.name,
+		cid:     pf.cid,
+		ratchet: pf.ratchet,
+		header: Header{
+			Info: pf.header.Info.Copy(),
+		},
+	}
+	s.header.Info.Type = base.NTSymlink
+	s.header.Info.Symlink = target
+	s.header.Info.ContentKey = nil
+	s.header.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+	return s
+}
+
+// Put writes pf as a new revision. Files loaded from the store that haven't
+// been read or given new contents keep their existing contents, unless they
+// have no content key
 func (pf *File) Put() (PutResult, error) {
 	ctx := pf.store.Context()
 	store := pf.store
 
+	// contents without a content key are encrypted with the ratchet key, &
+	// must be read before advancing the ratchet changes the key
+	if len(pf.header.Info.ContentKey) == 0 {
+		if err := pf.ensureContent(); err != nil {
+			return PutResult{}, err
+		}
+	}
+
 	// generate a new version key by advancing the ratchet
 	// TODO(b5): what happens if anything errors after advancing the ratchet?
 	// assuming we need to make a point of throwing away the file & cleaning the HAMT
 	pf.ratchet.Inc()
 	key := pf.ratchet.Key()
 
-	res, err := store.PutEncryptedFile(base.NewMemfileReader(pf.name, pf.content), key[:])
-	if err != nil {
-		return PutResult{}, err
+	if pf.content != nil {
+		// each write of new contents is encrypted with a new content key, using
+		// the store suite. Files with unchanged contents keep their suite
+		contentKey := NewKey()
+		suite := store.CipherSuite()
+		res, err := store.PutEncryptedFile(base.NewMemfileReader(pf.name, pf.content), suite, contentKey[:])
+		if err != nil {
+			return PutResult{}, err
+		}
+		pf.header.ContentID = res.Cid
+		pf.header.Info.Size = res.Size
+		pf.header.Info.ContentKey = contentKey[:]
+		pf.header.Info.CipherSuite = suite
 	}
 
 	if pf.metadata != nil {
@@ -979,26 +1785,23 @@ func (pf *File) Put() (PutResult, error) {
 	}
 
 	// update header details
-	pf.header.ContentID = res.Cid
-	pf.header.Info.Size = res.Size
 	pf.header.Info.Ratchet = pf.ratchet.Encode()
-	pf.header.Info.Mtime = base.Timestamp().Unix()
 
-	blk, err := pf.header.encryptHeaderBlock(key)
+	// create private name from key
+	privName, err := pf.PrivateName()
 	if err != nil {
 		return PutResult{}, err
 	}
 
-	if err := store.Blockservice().Blockstore().Put(ctx, blk); err != nil {
+	blk, err := pf.header.encryptHeaderBlock(key, privName)
+	if err != nil {
 		return PutResult{}, err
 	}
-	pf.cid = blk.Cid()
 
-	// create private name from key
-	privName, err := pf.PrivateName()
-	if err != nil {
+	if err := store.Blockservice().Blockstore().Put(ctx, blk); err != nil {
 		return PutResult{}, err
 	}
+	pf.cid = blk.Cid()
 
 	if _, err = store.RatchetStore().PutRatchet(ctx, pf.header.Info.INumber.Encode(), pf.ratchet); err != nil {
 		return PutResult{}, err
@@ -1009,13 +1812,164 @@ func (pf *File) Put() (PutResult, error) {
 		return PutResult{}, err
 	}
 
-	log.Debugw("File.Put", "name", pf.name, "cid", pf.cid.String(), "size", res.Size)
+	log.Debugw("File.Put", "name", pf.name, "cid", pf.cid.String(), "size", pf.header.Info.Size)
 	return PutResult{
 		PutResult: public.PutResult{
 			Cid:      pf.cid,
 			Type:     pf.header.Info.Type,
-			Userland: res.Cid,
-			Size:     res.Size,
+			Userland: pf.header.ContentID,
+			Size:     pf.header.Info.Size,
+		},
+		Key:     key,
+		Pointer: privName,
+	}, nil
+}
+
+type Symlink struct {
+	store  Store
+	name   string  // not persisted. used to implement fs.File interface
+	cid    cid.Cid // cid header was loaded from. empty if new
+	header Header
+
+	ratchet *ratchet.Spiral
+}
+
+var (
+	_ privateNode  = (*Symlink)(nil)
+	_ base.Symlink = (*Symlink)(nil)
+	_ Info         = (*Symlink)(nil)
+)
+
+func NewSymlink(store Store, name, target string, parent BareNamefilter) (*Symlink, error) {
+	in := NewINumber()
+	bnf, err := NewBareNamefilter(parent, in)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Symlink{
+		store:   store,
+		name:    name,
+		ratchet: ratchet.NewSpiral(),
+		header: Header{
+			Info: NewHeaderInfo(base.NTSymlink, in, bnf),
+		},
+	}
+	s.header.Info.Symlink = target
+	return s, nil
+}
+
+func (s *Symlink) Target() string                 { return s.header.Info.Symlink }
+func (s *Symlink) Ratchet() *ratchet.Spiral       { return s.ratchet }
+func (s *Symlink) BareNamefilter() BareNamefilter { return s.header.Info.BareNamefilter }
+func (s *Symlink) INumber() INumber               { return s.header.Info.INumber }
+func (s *Symlink) Cid() cid.Cid                   { return s.cid }
+func (s *Symlink) IsDir() bool                    { return false }
+func (s *Symlink) ModTime() time.Time             { return base.DecodeTimestamp(s.header.Info.Mtime) }
+func (s *Symlink) Ctime() time.Time               { return base.DecodeTimestamp(s.header.Info.Ctime) }
+func (s *Symlink) Mode() fs.FileMode              { return base.DecodeMode(s.header.Info.Mode) | fs.ModeSymlink }
+func (s *Symlink) Type() base.NodeType            { return s.header.Info.Type }
+func (s *Symlink) Name() string                   { return s.name }
+func (s *Symlink) Size() int64                    { return int64(len(s.header.Info.Symlink)) }
+func (s *Symlink) Sys() interface{}               { return s.store }
+func (s *Symlink) Stat() (fs.FileInfo, error)     { return s, nil }
+func (s *Symlink) Key() Key                       { return s.ratchet.Key() }
+
+func (s *Symlink) Read(p []byte) (n int, err error) {
+	return 0, errors.New("cannot read symlink")
+}
+func (s *Symlink) Close() error { return nil }
+
+func (s *Symlink) Metadata() (base.LDFile, error) {
+	return nil, base.ErrNoLink
+}
+
+func (s *Symlink) PrivateName() (Name, error) {
+	knf, err := AddKey(s.header.Info.BareNamefilter, Key(s.ratchet.Key()))
+	if err != nil {
+		return "", err
+	}
+	return ToName(knf)
+}
+
+func (s *Symlink) AsHistoryEntry() base.HistoryEntry {
+	n, _ := s.PrivateName()
+	return base.HistoryEntry{
+		Cid:         s.cid,
+		Size:        s.header.Info.Size,
+		Mtime:       s.header.Info.Mtime,
+		Type:        s.header.Info.Type,
+		Key:         s.Key().Encode(),
+		PrivateName: string(n),
+	}
+}
+
+func (s *Symlink) History(ctx context.Context, maxRevs int) ([]base.HistoryEntry, error) {
+	return history(ctx, s, maxRevs)
+}
+
+func (s *Symlink) Update(change fs.File) (PutResult, error) {
+	if sl, ok := change.(base.Symlink); ok {
+		s.header.Info.Symlink = sl.Target()
+		s.header.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+		return s.Put()
+	}
+
+	// update is changing from symlink to file
+	f := &File{
+		store:   s.store,
+		name:    s.name,
+		cid:     s.cid,
+		ratchet: s.ratchet,
+		header: Header{
+			Info: s.header.Info.Copy(),
+		},
+	}
+	f.header.Info.Type = base.NTFile
+	f.header.Info.Symlink = ""
+	return f.Update(change)
+}
+
+func (s *Symlink) Put() (PutResult, error) {
+	ctx := s.store.Context()
+	store := s.store
+
+	s.ratchet.Inc()
+	key := s.ratchet.Key()
+
+	s.header.Info.Size = s.Size()
+	s.header.Info.Ratchet = s.ratchet.Encode()
+	s.header.Info.CipherSuite = store.CipherSuite()
+
+	privName, err := s.PrivateName()
+	if err != nil {
+		return PutResult{}, err
+	}
+
+	blk, err := s.header.encryptHeaderBlock(key, privName)
+	if err != nil {
+		return PutResult{}, err
+	}
+	if err := store.Blockservice().Blockstore().Put(ctx, blk); err != nil {
+		return PutResult{}, err
+	}
+	s.cid = blk.Cid()
+
+	if _, err = store.RatchetStore().PutRatchet(ctx, s.header.Info.INumber.Encode(), s.ratchet); err != nil {
+		return PutResult{}, err
+	}
+
+	idBytes := CborByteArray(s.cid.Bytes())
+	if err := store.HAMT().Root().Set(ctx, string(privName), &idBytes); err != nil {
+		return PutResult{}, err
+	}
+
+	log.Debugw("Symlink.Put", "name", s.name, "cid", s.cid.String())
+	return PutResult{
+		PutResult: public.PutResult{
+			Cid:  s.cid,
+			Type: s.header.Info.Type,
+			Size: s.header.Info.Size,
 		},
 		Key:     key,
 		Pointer: privName,
@@ -1044,9 +1998,10 @@ type PrivateLink struct {
 	Pointer Name
 }
 
-func LoadNode(ctx context.Context, store Store, name string, id cid.Cid, key Key) (privateNode, error) {
+// LoadNode loads the node with header id, stored at private name pn
+func LoadNode(ctx context.Context, store Store, name string, id cid.Cid, key Key, pn Name) (privateNode, error) {
 	log.Debugw("LoadNode", "name", name, "id", id)
-	header, err := loadHeader(ctx, store, key, id)
+	header, err := loadNodeHeader(ctx, store, key, id, pn)
 	if err != nil {
 		log.Debugw("LoadNode", "err", err)
 		return nil, fmt.Errorf("decoding s-node %q header: %w", name, err)
@@ -1084,6 +2039,14 @@ func LoadNode(ctx context.Context, store Store, name string, id cid.Cid, key Key
 			header:  header,
 			ratchet: r,
 		}, nil
+	case base.NTSymlink:
+		return &Symlink{
+			store:   store,
+			cid:     id,
+			name:    name,
+			header:  header,
+			ratchet: r,
+		}, nil
 	default:
 		return nil, fmt.Errorf("unrecognized private node type %s for cid %s", header.Info.Type, id)
 	}
@@ -1091,13 +2054,21 @@ func LoadNode(ctx context.Context, store Store, name string, id cid.Cid, key Key
 
 type PrivateLinks map[string]PrivateLink
 
-func unmarshalPrivateLinksBlock(blk blocks.Block, key Key) (PrivateLinks, error) {
-	aead, err := newCipher(key[:])
-	if err != nil {
-		return nil, err
+// linksAD is the associated data of the links of the tree with INumber in.
+// Binding links to their tree keeps a links block from being spliced into
+// another tree, even by a writer holding the keys of both
+func linksAD(in INumber) []byte {
+	return append([]byte("wnfs/links/"), in[:]...)
+}
+
+// unmarshalPrivateLinksBlock decrypts the links of the tree with header h
+func unmarshalPrivateLinksBlock(blk blocks.Block, h Header, key Key) (PrivateLinks, error) {
+	ad := linksAD(h.Info.INumber)
+	if h.legacy {
+		// links of legacy headers are sealed without associated data
+		ad = nil
 	}
-	ciphertext := blk.RawData()
-	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+	plaintext, err := open(h.Info.CipherSuite, key[:], blk.RawData(), ad)
 	if err != nil {
 		return nil, err
 	}
@@ -1146,24 +2117,18 @@ func (pls PrivateLinks) SizeSum() (total int64) {
 	return total
 }
 
-func (pls PrivateLinks) marshalEncryptedBlock(key Key) (blocks.Block, error) {
+// marshalEncryptedBlock encrypts the links of the tree with header info
+func (pls PrivateLinks) marshalEncryptedBlock(info HeaderInfo, key Key) (blocks.Block, error) {
 	plaintext, err := cbor.Marshal(pls)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Debugw("encrypting private links", "key", key.Encode())
-	aead, err := newCipher(key[:])
+	log.Debugw("encrypting private links", "key", key.Encode(), "suite", info.CipherSuite)
+	data, err := seal(info.CipherSuite, key[:], sealLinks, linksAD(info.INumber), plaintext)
 	if err != nil {
 		return nil, err
 	}
-	nonce := make([]byte, aead.NonceSize())
-	// TODO(b5): still using random nonces, switching to monotonic long-term
-	if _, err := rand.Read(nonce); err != nil {
-		return nil, err
-	}
-	ciphertext := aead.Seal(nil, nonce, plaintext, nil)
-	data := append(nonce, ciphertext...)
 
 	hash, err := multihash.Sum(data, base.DefaultMultihashType, -1)
 	if err != nil {
@@ -1207,6 +2172,14 @@ type Header struct {
 	Metadata  cid.Cid
 	ContentID cid.Cid
 	Value     interface{} // only present on LDFile nodes
+	// Previous & Merge are only set on revisions written by Restore. Previous
+	// is the restored revision, Merge the different node the restore replaced
+	Previous cid.Cid
+	Merge    cid.Cid
+
+	// legacy is set on headers decoded from a DAG-CBOR envelope, written before
+	// headers were encrypted as a whole
+	legacy bool
 }
 
 type HeaderInfo struct {
@@ -1220,14 +2193,25 @@ type HeaderInfo struct {
 	INumber        INumber
 	BareNamefilter BareNamefilter
 	Ratchet        string
+	Symlink        string `cbor:",omitempty"` // link target, only present on symlinks
+	// ContentKey encrypts file content. Files written before content keys were
+	// introduced have no content key & are encrypted with the ratchet key
+	ContentKey []byte `cbor:",omitempty"`
+	// CipherSuite encrypts header info, directory links & file content. Nodes
+	// written before suites were recorded use AES-GCM, the zero value
+	CipherSuite ciphersuite.Suite `cbor:",omitempty"`
 }
 
 func NewHeaderInfo(nt base.NodeType, in INumber, bnf BareNamefilter) HeaderInfo {
-	now := base.Timestamp().Unix()
+	now := base.EncodeTimestamp(base.Timestamp())
+	mode := uint32(base.ModeDefault)
+	if nt == base.NTDir {
+		mode = base.ModeDirDefault
+	}
 	return HeaderInfo{
 		WNFS:  base.LatestVersion,
 		Type:  nt,
-		Mode:  base.ModeDefault,
+		Mode:  mode,
 		Ctime: now,
 		Mtime: now,
 		Size:  0,
@@ -1258,49 +2242,169 @@ func (hi HeaderInfo) Copy() HeaderInfo {
 		INumber:        hi.INumber,
 		BareNamefilter: hi.BareNamefilter,
 		Ratchet:        hi.Ratchet,
+		Symlink:        hi.Symlink,
+		ContentKey:     hi.ContentKey,
+		CipherSuite:    hi.CipherSuite,
 	}
 }
 
-func (h Header) encryptHeaderBlock(key Key) (blocks.Block, error) {
+// headerAD is the associated data of the header stored at private name pn.
+// Readers look headers up by private name, binding a header to its name keeps
+// a header block from being spliced into another node, even by a writer
+// holding the keys of both
+func headerAD(pn Name) []byte {
+	return append([]byte("wnfs/header/"), pn...)
+}
+
+// headerPayload is the plaintext of an encrypted header. Header blocks are raw
+// blocks holding nothing but ciphertext, keeping the CIDs a node links to
+// secret from anyone without its key. Header info is sealed with the key of a
+// node revision, which binds the payload to its node. Headers written before
+// payloads were encrypted as a whole are DAG-CBOR envelopes with encrypted
+// info & plaintext CIDs
+type headerPayload struct {
+	Info     []byte `cbor:"info"`
+	Content  []byte `cbor:"content,omitempty"`
+	Metadata []byte `cbor:"metadata,omitempty"`
+	Value    []byte `cbor:"value,omitempty"`
+	Previous []byte `cbor:"previous,omitempty"`
+	Merge    []byte `cbor:"merge,omitempty"`
+}
+
+// encryptHeaderBlock seals h with key as the header stored at private name pn
+func (h Header) encryptHeaderBlock(key Key, pn Name) (blocks.Block, error) {
 	buf, err := h.Info.CBOR()
 	if err != nil {
 		return nil, err
 	}
+	p := headerPayload{Info: buf.Bytes()}
+	// symlinks have no content
+	if h.ContentID.Defined() {
+		p.Content = h.ContentID.Bytes()
+	}
+	if h.Metadata.Defined() {
+		p.Metadata = h.Metadata.Bytes()
+	}
+	if h.Previous.Defined() {
+		p.Previous = h.Previous.Bytes()
+	}
+	if h.Merge.Defined() {
+		p.Merge = h.Merge.Bytes()
+	}
+	if h.Info.Type == base.NTLDFile {
+		if p.Value, err = cbor.Marshal(h.Value); err != nil {
+			return nil, err
+		}
+	}
+	plaintext, err := cbor.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
 
-	log.Debugw("encrypting header info block", "key", key.Encode())
-	aead, err := newCipher(key[:])
+	log.Debugw("encrypting header block", "key", key.Encode(), "suite", h.Info.CipherSuite, "content", h.ContentID)
+	data, err := seal(h.Info.CipherSuite, key[:], sealHeader, headerAD(pn), plaintext)
 	if err != nil {
 		return nil, err
 	}
-	nonce := make([]byte, aead.NonceSize())
-	// TODO(b5): still using random nonces, switching to monotonic long-term
-	if _, err := rand.Read(nonce); err != nil {
+
+	hash, err := multihash.Sum(data, base.DefaultMultihashType, -1)
+	if err != nil {
 		return nil, err
 	}
+	return blocks.NewBlockWithCid(data, cid.NewCidV1(cid.Raw, hash))
+}
 
-	encrypted := aead.Seal(nil, nonce, buf.Bytes(), nil)
-	header := map[string]interface{}{
-		"info":    append(nonce, encrypted...),
-		"content": h.ContentID,
+// openHeaderBlock decrypts the payload of the header block stored at private
+// name pn, decoding all fields but the value of LDFile nodes
+func openHeaderBlock(blk blocks.Block, key Key, pn Name) (h Header, p headerPayload, err error) {
+	plaintext, suite, err := openAnySuite(key[:], blk.RawData(), headerAD(pn))
+	if err != nil {
+		log.Debugw("openHeaderBlock", "err", err)
+		return h, p, fmt.Errorf("decrypting header: %w", err)
 	}
-	log.Debugw("content", "cid", h.ContentID)
-	if h.Metadata.Defined() {
-		header["metadata"] = h.Metadata
+	if err := cbor.Unmarshal(plaintext, &p); err != nil {
+		return h, p, fmt.Errorf("decoding header: %w", err)
+	}
+
+	if h.Info, err = HeaderInfoFromCBOR(p.Info); err != nil {
+		log.Debugw("openHeaderBlock", "err", err)
+		return h, p, err
+	}
+	if h.Info.CipherSuite != suite {
+		return h, p, fmt.Errorf("header info records cipher suite %s, but is encrypted with %s", h.Info.CipherSuite, suite)
+	}
+	if len(p.Content) > 0 {
+		if h.ContentID, err = cid.Cast(p.Content); err != nil {
+			return h, p, fmt.Errorf("decoding header content cid: %w", err)
+		}
+	}
+	if len(p.Metadata) > 0 {
+		if h.Metadata, err = cid.Cast(p.Metadata); err != nil {
+			return h, p, fmt.Errorf("decoding header metadata cid: %w", err)
+		}
+	}
+	if len(p.Previous) > 0 {
+		if h.Previous, err = cid.Cast(p.Previous); err != nil {
+			return h, p, fmt.Errorf("decoding header previous cid: %w", err)
+		}
+	}
+	if len(p.Merge) > 0 {
+		if h.Merge, err = cid.Cast(p.Merge); err != nil {
+			return h, p, fmt.Errorf("decoding header merge cid: %w", err)
+		}
+	}
+	return h, p, nil
+}
+
+// loadNodeHeader loads the header of a node to edit. Restore links are
+// dropped, they only describe the revision that was restored
+func loadNodeHeader(ctx context.Context, s Store, key Key, id cid.Cid, pn Name) (h Header, err error) {
+	if h, err = loadHeader(ctx, s, key, id, pn); err != nil {
+		return h, err
 	}
-	return cbornode.WrapObject(header, base.DefaultMultihashType, -1)
+	h.Previous, h.Merge = cid.Undef, cid.Undef
+	return h, nil
 }
 
-func loadHeader(ctx context.Context, s Store, key Key, id cid.Cid) (h Header, err error) {
+func loadHeader(ctx context.Context, s Store, key Key, id cid.Cid, pn Name) (h Header, err error) {
 	log.Debugw("loadHeader", "cid", id, "key", key.Encode())
 	blk, err := s.Blockservice().GetBlock(ctx, id)
 	if err != nil {
 		return h, fmt.Errorf("getting header block %q: %w", id.String(), err)
 	}
 
-	return decodeHeaderBlock(blk, key)
+	return decodeHeaderBlock(blk, key, pn)
+}
+
+// decodeHeaderBlock decodes the header stored at private name pn. Legacy
+// headers aren't bound to their name
+func decodeHeaderBlock(blk blocks.Block, key Key, pn Name) (h Header, err error) {
+	if blk.Cid().Prefix().Codec != cid.Raw {
+		return decodeLegacyHeaderBlock(blk, key)
+	}
+
+	h, p, err := openHeaderBlock(blk, key, pn)
+	if err != nil {
+		return h, err
+	}
+	if h.Info.Type == base.NTLDFile {
+		if p.Value == nil {
+			return h, fmt.Errorf("LDFile header has no value field")
+		}
+		var v interface{}
+		if err = cbornode.DecodeInto(p.Value, &v); err != nil {
+			return h, err
+		}
+		h.Value = v
+	} else if h.Info.Type != base.NTSymlink && !h.ContentID.Defined() {
+		return h, fmt.Errorf("header has no content cid")
+	}
+	return h, nil
 }
 
-func decodeHeaderBlock(blk blocks.Block, key Key) (h Header, err error) {
+// decodeLegacyHeaderBlock decodes a DAG-CBOR header envelope
+func decodeLegacyHeaderBlock(blk blocks.Block, key Key) (h Header, err error) {
+	h.legacy = true
 	env := map[string]interface{}{}
 	if err := cbor.Unmarshal(blk.RawData(), &env); err != nil {
 		log.Debugw("decodeHeaderBlock", "err", err, "data", fmt.Sprintf("%x", blk.RawData()))
@@ -1312,11 +2416,7 @@ func decodeHeaderBlock(blk blocks.Block, key Key) (h Header, err error) {
 		return h, fmt.Errorf("header is missing info field")
 	}
 
-	aead, err := newCipher(key[:])
-	if err != nil {
-		return h, err
-	}
-	plaintext, err := aead.Open(nil, encInfo[:aead.NonceSize()], encInfo[aead.NonceSize():], nil)
+	plaintext, suite, err := openAnySuite(key[:], encInfo, nil)
 	if err != nil {
 		log.Debugw("decodeHeaderBlock info", "err", err)
 		return h, fmt.Errorf("decrypting info: %w", err)
@@ -1326,6 +2426,9 @@ func decodeHeaderBlock(blk blocks.Block, key Key) (h Header, err error) {
 		log.Debugw("decodeHeaderBlock", "err", err)
 		return h, err
 	}
+	if h.Info.CipherSuite != suite {
+		return h, fmt.Errorf("header info records cipher suite %s, but is encrypted with %s", h.Info.CipherSuite, suite)
+	}
 
 	if meta, ok := env["metadata"].(cbor.Tag); ok {
 		if h.Metadata, err = cidFromCBORTag(meta); err != nil {
@@ -1338,7 +2441,7 @@ func decodeHeaderBlock(blk blocks.Block, key Key) (h Header, err error) {
 	if h.Info.Type == base.NTLDFile {
 		// TODO(b5): this is probably the right place to decode content
 		if encValue, ok := env["value"].([]byte); ok {
-			plaintext, err = aead.Open(nil, encValue[:aead.NonceSize()], encValue[aead.NonceSize():], nil)
+			plaintext, err = open(suite, key[:], encValue, nil)
 			if err != nil {
 				log.Debugw("decodeHeaderBlock value", "err", err)
 				return h, err
@@ -1351,7 +2454,7 @@ func decodeHeaderBlock(blk blocks.Block, key Key) (h Header, err error) {
 		} else {
 			return h, fmt.Errorf("LDFile header has no value field")
 		}
-	} else {
+	} else if h.Info.Type != base.NTSymlink {
 		if content, ok := env["content"].(cbor.Tag); ok {
 			if h.ContentID, err = cidFromCBORTag(content); err != nil {
 				log.Debugw("decodeHeaderBlock", "err", err)
@@ -1386,6 +2489,10 @@ type LDFile struct {
 	header      Header
 	content     interface{}
 	jsonContent *bytes.Buffer
+	// owner is the bare namefilter of the node metadata describes. Metadata
+	// isn't stored under a private name of its own, so its header is bound
+	// to the name of its owner
+	owner BareNamefilter
 }
 
 var (
@@ -1415,7 +2522,19 @@ func newLDFileRatchet(store Store, name string, content interface{}, parent Bare
 	}, nil
 }
 
-func LoadLDFile(ctx context.Context, fs Store, name string, id cid.Cid, key Key) (*LDFile, error) {
+// newMetadataLDFile creates metadata for the node with bare namefilter owner
+// & ratchet r
+func newMetadataLDFile(store Store, name string, content interface{}, owner BareNamefilter, r *ratchet.Spiral) (*LDFile, error) {
+	df, err := newLDFileRatchet(store, name, content, owner, r)
+	if err != nil {
+		return nil, err
+	}
+	df.owner = owner
+	return df, nil
+}
+
+// LoadLDFile loads the data file with header id, bound to private name pn
+func LoadLDFile(ctx context.Context, fs Store, name string, id cid.Cid, key Key, pn Name) (*LDFile, error) {
 	df := &LDFile{
 		store: fs,
 		name:  name,
@@ -1427,15 +2546,28 @@ func LoadLDFile(ctx context.Context, fs Store, name string, id cid.Cid, key Key)
 		return nil, err
 	}
 
-	return decodeLDFileBlock(df, blk, key)
+	return decodeLDFileBlock(df, blk, key, pn)
 }
 
-func decodeLDFileBlock(df *LDFile, blk blocks.Block, key Key) (*LDFile, error) {
-	aead, err := newCipher(key[:])
+func decodeLDFileBlock(df *LDFile, blk blocks.Block, key Key, pn Name) (*LDFile, error) {
+	if blk.Cid().Prefix().Codec != cid.Raw {
+		return decodeLegacyLDFileBlock(df, blk, key)
+	}
+
+	h, p, err := openHeaderBlock(blk, key, pn)
 	if err != nil {
 		return nil, err
 	}
+	if p.Value == nil {
+		return nil, fmt.Errorf("malformed private LDFile node %s: missing content bytes", blk.Cid())
+	}
+	df.header.Info = h.Info
+	df.header.Metadata = h.Metadata
+	return df, df.decodeContent(p.Value)
+}
 
+// decodeLegacyLDFileBlock decodes a DAG-CBOR LDFile envelope
+func decodeLegacyLDFileBlock(df *LDFile, blk blocks.Block, key Key) (*LDFile, error) {
 	env := map[string]interface{}{}
 	if err := cbornode.DecodeInto(blk.RawData(), &env); err != nil {
 		return nil, err
@@ -1445,7 +2577,7 @@ func decodeLDFileBlock(df *LDFile, blk blocks.Block, key Key) (*LDFile, error) {
 	if !ok {
 		return nil, fmt.Errorf("malformed private LDFile node %s: missing info bytes", blk.Cid())
 	}
-	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+	plaintext, suite, err := openAnySuite(key[:], ciphertext, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -1454,28 +2586,35 @@ func decodeLDFileBlock(df *LDFile, blk blocks.Block, key Key) (*LDFile, error) {
 	if err != nil {
 		return nil, err
 	}
+	if df.header.Info.CipherSuite != suite {
+		return nil, fmt.Errorf("malformed private LDFile node %s: info records cipher suite %s, but is encrypted with %s", blk.Cid(), df.header.Info.CipherSuite, suite)
+	}
 
 	if ciphertext, ok = env["value"].([]byte); !ok {
 		return nil, fmt.Errorf("malformed private LDFile node %s: missing content bytes", blk.Cid())
 	}
-	if plaintext, err = aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil); err != nil {
+	if plaintext, err = open(suite, key[:], ciphertext, nil); err != nil {
 		return nil, err
 	}
+	return df, df.decodeContent(plaintext)
+}
+
+func (df *LDFile) decodeContent(data []byte) (err error) {
 	var content interface{}
-	if err := cbor.Unmarshal(plaintext, &content); err != nil {
-		return nil, err
+	if err := cbor.Unmarshal(data, &content); err != nil {
+		return err
 	}
-
 	df.content, err = base.SanitizeCBORForJSON(content)
-	return df, err
+	return err
 }
 
 func (df *LDFile) IsBare() bool                   { return false }
 func (df *LDFile) Links() base.Links              { return base.NewLinks() } // TODO(b5): remove Links method?
 func (df *LDFile) Name() string                   { return df.name }
 func (df *LDFile) Size() int64                    { return df.header.Info.Size }
-func (df *LDFile) ModTime() time.Time             { return time.Unix(df.header.Info.Mtime, 0) }
-func (df *LDFile) Mode() fs.FileMode              { return fs.FileMode(df.header.Info.Mode) }
+func (df *LDFile) ModTime() time.Time             { return base.DecodeTimestamp(df.header.Info.Mtime) }
+func (df *LDFile) Ctime() time.Time               { return base.DecodeTimestamp(df.header.Info.Ctime) }
+func (df *LDFile) Mode() fs.FileMode              { return base.DecodeMode(df.header.Info.Mode) }
 func (df *LDFile) Type() base.NodeType            { return df.header.Info.Type }
 func (df *LDFile) IsDir() bool                    { return false }
 func (df *LDFile) Sys() interface{}               { return df.store }
@@ -1531,6 +2670,7 @@ func (df *LDFile) Close() error { return nil }
 func (df *LDFile) SetContents(data interface{}) {
 	df.content = data
 	df.jsonContent = nil
+	df.header.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
 }
 
 func (df *LDFile) Update(change fs.File) (result PutResult, err error) {
@@ -1543,18 +2683,36 @@ func (df *LDFile) Update(change fs.File) (result PutResult, err error) {
 		return df.Put()
 	}
 
+	if sl, ok := change.(base.Symlink); ok {
+		// update is changing from data file to symlink
+		s := &Symlink{
+			store:   df.store,
+			name:    df.name,
+			cid:     df.cid,
+			ratchet: df.ratchet,
+			header: Header{
+				Info: df.header.Info.Copy(),
+			},
+		}
+		s.header.Info.Type = base.NTSymlink
+		s.header.Info.Symlink = sl.Target()
+		s.header.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+		return s.Put()
+	}
+
 	// update is changing from data file to file
 	f := &File{
-		store: df.store,
-		name:  df.name,
-		cid:   df.cid,
+		store:   df.store,
+		name:    df.name,
+		cid:     df.cid,
+		ratchet: df.ratchet,
 		header: Header{
 			Info:     df.header.Info.Copy(),
 			Metadata: df.header.Metadata,
 		},
-		content: change,
 	}
 	f.header.Info.Type = base.NTFile
+	f.SetContents(change)
 	return f.Put()
 }
 
@@ -1565,18 +2723,27 @@ func (df *LDFile) Put() (result PutResult, err error) {
 
 	// df.header.Info.Size = ???
 	df.header.Info.Ratchet = df.ratchet.Encode()
-	df.header.Info.Mtime = base.Timestamp().Unix()
 
-	blk, err := df.encodeBlock(key)
+	name, err := df.PrivateName()
 	if err != nil {
 		return result, err
 	}
-	df.cid = blk.Cid()
+	headerName := name
+	if df.owner != "" {
+		knf, err := AddKey(df.owner, key)
+		if err != nil {
+			return result, err
+		}
+		if headerName, err = ToName(knf); err != nil {
+			return result, err
+		}
+	}
 
-	name, err := df.PrivateName()
+	blk, err := df.encodeBlock(key, headerName)
 	if err != nil {
 		return result, err
 	}
+	df.cid = blk.Cid()
 
 	if err = df.store.Blockservice().Blockstore().Put(ctx, blk); err != nil {
 		return result, err
@@ -1604,40 +2771,9 @@ func (df *LDFile) AsHistoryEntry() base.HistoryEntry {
 	}
 }
 
-func (df *LDFile) encodeBlock(key Key) (blocks.Block, error) {
-	aead, err := newCipher(key[:])
-	if err != nil {
-		return nil, err
-	}
-
-	data, err := cbor.Marshal(df.header.Info)
-	if err != nil {
-		return nil, err
-	}
-
-	nonce := make([]byte, aead.NonceSize())
-	rand.Read(nonce)
-	cipher := aead.Seal(nil, nonce, data, nil)
-	infoCipher := append(nonce, cipher...)
-
-	data, err = cbor.Marshal(df.content)
-	if err != nil {
-		return nil, err
-	}
-	nonce = nonce[:]
-	rand.Read(nonce)
-	cipher = aead.Seal(nil, nonce, data, nil)
-	contentCipher := append(nonce, cipher...)
-
-	// TODO(b5): link name obfuscation
-	LDFile := map[string]interface{}{
-		"info":  infoCipher,
-		"value": contentCipher,
-	}
-
-	if df.header.Metadata.Defined() {
-		LDFile["metadata"] = df.header.Metadata
-	}
-
-	return cbornode.WrapObject(LDFile, base.DefaultMultihashType, -1)
+func (df *LDFile) encodeBlock(key Key, pn Name) (blocks.Block, error) {
+	df.header.Info.CipherSuite = df.store.CipherSuite()
+	h := df.header
+	h.Value = df.content
+	return h.encryptHeaderBlock(key, pn)
 }
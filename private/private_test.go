@@ -1,6 +1,7 @@
 package private
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
@@ -16,6 +17,8 @@ import (
 	golog "github.com/ipfs/go-log"
 	"github.com/multiformats/go-multihash"
 	base "github.com/functionland/wnfs-go/base"
+	mockblocks "github.com/functionland/wnfs-go/mockblocks"
+	ciphersuite "github.com/functionland/wnfs-go/private/ciphersuite"
 	"github.com/functionland/wnfs-go/private/ratchet"
 	"github.com/stretchr/testify/assert"
 	require "github.com/stretchr/testify/require"
@@ -44,21 +47,25 @@ func TestCryptoFile(t *testing.T) {
 	plaintext := strings.Repeat("oh hello. ", 1235340)
 	key := testRootKey[:]
 
-	res, err := store.PutEncryptedFile(base.NewMemfileBytes("", []byte(plaintext)), key)
-	require.Nil(t, err)
+	for _, suite := range ciphersuite.Suites {
+		t.Run(suite.String(), func(t *testing.T) {
+			res, err := store.PutEncryptedFile(base.NewMemfileBytes("", []byte(plaintext)), suite, key)
+			require.Nil(t, err)
 
-	f, err := store.GetEncryptedFile(res.Cid, key)
-	require.Nil(t, err)
+			f, err := store.GetEncryptedFile(res.Cid, suite, key)
+			require.Nil(t, err)
 
-	pt2, err := ioutil.ReadAll(f)
-	require.Nil(t, err)
+			pt2, err := ioutil.ReadAll(f)
+			require.Nil(t, err)
 
-	if len(plaintext) != len(pt2) {
-		t.Errorf("decoded length mismatch. want: %d got: %d", len(plaintext), len(pt2))
-	}
+			if len(plaintext) != len(pt2) {
+				t.Errorf("decoded length mismatch. want: %d got: %d", len(plaintext), len(pt2))
+			}
 
-	if plaintext != string(pt2) {
-		t.Errorf("result mismatch:\nwant: %q\ngot:  %q", plaintext, string(pt2))
+			if plaintext != string(pt2) {
+				t.Errorf("result mismatch:\nwant: %q\ngot:  %q", plaintext, string(pt2))
+			}
+		})
 	}
 }
 
@@ -92,6 +99,41 @@ func TestHistory(t *testing.T) {
 	t.Logf("%#v", hist)
 }
 
+func TestCopyFileWithoutMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestPrivateStore(ctx, t)
+	root, err := NewEmptyRoot(ctx, store, "private", testRootKey)
+	require.Nil(t, err)
+	_, err = root.Add(base.MustPath("a.txt"), base.NewMemfileBytes("a.txt", []byte("a")))
+	require.Nil(t, err)
+	_, err = root.Add(base.MustPath("b.txt"), base.NewMemfileBytes("b.txt", []byte("b")))
+	require.Nil(t, err)
+
+	// files read from a tree report a missing metadata link with ErrNoLink,
+	// which shouldn't stop them from being written elsewhere
+	for _, name := range []string{"a.txt", "c.txt"} {
+		f, err := root.Get(base.MustPath("b.txt"))
+		require.Nil(t, err)
+		_, err = root.Add(base.MustPath(name), f)
+		require.Nil(t, err, name)
+	}
+}
+
+func TestSymlinkRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestPrivateStore(ctx, t)
+	root, err := NewEmptyRoot(ctx, store, "private", testRootKey)
+	require.Nil(t, err)
+	sl, err := NewSymlink(store, "link", "target", root.header.Info.BareNamefilter)
+	require.Nil(t, err)
+	_, err = ioutil.ReadAll(sl)
+	require.NotNil(t, err)
+}
+
 func TestHeaderCoding(t *testing.T) {
 	hash, err := multihash.Sum([]byte("hi"), base.DefaultMultihashType, -1)
 	require.Nil(t, err)
@@ -112,15 +154,73 @@ func TestHeaderCoding(t *testing.T) {
 		},
 		ContentID: content,
 	}
-	blk, err := h.encryptHeaderBlock(testRootKey)
-	require.Nil(t, err)
+	pn := Name("apples")
+	for _, suite := range ciphersuite.Suites {
+		h.Info.CipherSuite = suite
+		blk, err := h.encryptHeaderBlock(testRootKey, pn)
+		require.Nil(t, err)
+		// header blocks are nothing but ciphertext
+		assert.Equal(t, uint64(cid.Raw), blk.Cid().Prefix().Codec)
+		assert.False(t, bytes.Contains(blk.RawData(), content.Bytes()), "header block contains content CID")
+
+		got, err := decodeHeaderBlock(blk, testRootKey, pn)
+		require.Nil(t, err)
+
+		assert.Equal(t, h, got)
 
-	got, err := decodeHeaderBlock(blk, testRootKey)
+		// headers are bound to their private name
+		_, err = decodeHeaderBlock(blk, testRootKey, Name("oranges"))
+		assert.NotNil(t, err)
+	}
+
+	// headers written with a DAG-CBOR envelope remain readable
+	buf, err := h.Info.CBOR()
+	require.Nil(t, err)
+	info, err := seal(h.Info.CipherSuite, testRootKey[:], sealHeader, nil, buf.Bytes())
+	require.Nil(t, err)
+	legacy, err := ipldcbor.WrapObject(map[string]interface{}{
+		"info":    info,
+		"content": content,
+	}, base.DefaultMultihashType, -1)
 	require.Nil(t, err)
 
+	// legacy headers aren't bound to a name
+	got, err := decodeHeaderBlock(legacy, testRootKey, Name("oranges"))
+	require.Nil(t, err)
+	assert.True(t, got.legacy)
+	got.legacy = false
 	assert.Equal(t, h, got)
 }
 
+func TestHeaderSplicing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestPrivateStore(ctx, t)
+	root, err := NewEmptyRoot(ctx, store, "private", testRootKey)
+	require.Nil(t, err)
+	_, err = root.Add(base.MustPath("a.txt"), base.NewMemfileBytes("a.txt", []byte("a")))
+	require.Nil(t, err)
+	_, err = root.Add(base.MustPath("b.txt"), base.NewMemfileBytes("b.txt", []byte("b")))
+	require.Nil(t, err)
+
+	a, b := root.links.Get("a.txt"), root.links.Get("b.txt")
+	require.NotNil(t, a)
+	require.NotNil(t, b)
+	_, err = LoadNode(ctx, store, "a.txt", a.Cid, a.Key, a.Pointer)
+	require.Nil(t, err)
+
+	// move the header block of a.txt to the private name of b.txt. Even with
+	// the key of a.txt the moved header doesn't open
+	idBytes := CborByteArray(a.Cid.Bytes())
+	require.Nil(t, store.HAMT().Root().Set(ctx, string(b.Pointer), &idBytes))
+	id, err := cidFromPrivateName(ctx, store, b.Pointer)
+	require.Nil(t, err)
+	_, err = LoadNode(ctx, store, "b.txt", id, a.Key, b.Pointer)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "message authentication failed")
+}
+
 func TestPrivateLinkBlockCoding(t *testing.T) {
 	hash, err := multihash.Sum([]byte("hi"), base.DefaultMultihashType, -1)
 	require.Nil(t, err)
@@ -130,13 +230,165 @@ func TestPrivateLinkBlockCoding(t *testing.T) {
 		"foo": PrivateLink{Link: base.Link{Name: "foo", Cid: fooCid, Size: 5, Mtime: 20}, Key: testRootKey, Pointer: Name("apples")},
 	}
 
-	blk, err := links.marshalEncryptedBlock(testRootKey)
+	h := Header{Info: HeaderInfo{INumber: NewINumber()}}
+	for _, suite := range ciphersuite.Suites {
+		h.Info.CipherSuite = suite
+		blk, err := links.marshalEncryptedBlock(h.Info, testRootKey)
+		require.Nil(t, err)
+
+		got, err := unmarshalPrivateLinksBlock(blk, h, testRootKey)
+		require.Nil(t, err)
+		assert.Equal(t, links, got)
+
+		other := h
+		other.Info.CipherSuite = ciphersuite.Suites[(int(suite)+1)%len(ciphersuite.Suites)]
+		_, err = unmarshalPrivateLinksBlock(blk, other, testRootKey)
+		assert.NotNil(t, err, "links encrypted with %s opened with %s", suite, other.Info.CipherSuite)
+
+		// links are bound to the INumber of their tree
+		other = h
+		other.Info.INumber = NewINumber()
+		_, err = unmarshalPrivateLinksBlock(blk, other, testRootKey)
+		assert.NotNil(t, err, "links of one tree opened as the links of another")
+	}
+}
+
+func TestMixedCipherSuites(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bserv := mockblocks.NewOfflineMemBlockservice()
+	rs := ratchet.NewMemStore(ctx)
+	write := func(root *Root, name string) {
+		t.Helper()
+		_, err := root.Add(base.MustPath(name), base.NewMemfileBytes(name, []byte(name)))
+		require.Nil(t, err)
+		_, err = root.Put()
+		require.Nil(t, err)
+	}
+
+	store, err := NewStore(ctx, bserv, rs)
+	require.Nil(t, err)
+	root, err := NewEmptyRoot(ctx, store, "private", testRootKey)
 	require.Nil(t, err)
+	write(root, "aes.txt")
 
-	got, err := unmarshalPrivateLinksBlock(blk, testRootKey)
+	// each store writes with its own suite, reading any suite
+	for _, suite := range ciphersuite.Suites[1:] {
+		pn, err := root.PrivateName()
+		require.Nil(t, err)
+		store, err := LoadStore(ctx, bserv, rs, root.store.HAMT().CID(), WithCipherSuite(suite))
+		require.Nil(t, err)
+		root, err = LoadRoot(ctx, store, "private", root.Key(), pn)
+		require.Nil(t, err)
+		write(root, suite.String()+".txt")
+		require.Equal(t, suite, root.header.Info.CipherSuite)
+	}
+
+	pn, err := root.PrivateName()
+	require.Nil(t, err)
+	store, err = LoadStore(ctx, bserv, rs, root.store.HAMT().CID())
 	require.Nil(t, err)
+	root, err = LoadRoot(ctx, store, "private", root.Key(), pn)
+	require.Nil(t, err)
+	for _, suite := range ciphersuite.Suites {
+		name := suite.String() + ".txt"
+		if suite == ciphersuite.AESGCM {
+			name = "aes.txt"
+		}
+		f, err := root.Get(base.MustPath(name))
+		require.Nil(t, err, name)
+		require.Equal(t, suite, f.(*File).header.Info.CipherSuite)
+		data, err := ioutil.ReadAll(f)
+		require.Nil(t, err)
+		require.Equal(t, name, string(data))
+	}
 
-	assert.Equal(t, links, got)
+	_, err = LoadStore(ctx, bserv, rs, cid.Undef, WithCipherSuite(ciphersuite.Suite(100)))
+	require.NotNil(t, err)
+}
+
+func TestDeterministicNonces(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestPrivateStore(ctx, t)
+	root, err := NewEmptyRoot(ctx, store, "private", testRootKey)
+	require.Nil(t, err)
+	path := base.MustPath("big.txt")
+	_, err = root.Add(path, base.NewMemfileBytes("big.txt", []byte(strings.Repeat("a", encryptedChunkSize*2))))
+	require.Nil(t, err)
+	_, err = root.Put()
+	require.Nil(t, err)
+
+	// nonces of all leaves sealed with the content key of big.txt, mapped to the
+	// leaf they seal. Unchanged leaves are shared between revisions
+	var (
+		nonces     = map[string]cid.Cid{}
+		contentKey []byte
+	)
+	addLeafNonces := func(root *Root) {
+		t.Helper()
+		f, err := root.Get(path)
+		require.Nil(t, err)
+		if contentKey == nil {
+			contentKey = f.(*File).header.Info.ContentKey
+		}
+		require.Equal(t, contentKey, f.(*File).header.Info.ContentKey)
+		nd, err := store.DAGService().Get(ctx, f.(*File).header.ContentID)
+		require.Nil(t, err)
+		require.Equal(t, 3, len(nd.Links()))
+		for i, l := range nd.Links() {
+			leaf, err := store.DAGService().Get(ctx, l.Cid)
+			require.Nil(t, err)
+			nonce := leaf.RawData()[:12]
+			require.Equal(t, []byte{0, 0, 0, byte(i)}, nonce[8:], "nonces end with the chunk index")
+			if id, ok := nonces[string(nonce)]; ok {
+				require.Equal(t, id, l.Cid, "nonce of leaf %d reused for different ciphertext", i)
+			}
+			nonces[string(nonce)] = l.Cid
+		}
+	}
+	patch := func(root *Root, data string, off int64) {
+		t.Helper()
+		p, err := root.OpenPatch(path)
+		require.Nil(t, err)
+		_, err = p.WriteAt([]byte(data), off)
+		require.Nil(t, err)
+		_, err = root.ApplyPatch(path, p)
+		require.Nil(t, err)
+	}
+
+	// the first patch re-encrypts with a content key kept by later revisions
+	patch(root, "first", 0)
+	addLeafNonces(root)
+	for i := 0; i < 5; i++ {
+		patch(root, fmt.Sprintf("revision %d", i), encryptedChunkSize)
+		addLeafNonces(root)
+	}
+
+	// replicas diverging from the same revision seal different plaintexts with
+	// the same content key, ratchet position & chunk index
+	pn, err := root.PrivateName()
+	require.Nil(t, err)
+	for _, edit := range []string{"replica a", "replica b"} {
+		replica, err := LoadRoot(ctx, store, "private", root.Key(), pn)
+		require.Nil(t, err)
+		patch(replica, edit, 0)
+		addLeafNonces(replica)
+	}
+	// 3 leaves, then 1 changed leaf for each revision & replica
+	require.Equal(t, 3+5+2, len(nonces))
+
+	// nonces are deterministic
+	a, err := seal(ciphersuite.Default, testRootKey[:], sealHeader, headerAD(pn), []byte("hello"))
+	require.Nil(t, err)
+	b, err := seal(ciphersuite.Default, testRootKey[:], sealHeader, headerAD(pn), []byte("hello"))
+	require.Nil(t, err)
+	require.Equal(t, a, b)
+	b, err = seal(ciphersuite.Default, testRootKey[:], sealLinks, headerAD(pn), []byte("hello"))
+	require.Nil(t, err)
+	require.NotEqual(t, a[:12], b[:12])
 }
 
 func TestPrivateBlockWriting(t *testing.T) {
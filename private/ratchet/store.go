@@ -43,7 +43,7 @@ func (s *ratchetStore) PutRatchet(ctx context.Context, name string, ratchet *Spi
 
 	if _, exists := s.cache[string(name)]; !exists {
 		log.Debugw("writing ratchet", "name", name)
-		s.cache[string(name)] = ratchet
+		s.cache[string(name)] = ratchet.Copy()
 		updated = true
 	}
 	return updated, nil
@@ -58,7 +58,7 @@ func (s *ratchetStore) OldestKnownRatchet(ctx context.Context, name string) (*Sp
 	if !exists {
 		return nil, ErrRatchetNotFound
 	}
-	return got, nil
+	return got.Copy(), nil
 }
 
 func (s *ratchetStore) ForEach(ctx context.Context, visit func(name string, r *Spiral) error) error {
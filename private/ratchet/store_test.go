@@ -38,6 +38,28 @@ func TestMemStore(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestStoreCopiesRatchets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewMemStore(ctx)
+
+	// nodes keep advancing the ratchets they store
+	a := NewSpiral()
+	expect := a.Copy()
+	_, err := s.PutRatchet(ctx, "a", a)
+	require.Nil(t, err)
+	a.Inc()
+
+	got, err := s.OldestKnownRatchet(ctx, "a")
+	require.Nil(t, err)
+	assert.Equal(t, expect, got)
+
+	got.Inc()
+	got, err = s.OldestKnownRatchet(ctx, "a")
+	require.Nil(t, err)
+	assert.Equal(t, expect, got)
+}
+
 func TestFileStore(t *testing.T) {
 	path, err := ioutil.TempDir("", "wnfs_ratchet_test")
 	require.Nil(t, err)
@@ -2,12 +2,13 @@ package private
 
 import (
 	"context"
-	"crypto/aes"
 	"crypto/cipher"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"math"
 
 	hamt "github.com/filecoin-project/go-hamt-ipld/v3"
 	blockservice "github.com/ipfs/go-blockservice"
@@ -21,7 +22,9 @@ import (
 	ihelper "github.com/ipfs/go-unixfs/importer/helpers"
 	mh "github.com/multiformats/go-multihash"
 	base "github.com/functionland/wnfs-go/base"
+	chunkpatch "github.com/functionland/wnfs-go/chunkpatch"
 	cipherchunker "github.com/functionland/wnfs-go/private/cipherchunker"
+	ciphersuite "github.com/functionland/wnfs-go/private/ciphersuite"
 	cipherfile "github.com/functionland/wnfs-go/private/cipherfile"
 	ratchet "github.com/functionland/wnfs-go/private/ratchet"
 	public "github.com/functionland/wnfs-go/public"
@@ -30,8 +33,10 @@ import (
 
 type Store interface {
 	Context() context.Context
-	PutEncryptedFile(f fs.File, key []byte) (PutResult, error)
-	GetEncryptedFile(root cid.Cid, key []byte) (io.ReadCloser, error)
+	PutEncryptedFile(f fs.File, suite ciphersuite.Suite, key []byte) (PutResult, error)
+	GetEncryptedFile(root cid.Cid, suite ciphersuite.Suite, key []byte) (io.ReadCloser, error)
+	// CipherSuite is the suite new data is encrypted with
+	CipherSuite() ciphersuite.Suite
 
 	HAMT() *HAMT
 	DAGService() ipld.DAGService
@@ -52,6 +57,23 @@ func NodeStore(n base.Node) (Store, error) {
 	return mdfs, nil
 }
 
+// StoreOptions configure a private store
+type StoreOptions struct {
+	// CipherSuite is the suite new data is encrypted with. Data encrypted with
+	// any suite can be read regardless of this setting
+	CipherSuite ciphersuite.Suite
+}
+
+// StoreOption is a function that adjusts StoreOptions
+type StoreOption func(o *StoreOptions)
+
+// WithCipherSuite sets the suite new data is encrypted with
+func WithCipherSuite(s ciphersuite.Suite) StoreOption {
+	return func(o *StoreOptions) {
+		o.CipherSuite = s
+	}
+}
+
 // warning! cipherStore doesn't pin!
 type cipherStore struct {
 	ctx   context.Context
@@ -59,26 +81,24 @@ type cipherStore struct {
 	dag   ipld.DAGService
 	hamt  *HAMT
 	rs    ratchet.Store
+	suite ciphersuite.Suite
 }
 
 var _ Store = (*cipherStore)(nil)
 
-func NewStore(ctx context.Context, bserv blockservice.BlockService, rs ratchet.Store) (Store, error) {
-	h, err := NewEmptyHamt(bserv.Blockstore())
-	if err != nil {
-		return nil, err
-	}
-
-	return &cipherStore{
-		ctx:   ctx,
-		bserv: bserv,
-		dag:   merkledag.NewDAGService(bserv),
-		hamt:  h,
-		rs:    rs,
-	}, nil
+func NewStore(ctx context.Context, bserv blockservice.BlockService, rs ratchet.Store, opts ...StoreOption) (Store, error) {
+	return LoadStore(ctx, bserv, rs, cid.Undef, opts...)
 }
 
-func LoadStore(ctx context.Context, bserv blockservice.BlockService, rs ratchet.Store, hamtCid cid.Cid) (s Store, err error) {
+func LoadStore(ctx context.Context, bserv blockservice.BlockService, rs ratchet.Store, hamtCid cid.Cid, opts ...StoreOption) (s Store, err error) {
+	o := StoreOptions{CipherSuite: ciphersuite.Default}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !o.CipherSuite.Valid() {
+		return nil, fmt.Errorf("invalid cipher suite %s", o.CipherSuite)
+	}
+
 	var h *HAMT
 	if hamtCid.Defined() {
 		if h, err = LoadHAMT(ctx, bserv.Blockstore(), hamtCid); err != nil {
@@ -96,6 +116,7 @@ func LoadStore(ctx context.Context, bserv blockservice.BlockService, rs ratchet.
 		dag:   merkledag.NewDAGService(bserv),
 		hamt:  h,
 		rs:    rs,
+		suite: o.CipherSuite,
 	}, nil
 }
 
@@ -104,13 +125,9 @@ func (cs *cipherStore) DAGService() ipld.DAGService             { return cs.dag
 func (cs *cipherStore) Blockservice() blockservice.BlockService { return cs.bserv }
 func (cs *cipherStore) HAMT() *HAMT                             { return cs.hamt }
 func (cs *cipherStore) RatchetStore() ratchet.Store             { return cs.rs }
+func (cs *cipherStore) CipherSuite() ciphersuite.Suite          { return cs.suite }
 
-func (cs *cipherStore) GetEncryptedFile(root cid.Cid, key []byte) (io.ReadCloser, error) {
-	auth, err := newAESGCMCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
+func (cs *cipherStore) GetEncryptedFile(root cid.Cid, suite ciphersuite.Suite, key []byte) (io.ReadCloser, error) {
 	ses := merkledag.NewSession(cs.ctx, cs.dag)
 
 	nd, err := ses.Get(cs.ctx, root)
@@ -118,14 +135,14 @@ func (cs *cipherStore) GetEncryptedFile(root cid.Cid, key []byte) (io.ReadCloser
 		return nil, fmt.Errorf("getting cid %s: %w", root, err)
 	}
 
-	cf, err := cipherfile.NewCipherFile(cs.ctx, merkledag.NewReadOnlyDagService(ses), nd, auth)
+	cf, err := cipherfile.NewCipherFile(cs.ctx, merkledag.NewReadOnlyDagService(ses), nd, suite, key, encryptedChunkSize)
 	if err != nil {
 		return nil, err
 	}
 	return cf.(io.ReadCloser), nil
 }
 
-func (cs *cipherStore) PutEncryptedFile(f fs.File, key []byte) (PutResult, error) {
+func (cs *cipherStore) PutEncryptedFile(f fs.File, suite ciphersuite.Suite, key []byte) (PutResult, error) {
 	fi, err := f.Stat()
 	if err != nil {
 		return PutResult{}, err
@@ -135,14 +152,9 @@ func (cs *cipherStore) PutEncryptedFile(f fs.File, key []byte) (PutResult, error
 		return PutResult{}, fmt.Errorf("cannot write encrypted directories")
 	}
 
-	auth, err := newAESGCMCipher(key)
-	if err != nil {
-		return PutResult{}, err
-	}
-
 	sr := &sizeReader{r: f}
 
-	nd, err := cs.putEncryptedFile(sr, auth)
+	nd, err := cs.putEncryptedFile(sr, suite, key)
 	if err != nil {
 		return PutResult{}, err
 	}
@@ -155,14 +167,14 @@ func (cs *cipherStore) PutEncryptedFile(f fs.File, key []byte) (PutResult, error
 	}, nil
 }
 
-func (cs *cipherStore) putEncryptedFile(r io.Reader, auth cipher.AEAD) (ipld.Node, error) {
+func (cs *cipherStore) putEncryptedFile(r io.Reader, suite ciphersuite.Suite, key []byte) (ipld.Node, error) {
 	prefix, err := merkledag.PrefixForCidVersion(1)
 	if err != nil {
 		return nil, err
 	}
 	prefix.MhType = mh.SHA2_256
 
-	spl, err := cipherchunker.NewCipherSplitter(r, auth, 1024*256)
+	spl, err := cipherchunker.NewCipherSplitter(r, suite, key, encryptedChunkSize)
 	if err != nil {
 		return nil, err
 	}
@@ -187,17 +199,109 @@ func (cs *cipherStore) putEncryptedFile(r io.Reader, auth cipher.AEAD) (ipld.Nod
 	return balanced.Layout(db)
 }
 
-func newCipher(key []byte) (cipher.AEAD, error) {
-	return newAESGCMCipher(key)
+// encryptedChunkSize is the size of each chunk of encrypted file content,
+// including the authentication tag
+const encryptedChunkSize = 1024 * 256
+
+// cipherLeafCodec encodes file contents as encrypted raw leaves, matching the
+// leaves written by PutEncryptedFile. Leaves are decrypted with dec &
+// encrypted with enc, which differ when re-encrypting file contents. Leaves
+// are sealed with their chunk index as the nonce counter
+type cipherLeafCodec struct {
+	dec   cipher.AEAD
+	enc   *ciphersuite.Sealer
+	key   []byte            // key of enc
+	suite ciphersuite.Suite // suite of enc
 }
 
-func newAESGCMCipher(key []byte) (cipher.AEAD, error) {
-	block, err := aes.NewCipher(key)
+var _ chunkpatch.Codec = (*cipherLeafCodec)(nil)
+
+// newCipherLeafCodec creates a codec encrypting with key. Edits keep the key
+// of the content they change, so leaf nonces are separated by the ratchet
+// position of the revision an edit starts from
+func newCipherLeafCodec(dec cipher.AEAD, suite ciphersuite.Suite, key []byte, position string) (*cipherLeafCodec, error) {
+	nonceContext := append(append([]byte(nil), cipherchunker.ContentNonceContext...), position...)
+	enc, err := suite.NewSealer(key, nonceContext)
 	if err != nil {
 		return nil, err
 	}
+	return &cipherLeafCodec{dec: dec, enc: enc, key: key, suite: suite}, nil
+}
 
-	return cipher.NewGCM(block)
+func (c *cipherLeafCodec) ChunkSize() int { return encryptedChunkSize - c.enc.Overhead() }
+
+func (c *cipherLeafCodec) EncodeLeaf(index int, data []byte) (ipld.Node, uint64, error) {
+	if index < 0 || uint64(index) > math.MaxUint32 {
+		return nil, 0, cipherchunker.ErrTooManyChunks
+	}
+	ciphertext := c.enc.Seal(make([]byte, 0, c.enc.NonceSize()+len(data)+c.enc.Overhead()), uint32(index), data, nil)
+	nd, err := merkledag.NewRawNodeWPrefix(ciphertext, chunkpatch.CidBuilder())
+	if err != nil {
+		return nil, 0, err
+	}
+	return nd, uint64(len(ciphertext)), nil
+}
+
+func (c *cipherLeafCodec) DecodeLeaf(nd ipld.Node) ([]byte, error) {
+	ciphertext := nd.RawData()
+	if len(ciphertext) == 0 {
+		// empty files are stored as a single unencrypted empty leaf
+		return nil, nil
+	}
+	if len(ciphertext) < c.dec.NonceSize() {
+		return nil, fmt.Errorf("leaf %s is too short to decrypt", nd.Cid())
+	}
+	return c.dec.Open(nil, ciphertext[:c.dec.NonceSize()], ciphertext[c.dec.NonceSize():], nil)
+}
+
+// revisionNonceContext is the nonce context of messages sealed with the key of
+// a revision. Revision keys are derived from ratchet positions & seal at most
+// one message per counter
+var revisionNonceContext = []byte("revision")
+
+// nonce counters of messages sealed with revision keys
+const (
+	sealHeader uint32 = iota // header of a node
+	sealLinks                // links of a tree
+)
+
+// seal encrypts plaintext with the AEAD of suite, authenticating ad as
+// associated data & prepending a nonce derived from counter, ad & plaintext
+func seal(suite ciphersuite.Suite, key []byte, counter uint32, ad, plaintext []byte) ([]byte, error) {
+	sealer, err := suite.NewSealer(key, revisionNonceContext)
+	if err != nil {
+		return nil, err
+	}
+	return sealer.Seal(make([]byte, 0, sealer.NonceSize()+len(plaintext)+sealer.Overhead()), counter, plaintext, ad), nil
+}
+
+// open decrypts data created by seal with the same associated data
+func open(suite ciphersuite.Suite, key, sealed, ad []byte) ([]byte, error) {
+	aead, err := suite.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], ad)
+}
+
+// openAnySuite decrypts data created by seal with any suite. Header info
+// records the suite of a node, but is itself encrypted, so the suite is found
+// by the first AEAD to authenticate the data
+func openAnySuite(key, sealed, ad []byte) ([]byte, ciphersuite.Suite, error) {
+	var firstErr error
+	for _, suite := range ciphersuite.Suites {
+		plaintext, err := open(suite, key, sealed, ad)
+		if err == nil {
+			return plaintext, suite, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, 0, firstErr
 }
 
 type sizeReader struct {
@@ -382,3 +486,168 @@ func MergeHAMTBlocks(ctx context.Context, src, dst Store) error {
 
 	return dst.HAMT().Write(ctx)
 }
+
+// copyNodeBlocks copies all blocks of the private hierarchy rooted at the node
+// named name from src to dst. Header blocks are opaque, so the blocks a node
+// links to can only be found by decrypting its header with key
+func copyNodeBlocks(ctx context.Context, src, dst Store, name Name, key Key) error {
+	var copyErr error
+	err := WalkBlocks(ctx, src, name, key, func(id cid.Cid) bool {
+		if copyErr != nil {
+			return false
+		}
+		has, err := dst.Blockservice().Blockstore().Has(ctx, id)
+		if err == nil && !has {
+			err = copyBlock(ctx, id, src, dst)
+		}
+		copyErr = err
+		// blocks already in dst may link to blocks that aren't
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return copyErr
+}
+
+// WalkBlocks calls visit with the CID of every block in the private hierarchy
+// rooted at the node named rootName: HAMT header blocks, & for each node
+// decryptable from the root, its header, metadata, encrypted links, file
+// content & prior revisions. Like base.WalkBlocks, blocks are only loaded &
+// their links followed when visit returns true
+func WalkBlocks(ctx context.Context, store Store, rootName Name, rootKey Key, visit func(id cid.Cid) bool) error {
+	return walkBlocks(ctx, store, rootName, rootKey, visit, false)
+}
+
+// WalkNewBlocks is WalkBlocks for a hierarchy that extends one already in a
+// blockstore. Nodes are only loaded when visit returns true for their header.
+// Headers visit returns false for were written earlier, along with every
+// block they reach, which spares decrypting the unchanged parts of a
+// hierarchy
+func WalkNewBlocks(ctx context.Context, store Store, rootName Name, rootKey Key, visit func(id cid.Cid) bool) error {
+	return walkBlocks(ctx, store, rootName, rootKey, visit, true)
+}
+
+func walkBlocks(ctx context.Context, store Store, rootName Name, rootKey Key, visit func(id cid.Cid) bool, skipVisited bool) error {
+	// headers of every revision written to the HAMT, including revisions that
+	// aren't reachable from the root
+	err := store.HAMT().Root().ForEach(ctx, func(k string, val *cbg.Deferred) error {
+		_, id, err := cid.CidFromBytes(val.Raw[2:])
+		if err != nil {
+			return err
+		}
+		visit(id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	id, err := cidFromPrivateName(ctx, store, rootName)
+	if err != nil {
+		return fmt.Errorf("finding private root: %w", err)
+	}
+	w := &blockWalker{
+		ctx:         ctx,
+		store:       store,
+		visit:       visit,
+		skipVisited: skipVisited,
+		nodes:       map[cid.Cid]struct{}{},
+		histories:   map[string]struct{}{},
+	}
+	return w.walkNode(id, rootKey, rootName)
+}
+
+type blockWalker struct {
+	ctx   context.Context
+	store Store
+	visit func(id cid.Cid) bool
+	// skipVisited skips loading nodes visit returns false for
+	skipVisited bool
+	// header CIDs of walked nodes. header blocks may already be visited from
+	// the HAMT, so nodes are tracked separately
+	nodes map[cid.Cid]struct{}
+	// encoded INumbers of nodes with walked histories
+	histories map[string]struct{}
+}
+
+func (w *blockWalker) walkNode(id cid.Cid, key Key, pn Name) error {
+	if _, ok := w.nodes[id]; ok {
+		return nil
+	}
+	w.nodes[id] = struct{}{}
+	if !w.visit(id) && w.skipVisited {
+		return nil
+	}
+
+	header, err := loadHeader(w.ctx, w.store, key, id, pn)
+	if err != nil {
+		return fmt.Errorf("loading header %s: %w", id, err)
+	}
+	if header.Metadata.Defined() {
+		w.visit(header.Metadata)
+	}
+
+	switch header.Info.Type {
+	case base.NTDir:
+		if !header.ContentID.Defined() || !w.visit(header.ContentID) {
+			break
+		}
+		blk, err := w.store.Blockservice().GetBlock(w.ctx, header.ContentID)
+		if err != nil {
+			return err
+		}
+		links, err := unmarshalPrivateLinksBlock(blk, header, key)
+		if err != nil {
+			return err
+		}
+		for _, l := range links {
+			if !l.Cid.Defined() {
+				continue
+			}
+			if err := w.walkNode(l.Cid, l.Key, l.Pointer); err != nil {
+				return err
+			}
+		}
+	case base.NTFile:
+		if header.ContentID.Defined() {
+			if err := base.WalkBlocks(w.ctx, w.store.Blockservice(), header.ContentID, w.visit); err != nil {
+				return err
+			}
+		}
+	}
+
+	return w.walkHistory(id, key, pn, header)
+}
+
+// walkHistory walks prior revisions of a node once per INumber
+func (w *blockWalker) walkHistory(id cid.Cid, key Key, pn Name, header Header) error {
+	in := header.Info.INumber.Encode()
+	if _, ok := w.histories[in]; ok {
+		return nil
+	}
+	w.histories[in] = struct{}{}
+
+	n, err := LoadNode(w.ctx, w.store, "", id, key, pn)
+	if err != nil {
+		return err
+	}
+	hist, err := history(w.ctx, n, -1)
+	if err != nil {
+		// history can only be walked for nodes with a known ratchet
+		if errors.Is(err, base.ErrNotFound) || errors.Is(err, ratchet.ErrRatchetNotFound) {
+			return nil
+		}
+		return err
+	}
+	for _, ent := range hist {
+		var k Key
+		if err := k.Decode(ent.Key); err != nil {
+			return err
+		}
+		if err := w.walkNode(ent.Cid, k, Name(ent.PrivateName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
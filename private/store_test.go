@@ -12,6 +12,7 @@ import (
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	base "github.com/functionland/wnfs-go/base"
 	mockblocks "github.com/functionland/wnfs-go/mockblocks"
+	ciphersuite "github.com/functionland/wnfs-go/private/ciphersuite"
 	ratchet "github.com/functionland/wnfs-go/private/ratchet"
 	assert "github.com/stretchr/testify/assert"
 	require "github.com/stretchr/testify/require"
@@ -25,13 +26,13 @@ func TestCopyBlocks(t *testing.T) {
 	storeB := newMemTestPrivateStore(ctx, t)
 	fileContents := []byte(bytes.Repeat([]byte("test"), 200000)) // large to make dag > 1 block
 
-	res, err := storeA.PutEncryptedFile(base.NewMemfileBytes("", fileContents), testRootKey[:])
+	res, err := storeA.PutEncryptedFile(base.NewMemfileBytes("", fileContents), ciphersuite.Default, testRootKey[:])
 	require.Nil(t, err)
 
 	err = CopyBlocks(ctx, res.Cid, storeA, storeB)
 	require.Nil(t, err)
 
-	data, err := storeB.GetEncryptedFile(res.Cid, testRootKey[:])
+	data, err := storeB.GetEncryptedFile(res.Cid, ciphersuite.Default, testRootKey[:])
 	require.Nil(t, err)
 
 	got, err := ioutil.ReadAll(data)
@@ -3,7 +3,6 @@ package public
 import (
 	"context"
 	"fmt"
-	"time"
 
 	base "github.com/functionland/wnfs-go/base"
 )
@@ -190,8 +189,8 @@ func mergeTrees(ctx context.Context, destStore Store, a, b *Tree) (*Tree, error)
 				Name:   n.Name(),
 				Size:   n.Size(),
 				Cid:    n.Cid(),
-				Mtime:  n.ModTime().Unix(),
-				IsFile: (n.Type() == base.NTFile || n.Type() == base.NTLDFile),
+				Mtime:  base.EncodeTimestamp(n.ModTime()),
+				IsFile: (n.Type() == base.NTFile || n.Type() == base.NTLDFile || n.Type() == base.NTSymlink),
 			})
 			checked[remName] = struct{}{}
 			continue
@@ -233,7 +232,7 @@ func mergeTrees(ctx context.Context, destStore Store, a, b *Tree) (*Tree, error)
 	}
 
 	a.h.Merge = &b.cid
-	a.h.Info.Mtime = base.Timestamp().Unix()
+	a.h.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
 	a.store = destStore
 	if _, err := a.Put(); err != nil {
 		return nil, err
@@ -265,7 +264,7 @@ func mergeNode(ctx context.Context, destStore Store, a, b base.Node) (merged bas
 			userland: a.userland,
 		}
 
-		tree.h.Info.Mtime = time.Now().Unix()
+		tree.h.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
 		_, err := a.Put()
 		return tree, err
 
@@ -289,6 +288,18 @@ func mergeNode(ctx context.Context, destStore Store, a, b base.Node) (merged bas
 			metadata: a.metadata,
 			content:  a.content,
 		}, nil
+	case *Symlink:
+		return &Symlink{
+			store: destStore,
+			name:  a.Name(),
+			cid:   a.cid,
+			h: &Header{
+				Info:     a.h.Info,
+				Merge:    &bid,
+				Previous: &a.cid,
+				Symlink:  a.h.Symlink,
+			},
+		}, nil
 	default:
 		return nil, fmt.Errorf("unknown type merging node %T", a)
 	}
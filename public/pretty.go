@@ -0,0 +1,429 @@
+package public
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	unixfs "github.com/ipfs/go-unixfs"
+	unixfsio "github.com/ipfs/go-unixfs/io"
+	multihash "github.com/multiformats/go-multihash"
+	base "github.com/functionland/wnfs-go/base"
+)
+
+// ErrReadOnlyPretty is returned when attempting to write to the pretty branch
+var ErrReadOnlyPretty = errors.New("pretty branch is read-only")
+
+// BuildPretty writes a plain UnixFS directory mirror of t, which stock IPFS
+// gateways can browse. prev & prevPretty are an earlier public tree & the
+// pretty mirror built from it. Subtrees with the same CID in both t & prev
+// reuse the existing mirror instead of being rebuilt. prev & prevPretty may be
+// cid.Undef, in which case the entire mirror is built
+func BuildPretty(ctx context.Context, store Store, t *Tree, prev, prevPretty cid.Cid) (cid.Cid, error) {
+	dserv := merkledag.NewDAGService(store.Blockservice())
+
+	var (
+		prevTree *Tree
+		prevDir  *merkledag.ProtoNode
+	)
+	if prev.Defined() && prevPretty.Defined() {
+		var err error
+		if prevTree, err = LoadTree(ctx, store, t.name, prev); err != nil {
+			return cid.Undef, fmt.Errorf("loading previous public tree: %w", err)
+		}
+		if prevDir, err = loadPrettyDir(ctx, dserv, prevPretty); err != nil {
+			return cid.Undef, fmt.Errorf("loading previous pretty directory: %w", err)
+		}
+	}
+
+	nd, err := buildPrettyDir(ctx, store, dserv, t, prevTree, prevDir)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return nd.Cid(), nil
+}
+
+func buildPrettyDir(ctx context.Context, store Store, dserv format.DAGService, t, prev *Tree, prevDir *merkledag.ProtoNode) (*merkledag.ProtoNode, error) {
+	dir := unixfs.EmptyDirNode()
+	dir.SetCidBuilder(prettyCidBuilder())
+
+	for _, link := range t.userland.SortedSlice() {
+		var prevLink *base.Link
+		if prev != nil && prevDir != nil {
+			prevLink = prev.userland.Get(link.Name)
+		}
+
+		// unchanged since the last build, reuse the existing mirror
+		if prevLink != nil && prevLink.Cid.Equals(link.Cid) {
+			if lk, _, err := prevDir.ResolveLink([]string{link.Name}); err == nil {
+				if err := dir.AddRawLink(link.Name, lk); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		n, err := loadNode(ctx, store, link.Name, link.Cid)
+		if err != nil {
+			return nil, err
+		}
+
+		var ch format.Node
+		switch n := n.(type) {
+		case *Tree:
+			var (
+				chPrev    *Tree
+				chPrevDir *merkledag.ProtoNode
+			)
+			if prevLink != nil {
+				chPrev, _ = LoadTree(ctx, store, link.Name, prevLink.Cid)
+				if lk, _, err := prevDir.ResolveLink([]string{link.Name}); err == nil {
+					chPrevDir, _ = loadPrettyDir(ctx, dserv, lk.Cid)
+				}
+			}
+			if ch, err = buildPrettyDir(ctx, store, dserv, n, chPrev, chPrevDir); err != nil {
+				return nil, err
+			}
+		case *File:
+			// file userland is already a unixfs DAG
+			if ch, err = dserv.Get(ctx, *n.h.Userland); err != nil {
+				return nil, err
+			}
+		case *LDFile:
+			if err = n.ensureContent(); err != nil {
+				return nil, err
+			}
+			res, err := store.PutFile(base.NewMemfileReader(link.Name, n.jsonContent))
+			n.jsonContent = nil
+			if err != nil {
+				return nil, err
+			}
+			if ch, err = dserv.Get(ctx, res.Cid); err != nil {
+				return nil, err
+			}
+		case *Symlink:
+			data, err := unixfs.SymlinkData(n.Target())
+			if err != nil {
+				return nil, err
+			}
+			nd := merkledag.NodeWithData(data)
+			nd.SetCidBuilder(prettyCidBuilder())
+			if err = dserv.Add(ctx, nd); err != nil {
+				return nil, err
+			}
+			ch = nd
+		default:
+			return nil, fmt.Errorf("unexpected node type building pretty branch: %T", n)
+		}
+
+		if err := dir.AddNodeLink(link.Name, ch); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := dserv.Add(ctx, dir); err != nil {
+		return nil, err
+	}
+	log.Debugw("wrote pretty directory", "name", t.name, "cid", dir.Cid())
+	return dir, nil
+}
+
+func prettyCidBuilder() cid.Builder {
+	prefix, _ := merkledag.PrefixForCidVersion(1)
+	prefix.MhType = multihash.SHA2_256
+	return prefix
+}
+
+func loadPrettyDir(ctx context.Context, dserv format.DAGService, id cid.Cid) (*merkledag.ProtoNode, error) {
+	nd, err := dserv.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	pn, ok := nd.(*merkledag.ProtoNode)
+	if !ok {
+		return nil, fmt.Errorf("expected %s to be a unixfs directory", id)
+	}
+	fsn, err := unixfs.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return nil, err
+	}
+	if !fsn.IsDir() {
+		return nil, fmt.Errorf("expected %s to be a unixfs directory", id)
+	}
+	return pn, nil
+}
+
+// PrettyTree is a read-only view of the pretty branch, a UnixFS mirror of the
+// public file hierarchy. UnixFS doesn't record modification times, so they're
+// read from the headers of the public nodes the mirror was built from
+type PrettyTree struct {
+	store Store
+	dserv format.DAGService
+	name  string
+	nd    *merkledag.ProtoNode
+	// skeleton of the public tree this directory mirrors, nil if unknown
+	skeleton Skeleton
+	mtime    int64
+	// offset is the number of entries read by ReadDir
+	offset int
+}
+
+var (
+	_ base.Tree      = (*PrettyTree)(nil)
+	_ fs.ReadDirFile = (*PrettyTree)(nil)
+)
+
+// LoadPrettyTree opens the pretty directory id, a mirror of the public tree
+// src. src may be cid.Undef, in which case modification times are unknown
+func LoadPrettyTree(ctx context.Context, store Store, name string, id, src cid.Cid) (*PrettyTree, error) {
+	dserv := merkledag.NewDAGService(store.Blockservice())
+	nd, err := loadPrettyDir(ctx, dserv, id)
+	if err != nil {
+		return nil, err
+	}
+	t := &PrettyTree{store: store, dserv: dserv, name: name, nd: nd}
+	if src.Defined() {
+		h, err := loadHeader(ctx, store.Blockservice(), src)
+		if err != nil {
+			return nil, fmt.Errorf("loading public source header %s: %w", src, err)
+		}
+		if t.skeleton, err = loadPrettySkeleton(ctx, store, h, nil); err != nil {
+			return nil, err
+		}
+		t.mtime = h.Info.Mtime
+	}
+	return t, nil
+}
+
+func (t *PrettyTree) Name() string               { return t.name }
+func (t *PrettyTree) Size() int64                { s, _ := t.nd.Size(); return int64(s) }
+func (t *PrettyTree) ModTime() time.Time         { return base.DecodeTimestamp(t.mtime) }
+func (t *PrettyTree) Mode() fs.FileMode          { return fs.ModeDir | 0555 }
+func (t *PrettyTree) Type() base.NodeType        { return base.NTUnixFSDir }
+func (t *PrettyTree) IsDir() bool                { return true }
+func (t *PrettyTree) Sys() interface{}           { return t.store }
+func (t *PrettyTree) Cid() cid.Cid               { return t.nd.Cid() }
+func (t *PrettyTree) Stat() (fs.FileInfo, error) { return t, nil }
+
+func (t *PrettyTree) Read(p []byte) (n int, err error) {
+	return 0, errors.New("cannot read directory")
+}
+func (t *PrettyTree) Close() error { return nil }
+
+// ReadDir reads the next n entries of t, returning io.EOF once all entries
+// are read. If n <= 0, ReadDir returns all remaining entries. Get returns a new
+// PrettyTree with its own read position for each open of a directory
+func (t *PrettyTree) ReadDir(n int) ([]fs.DirEntry, error) {
+	links := t.nd.Links()[t.offset:]
+	if n > 0 && len(links) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(links) {
+		n = len(links)
+	}
+	t.offset += n
+
+	entries := make([]fs.DirEntry, 0, n)
+	for _, lk := range links[:n] {
+		name := lk.Name
+		// entry types come from the source skeleton, file info is only loaded
+		// when asked for
+		isFile := true
+		if info, ok := t.skeleton[name]; ok {
+			isFile = info.IsFile
+		} else if _, err := loadPrettyDir(t.store.Context(), t.dserv, lk.Cid); err == nil {
+			isFile = false
+		}
+		entries = append(entries, base.NewFSDirEntryStat(name, isFile, func() (fs.FileInfo, error) {
+			f, err := t.Get(base.Path{name})
+			if err != nil {
+				return nil, err
+			}
+			return f.Stat()
+		}))
+	}
+	return entries, nil
+}
+
+func (t *PrettyTree) Metadata() (base.LDFile, error) { return nil, base.ErrNoLink }
+
+func (t *PrettyTree) AsHistoryEntry() base.HistoryEntry {
+	return base.HistoryEntry{
+		Cid:  t.nd.Cid(),
+		Type: base.NTUnixFSDir,
+		Size: t.Size(),
+	}
+}
+
+func (t *PrettyTree) History(ctx context.Context, max int) ([]base.HistoryEntry, error) {
+	return []base.HistoryEntry{t.AsHistoryEntry()}, nil
+}
+
+func (t *PrettyTree) Get(path base.Path) (fs.File, error) {
+	head, tail := path.Shift()
+	if head == "" {
+		open := *t
+		open.offset = 0
+		return &open, nil
+	}
+
+	nd, fsn, err := t.resolve(head)
+	if err != nil {
+		return nil, err
+	}
+
+	if fsn.IsDir() {
+		ch, err := t.childTree(head, nd)
+		if err != nil {
+			return nil, err
+		}
+		return ch.Get(tail)
+	}
+	if tail != nil {
+		return nil, fmt.Errorf("%q is not a directory", head)
+	}
+	if fsn.Type() == unixfs.TSymlink {
+		return nil, fmt.Errorf("%q is a symlink, symlinks in the pretty branch are not followed", head)
+	}
+
+	h, err := t.sourceHeader(head)
+	if err != nil {
+		return nil, err
+	}
+	r, err := unixfsio.NewDagReader(t.store.Context(), nd, t.dserv)
+	if err != nil {
+		return nil, err
+	}
+	f := &prettyFile{name: head, id: nd.Cid(), r: r}
+	if h != nil {
+		f.mtime = h.Info.Mtime
+	}
+	return f, nil
+}
+
+func (t *PrettyTree) Readlink(path base.Path) (string, error) {
+	head, tail := path.Shift()
+	nd, fsn, err := t.resolve(head)
+	if err != nil {
+		return "", err
+	}
+	if tail != nil {
+		if !fsn.IsDir() {
+			return "", fmt.Errorf("%q is not a directory", head)
+		}
+		ch, err := t.childTree(head, nd)
+		if err != nil {
+			return "", err
+		}
+		return ch.Readlink(tail)
+	}
+	if fsn.Type() != unixfs.TSymlink {
+		return "", fmt.Errorf("%q is not a symlink", head)
+	}
+	return string(fsn.Data()), nil
+}
+
+func (t *PrettyTree) resolve(name string) (format.Node, *unixfs.FSNode, error) {
+	lk, _, err := t.nd.ResolveLink([]string{name})
+	if err != nil {
+		return nil, nil, base.ErrNotFound
+	}
+	nd, err := t.dserv.Get(t.store.Context(), lk.Cid)
+	if err != nil {
+		return nil, nil, err
+	}
+	fsn, err := unixfs.ExtractFSNode(nd)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nd, fsn, nil
+}
+
+// childTree opens the pretty subdirectory name, loading the header of the
+// public tree it mirrors
+func (t *PrettyTree) childTree(name string, nd format.Node) (*PrettyTree, error) {
+	ch := &PrettyTree{store: t.store, dserv: t.dserv, name: name, nd: nd.(*merkledag.ProtoNode)}
+	h, err := t.sourceHeader(name)
+	if err != nil || h == nil {
+		return ch, err
+	}
+	if ch.skeleton, err = loadPrettySkeleton(t.store.Context(), t.store, h, t.skeleton[name].SubSkeleton); err != nil {
+		return nil, err
+	}
+	ch.mtime = h.Info.Mtime
+	return ch, nil
+}
+
+// sourceHeader loads the header of the public node the entry name mirrors.
+// the header is nil if the source isn't known
+func (t *PrettyTree) sourceHeader(name string) (*Header, error) {
+	info, ok := t.skeleton[name]
+	if !ok || !info.Cid.Defined() {
+		return nil, nil
+	}
+	h, err := loadHeader(t.store.Context(), t.store.Blockservice(), info.Cid)
+	if err != nil {
+		return nil, fmt.Errorf("loading public source header %s: %w", info.Cid, err)
+	}
+	return h, nil
+}
+
+// loadPrettySkeleton returns sk, or loads the skeleton of a public tree
+// header when sk is nil. merged trees don't carry the skeletons of their
+// subdirectories
+func loadPrettySkeleton(ctx context.Context, store Store, h *Header, sk Skeleton) (Skeleton, error) {
+	if sk != nil || h.Skeleton == nil {
+		return sk, nil
+	}
+	sk, err := LoadSkeleton(ctx, store, *h.Skeleton)
+	if err != nil {
+		return nil, fmt.Errorf("loading public source skeleton %s: %w", h.Skeleton, err)
+	}
+	return sk, nil
+}
+
+func (t *PrettyTree) Add(path base.Path, f fs.File) (base.PutResult, error) {
+	return nil, ErrReadOnlyPretty
+}
+func (t *PrettyTree) Copy(path base.Path, srcPath string, src fs.FS) (base.PutResult, error) {
+	return nil, ErrReadOnlyPretty
+}
+func (t *PrettyTree) Rm(path base.Path) (base.PutResult, error) {
+	return nil, ErrReadOnlyPretty
+}
+func (t *PrettyTree) Mkdir(path base.Path) (base.PutResult, error) {
+	return nil, ErrReadOnlyPretty
+}
+func (t *PrettyTree) Mv(from, to base.Path) (base.PutResult, error) {
+	return nil, ErrReadOnlyPretty
+}
+
+// prettyFile is a file opened from the pretty branch
+type prettyFile struct {
+	name  string
+	id    cid.Cid
+	r     unixfsio.DagReader
+	mtime int64
+}
+
+var _ base.FileInfo = (*prettyFile)(nil)
+
+func (f *prettyFile) Name() string               { return f.name }
+func (f *prettyFile) Size() int64                { return int64(f.r.Size()) }
+func (f *prettyFile) ModTime() time.Time         { return base.DecodeTimestamp(f.mtime) }
+func (f *prettyFile) Mode() fs.FileMode          { return 0444 }
+func (f *prettyFile) IsDir() bool                { return false }
+func (f *prettyFile) Sys() interface{}           { return nil }
+func (f *prettyFile) Type() base.NodeType        { return base.NTUnixFSFile }
+func (f *prettyFile) Cid() cid.Cid               { return f.id }
+func (f *prettyFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *prettyFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+func (f *prettyFile) Close() error               { return f.r.Close() }
+
+var _ io.ReadCloser = (*prettyFile)(nil)
@@ -9,6 +9,7 @@ import (
 	"io"
 	"io/fs"
 	"path/filepath"
+	"sync"
 	"time"
 
 	blocks "github.com/ipfs/go-block-format"
@@ -16,7 +17,9 @@ import (
 	cid "github.com/ipfs/go-cid"
 	cbornode "github.com/ipfs/go-ipld-cbor"
 	golog "github.com/ipfs/go-log"
+	merkledag "github.com/ipfs/go-merkledag"
 	base "github.com/functionland/wnfs-go/base"
+	chunkpatch "github.com/functionland/wnfs-go/chunkpatch"
 )
 
 var log = golog.Logger("wnfs")
@@ -28,6 +31,7 @@ type Header struct {
 	Metadata *cid.Cid
 	Skeleton *cid.Cid // only present on directories
 	Userland *cid.Cid
+	Symlink  string // link target, only present on symlinks
 }
 
 func loadHeader(ctx context.Context, bserv blockservice.BlockService, id cid.Cid) (*Header, error) {
@@ -60,6 +64,9 @@ func decodeHeaderBlock(blk blocks.Block) (*Header, error) {
 	h := &Header{
 		Info: InfoFromMap(info),
 	}
+	if target, ok := env["symlink"].(string); ok {
+		h.Symlink = target
+	}
 
 	for _, l := range nd.Links() {
 		switch l.Name {
@@ -91,6 +98,9 @@ func (h *Header) encodeBlock() (blocks.Block, error) {
 	if h.Info != nil {
 		LDFile["info"] = h.Info.Map()
 	}
+	if h.Symlink != "" {
+		LDFile["symlink"] = h.Symlink
+	}
 	return cbornode.WrapObject(LDFile, base.DefaultMultihashType, -1)
 }
 
@@ -126,11 +136,15 @@ type Info struct {
 }
 
 func NewInfo(t base.NodeType) *Info {
-	ts := base.Timestamp().Unix()
+	ts := base.EncodeTimestamp(base.Timestamp())
+	mode := uint32(base.ModeDefault)
+	if t == base.NTDir {
+		mode = base.ModeDirDefault
+	}
 	return &Info{
 		WNFS:  base.LatestVersion,
 		Type:  t,
-		Mode:  base.ModeDefault,
+		Mode:  mode,
 		Ctime: ts,
 		Mtime: ts,
 		Size:  0,
@@ -180,6 +194,14 @@ type Tree struct {
 	metadata *LDFile
 	skeleton Skeleton
 	userland base.Links // links to files are stored in "userland" Header key
+	// lk guards lazy loading of metadata by concurrent readers
+	lk sync.Mutex
+
+	// deferred trees mark themselves dirty on change instead of writing.
+	// modified child trees are kept in children & written bottom-up by Put
+	deferred bool
+	dirty    bool
+	children map[string]*Tree
 }
 
 var (
@@ -255,8 +277,9 @@ func (t *Tree) Links() base.Links          { return t.userland }
 func (t *Tree) Raw() []byte                { return nil }
 func (t *Tree) Name() string               { return t.name }
 func (t *Tree) Size() int64                { return t.h.Info.Size }
-func (t *Tree) ModTime() time.Time         { return time.Unix(t.h.Info.Ctime, 0) }
-func (t *Tree) Mode() fs.FileMode          { return fs.FileMode(t.h.Info.Mode) }
+func (t *Tree) ModTime() time.Time         { return base.DecodeTimestamp(t.h.Info.Mtime) }
+func (t *Tree) Ctime() time.Time           { return base.DecodeTimestamp(t.h.Info.Ctime) }
+func (t *Tree) Mode() fs.FileMode          { return fs.ModeDir | base.DecodeMode(t.h.Info.Mode) }
 func (t *Tree) Type() base.NodeType        { return t.h.Info.Type }
 func (t *Tree) IsDir() bool                { return true }
 func (t *Tree) Sys() interface{}           { return t.store }
@@ -269,6 +292,8 @@ func (t *Tree) SetMetadata(md interface{}) error {
 }
 
 func (t *Tree) Metadata() (f base.LDFile, err error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
 	if t.metadata == nil && t.h.Metadata != nil {
 		t.metadata, err = LoadLDFile(t.store.Context(), t.store, base.MetadataLinkName, *t.h.Metadata)
 	}
@@ -280,18 +305,30 @@ func (t *Tree) Read(p []byte) (n int, err error) {
 }
 func (t *Tree) Close() error { return nil }
 
+// ReadDir lists the first n entries of t sorted by name, or all entries if
+// n <= 0. Trees are shared between opens & don't track a read position.
+// Entry info is loaded on demand & doesn't follow symlinks
 func (t *Tree) ReadDir(n int) ([]fs.DirEntry, error) {
-	if n < 0 {
-		n = t.userland.Len()
+	links := t.userland.SortedSlice()
+	if n <= 0 || n > len(links) {
+		n = len(links)
 	}
 
 	entries := make([]fs.DirEntry, 0, n)
-	for i, link := range t.userland.SortedSlice() {
-		entries = append(entries, base.NewFSDirEntry(link.Name, link.IsFile))
-
-		if i == n {
-			break
+	for _, link := range links[:n] {
+		name := link.Name
+		// links decoded from userland blocks don't record a type, the skeleton does
+		isFile := link.IsFile
+		if si, ok := t.skeleton[name]; ok {
+			isFile = si.IsFile
 		}
+		entries = append(entries, base.NewFSDirEntryStat(name, isFile, func() (fs.FileInfo, error) {
+			f, err := t.get(base.Path{name}, false)
+			if err != nil {
+				return nil, err
+			}
+			return f.Stat()
+		}))
 	}
 	return entries, nil
 }
@@ -300,29 +337,90 @@ func (t *Tree) Skeleton() (Skeleton, error) {
 	return t.skeleton, nil
 }
 
+// Get opens the node at path, following any symlinks encountered along the
+// way. Absolute symlink targets resolve relative to t
 func (t *Tree) Get(path base.Path) (fs.File, error) {
-	ctx := context.TODO()
-	head, tail := path.Shift()
-	if head == "" {
-		return t, nil
-	}
+	return t.get(path, true)
+}
 
-	link := t.userland.Get(head)
-	if link == nil {
-		return nil, base.ErrNotFound
+// Readlink returns the target of the symlink at path
+func (t *Tree) Readlink(path base.Path) (string, error) {
+	f, err := t.get(path, false)
+	if err != nil {
+		return "", err
 	}
+	sl, ok := f.(*Symlink)
+	if !ok {
+		return "", fmt.Errorf("%q is not a symlink", path)
+	}
+	return sl.Target(), nil
+}
 
-	if tail != nil {
-		ch, err := LoadTree(ctx, t.store, head, link.Cid)
-		if err != nil {
+// get resolves path, following symlinks for all intermediate path components.
+// the final path component is followed only if follow is true
+func (t *Tree) get(path base.Path, follow bool) (fs.File, error) {
+	var (
+		ctx      = context.TODO()
+		dirs     = []*Tree{t}
+		seen     = map[string]struct{}{}
+		followed = 0
+		err      error
+	)
+
+	for len(path) > 0 {
+		head, tail := path.Shift()
+		path = tail
+		switch head {
+		case "", ".":
+			continue
+		case "..":
+			if len(dirs) > 1 {
+				dirs = dirs[:len(dirs)-1]
+			}
+			continue
+		}
+
+		dir := dirs[len(dirs)-1]
+		link := dir.userland.Get(head)
+		if link == nil {
+			return nil, base.ErrNotFound
+		}
+		var n base.Node
+		if ch, ok := dir.children[head]; ok {
+			n = ch
+		} else if n, err = loadNode(ctx, t.store, head, link.Cid); err != nil {
 			return nil, err
 		}
 
-		// recurse
-		return ch.Get(tail)
+		if sl, ok := n.(*Symlink); ok && (follow || len(path) > 0) {
+			key := sl.Cid().String() + ":" + path.String()
+			if _, ok := seen[key]; ok {
+				return nil, base.ErrSymlinkLoop
+			}
+			seen[key] = struct{}{}
+			if followed++; followed > base.MaxSymlinkDepth {
+				return nil, fmt.Errorf("following more than %d symlinks: %w", base.MaxSymlinkDepth, base.ErrSymlinkLoop)
+			}
+
+			target, abs := base.SymlinkPath(sl.Target())
+			if abs {
+				dirs = dirs[:1]
+			}
+			path = append(target, path...)
+			continue
+		}
+
+		if len(path) == 0 {
+			return n, nil
+		}
+		ch, ok := n.(*Tree)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a directory", head)
+		}
+		dirs = append(dirs, ch)
 	}
 
-	return loadNode(ctx, t.store, link.Name, link.Cid)
+	return dirs[len(dirs)-1], nil
 }
 
 func (t *Tree) AsHistoryEntry() base.HistoryEntry {
@@ -347,19 +445,19 @@ func (t *Tree) Mkdir(path base.Path) (res base.PutResult, err error) {
 	}
 
 	if tail == nil {
-		res, err = childDir.Put()
+		res, err = childDir.changed()
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		res, err = t.Mkdir(tail)
+		res, err = childDir.Mkdir(tail)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	t.updateUserlandLink(head, res)
-	return t.Put()
+	return t.changed()
 }
 
 func (t *Tree) Add(path base.Path, f fs.File) (res base.PutResult, err error) {
@@ -387,12 +485,9 @@ func (t *Tree) Add(path base.Path, f fs.File) (res base.PutResult, err error) {
 	}
 
 	t.updateUserlandLink(head, res)
-	// contents of tree have changed, write an update.
-	// TODO(b5) - pretty sure this is a bug if multiple writes are batched in the
-	// same "publish" / transaction. Write advances the previous / current CID,
-	// so if the same directory is mutated multiple times before the next snapshot
-	// we'll have intermediate states as the "previous" pointer
-	return t.Put()
+	// contents of tree have changed, write an update. deferred trees batch
+	// updates until the next Put
+	return t.changed()
 }
 
 func (t *Tree) Copy(path base.Path, srcPathStr string, srcFS fs.FS) (res base.PutResult, err error) {
@@ -426,16 +521,12 @@ func (t *Tree) Copy(path base.Path, srcPathStr string, srcFS fs.FS) (res base.Pu
 	}
 
 	t.updateUserlandLink(head, res)
-	// contents of tree have changed, write an update.
-	// TODO(b5) - pretty sure this is a bug if multiple writes are batched in the
-	// same "publish" / transaction. Write advances the previous / current CID,
-	// so if the same directory is mutated multiple times before the next snapshot
-	// we'll have intermediate states as the "previous" pointer
-	return t.Put()
+	// contents of tree have changed, write an update. deferred trees batch
+	// updates until the next Put
+	return t.changed()
 }
 
 func (t *Tree) Rm(path base.Path) (base.PutResult, error) {
-	ctx := context.TODO()
 	head, tail := path.Shift()
 	if head == "" {
 		return PutResult{}, fmt.Errorf("invalid path: empty")
@@ -448,7 +539,7 @@ func (t *Tree) Rm(path base.Path) (base.PutResult, error) {
 		if link == nil {
 			return PutResult{}, base.ErrNotFound
 		}
-		child, err := LoadTree(ctx, t.store, head, link.Cid)
+		child, err := t.childTree(head, link.Cid)
 		if err != nil {
 			return nil, err
 		}
@@ -462,13 +553,435 @@ func (t *Tree) Rm(path base.Path) (base.PutResult, error) {
 	}
 
 	// contents of tree have changed, write an update.
-	return t.Put()
+	return t.changed()
+}
+
+// Mv relinks the node at from to the path to. The moved node itself isn't
+// rewritten, so it keeps its CID & history. Only directories along the paths
+// of from and to are updated
+func (t *Tree) Mv(from, to base.Path) (base.PutResult, error) {
+	fromHead, fromTail := from.Shift()
+	toHead, toTail := to.Shift()
+	if fromHead == "" || toHead == "" {
+		return nil, fmt.Errorf("invalid path: empty")
+	}
+
+	if fromHead == toHead && fromTail != nil && toTail != nil {
+		// both paths share this child directory, recurse
+		link := t.userland.Get(fromHead)
+		if link == nil {
+			return nil, base.ErrNotFound
+		}
+		child, err := t.childTree(fromHead, link.Cid)
+		if err != nil {
+			return nil, err
+		}
+		res, err := child.Mv(fromTail, toTail)
+		if err != nil {
+			return nil, err
+		}
+		t.updateUserlandLink(fromHead, res)
+		return t.changed()
+	}
+
+	// detach modifies the tree, check to before anything is removed
+	if err := t.checkAttach(to); err != nil {
+		return nil, err
+	}
+	lk, err := t.detach(from)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.attach(to, lk); err != nil {
+		return nil, err
+	}
+
+	// contents of tree have changed, write an update.
+	return t.changed()
+}
+
+// detachedLink is a link removed from a tree, retained for re-attaching
+type detachedLink struct {
+	link     base.Link
+	skeleton SkeletonInfo
+}
+
+// detach removes the link at path, writing updates to all descendant trees
+// along path. t itself is modified but not written
+func (t *Tree) detach(path base.Path) (dl detachedLink, err error) {
+	head, tail := path.Shift()
+	link := t.userland.Get(head)
+	if link == nil {
+		return dl, base.ErrNotFound
+	}
+
+	if tail == nil {
+		// detached links must point to written nodes
+		if ch, ok := t.children[head]; ok && ch.dirty {
+			res, err := ch.Put()
+			if err != nil {
+				return dl, err
+			}
+			t.updateUserlandLink(head, res)
+			link = t.userland.Get(head)
+		}
+		dl = detachedLink{link: *link, skeleton: t.skeleton[head]}
+		t.removeUserlandLink(head)
+		return dl, nil
+	}
+
+	child, err := t.childTree(head, link.Cid)
+	if err != nil {
+		return dl, err
+	}
+	if dl, err = child.detach(tail); err != nil {
+		return dl, err
+	}
+	res, err := child.changed()
+	if err != nil {
+		return dl, err
+	}
+	t.updateUserlandLink(head, res)
+	return dl, nil
+}
+
+// checkAttach returns an error if a link can't be attached at path, which is
+// the case when a parent along path exists & isn't a directory
+func (t *Tree) checkAttach(path base.Path) error {
+	head, tail := path.Shift()
+	if tail == nil {
+		return nil
+	}
+	link := t.userland.Get(head)
+	if link == nil {
+		// missing directories are created
+		return nil
+	}
+	isFile := link.IsFile
+	if si, ok := t.skeleton[head]; ok {
+		isFile = si.IsFile
+	}
+	if isFile {
+		return fmt.Errorf("%q is not a directory", head)
+	}
+	child, err := t.childTree(head, link.Cid)
+	if err != nil {
+		return err
+	}
+	return child.checkAttach(tail)
+}
+
+// attach adds a detached link at path, creating any missing directories.
+// attach writes updates to all descendant trees along path. t itself is
+// modified but not written
+func (t *Tree) attach(path base.Path, dl detachedLink) error {
+	head, tail := path.Shift()
+	if tail == nil {
+		dl.link.Name = head
+		t.userland.Add(dl.link)
+		t.skeleton[head] = dl.skeleton
+		t.h.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+		t.h.Merge = nil
+		return nil
+	}
+
+	child, err := t.getOrCreateDirectChildTree(head)
+	if err != nil {
+		return err
+	}
+	if err = child.attach(tail, dl); err != nil {
+		return err
+	}
+	res, err := child.changed()
+	if err != nil {
+		return err
+	}
+	t.updateUserlandLink(head, res)
+	return nil
+}
+
+// Restore writes the historical version of a node stored at id to path as a
+// new revision, creating any missing directories. The new revision's previous
+// link points to the restored version. If a different node exists at path it's
+// recorded as the merge link, so no history is lost
+func (t *Tree) Restore(path base.Path, id cid.Cid) (base.PutResult, error) {
+	ctx := context.TODO()
+	head, tail := path.Shift()
+	if head == "" {
+		return nil, fmt.Errorf("invalid path: empty")
+	}
+
+	if tail != nil {
+		child, err := t.getOrCreateDirectChildTree(head)
+		if err != nil {
+			return nil, err
+		}
+		res, err := child.Restore(tail, id)
+		if err != nil {
+			return nil, err
+		}
+		t.updateUserlandLink(head, res)
+		return t.changed()
+	}
+
+	n, err := loadNode(ctx, t.store, head, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var merge *cid.Cid
+	if link := t.userland.Get(head); link != nil && !link.Cid.Equals(id) {
+		cur := link.Cid
+		merge = &cur
+	}
+
+	var res base.PutResult
+	switch n := n.(type) {
+	case *File:
+		if err = n.ensureContent(); err != nil {
+			return nil, err
+		}
+		n.h.Merge = merge
+		n.h.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+		res, err = n.Put()
+	case *Tree:
+		n.h.Merge = merge
+		n.h.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+		res, err = n.Put()
+	case *Symlink:
+		n.h.Merge = merge
+		n.h.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+		res, err = n.Put()
+	default:
+		return nil, fmt.Errorf("cannot restore node of type %T", n)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t.updateUserlandLink(head, res)
+	return t.changed()
+}
+
+// Chmod sets the permission bits of the node at path. Chmod changes the node
+// itself, symlinks aren't followed. An empty path changes t
+func (t *Tree) Chmod(path base.Path, mode fs.FileMode) (base.PutResult, error) {
+	return t.setInfo(path, func(i *Info) { i.Mode = base.EncodeMode(mode) })
+}
+
+// Chtimes sets the modification time of the node at path, stored with
+// millisecond precision. Chtimes changes the node itself, symlinks aren't
+// followed. An empty path changes t
+func (t *Tree) Chtimes(path base.Path, mtime time.Time) (base.PutResult, error) {
+	return t.setInfo(path, func(i *Info) { i.Mtime = base.EncodeTimestamp(mtime) })
+}
+
+// setInfo applies update to the header info of the node at path, writing it
+// as a new revision
+func (t *Tree) setInfo(path base.Path, update func(i *Info)) (base.PutResult, error) {
+	if len(path) == 0 {
+		update(t.h.Info)
+		return t.changed()
+	}
+
+	head, tail := path.Shift()
+	link := t.userland.Get(head)
+	if link == nil {
+		return nil, base.ErrNotFound
+	}
+
+	var (
+		res base.PutResult
+		err error
+	)
+	if tail != nil {
+		child, err := t.childTree(head, link.Cid)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = child.setInfo(tail, update); err != nil {
+			return nil, err
+		}
+	} else if ch, ok := t.children[head]; ok {
+		update(ch.h.Info)
+		if res, err = ch.changed(); err != nil {
+			return nil, err
+		}
+	} else {
+		n, err := loadNode(context.TODO(), t.store, head, link.Cid)
+		if err != nil {
+			return nil, err
+		}
+		switch n := n.(type) {
+		case *Tree:
+			t.cacheChild(head, n)
+			update(n.h.Info)
+			res, err = n.changed()
+		case *File:
+			update(n.h.Info)
+			res, err = n.Put()
+		case *Symlink:
+			update(n.h.Info)
+			res, err = n.Put()
+		case *LDFile:
+			if n.info == nil {
+				return nil, fmt.Errorf("%q has no header info", head)
+			}
+			update(n.info)
+			res, err = n.Put()
+		default:
+			return nil, fmt.Errorf("cannot change %q, unexpected node type %T", head, n)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// keep the parent's modification time, only the node at path has changed
+	mtime := t.h.Info.Mtime
+	t.updateUserlandLink(head, res)
+	t.h.Info.Mtime = mtime
+	return t.changed()
+}
+
+// OpenPatch opens the contents of the file at path for random-access editing.
+// Edits are held in memory until written with ApplyPatch
+func (t *Tree) OpenPatch(path base.Path) (*chunkpatch.File, error) {
+	head, tail := path.Shift()
+	if head == "" {
+		return nil, errors.New("invalid path: empty")
+	}
+	link := t.userland.Get(head)
+	if link == nil {
+		return nil, base.ErrNotFound
+	}
+
+	if tail != nil {
+		child, err := t.childTree(head, link.Cid)
+		if err != nil {
+			return nil, err
+		}
+		return child.OpenPatch(tail)
+	}
+
+	n, err := loadNode(context.TODO(), t.store, head, link.Cid)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := n.(*File)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a file", head)
+	}
+	return f.OpenPatch()
+}
+
+// ApplyPatch writes the edited contents of p to the file at path as a new
+// revision. Only leaves changed by p are written, all others are shared with
+// the prior revision. ApplyPatch fails with chunkpatch.ErrBaseChanged if the
+// file has been written since p was opened
+func (t *Tree) ApplyPatch(path base.Path, p *chunkpatch.File) (res base.PutResult, err error) {
+	head, tail := path.Shift()
+	if head == "" {
+		return nil, errors.New("invalid path: empty")
+	}
+	link := t.userland.Get(head)
+	if link == nil {
+		return nil, base.ErrNotFound
+	}
+
+	if tail != nil {
+		child, err := t.childTree(head, link.Cid)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = child.ApplyPatch(tail, p); err != nil {
+			return nil, err
+		}
+	} else {
+		n, err := loadNode(context.TODO(), t.store, head, link.Cid)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := n.(*File)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a file", head)
+		}
+		if res, err = f.applyPatch(p); err != nil {
+			return nil, err
+		}
+	}
+
+	t.updateUserlandLink(head, res)
+	return t.changed()
+}
+
+// SetDeferred sets whether t defers writes. Deferred trees record changes in
+// memory & write all modified descendant trees bottom-up on the next call to
+// Put, instead of writing on every change. Child trees inherit the setting
+func (t *Tree) SetDeferred(deferred bool) { t.deferred = deferred }
+
+// Dirty returns true if t has changes that have not been written
+func (t *Tree) Dirty() bool { return t.dirty }
+
+// changed records a modification to t, writing t unless writes are deferred
+func (t *Tree) changed() (base.PutResult, error) {
+	if !t.deferred {
+		return t.Put()
+	}
+	t.dirty = true
+	res := PutResult{
+		Cid:      t.cid,
+		Size:     t.h.Info.Size,
+		Type:     base.NTDir,
+		Skeleton: t.skeleton,
+	}
+	if t.h.Userland != nil {
+		res.Userland = *t.h.Userland
+	}
+	return res, nil
+}
+
+// childTree loads the child tree linked as name, reusing trees with deferred
+// changes
+func (t *Tree) childTree(name string, id cid.Cid) (*Tree, error) {
+	if ch, ok := t.children[name]; ok {
+		return ch, nil
+	}
+	ch, err := LoadTree(context.TODO(), t.store, name, id)
+	if err != nil {
+		return nil, err
+	}
+	t.cacheChild(name, ch)
+	return ch, nil
+}
+
+func (t *Tree) cacheChild(name string, ch *Tree) {
+	if !t.deferred {
+		return
+	}
+	ch.deferred = true
+	if t.children == nil {
+		t.children = map[string]*Tree{}
+	}
+	t.children[name] = ch
 }
 
 func (t *Tree) Put() (base.PutResult, error) {
 	store := t.store
 	ctx := context.TODO()
 
+	// write deferred changes to child trees
+	for name, ch := range t.children {
+		if !ch.dirty {
+			continue
+		}
+		res, err := ch.Put()
+		if err != nil {
+			return nil, err
+		}
+		t.updateUserlandLink(name, res)
+	}
+
 	blk, err := t.userland.EncodeBlock()
 	if err != nil {
 		return nil, err
@@ -511,11 +1024,13 @@ func (t *Tree) Put() (base.PutResult, error) {
 	}
 
 	t.cid = blk.Cid()
+	t.dirty = false
 	log.Debugw("wrote public tree", "name", t.name, "cid", t.cid.String(), "userlandLinkCount", t.userland.Len(), "size", t.h.Info.Size, "prev", t.h.Previous)
 
 	return PutResult{
 		Cid:  t.cid,
 		Size: t.h.Info.Size,
+		Type: base.NTDir,
 		// Metadata: *t.h.Metadata,
 		Userland: *t.h.Userland,
 		Skeleton: t.skeleton,
@@ -569,12 +1084,16 @@ func loadHistoryEntry(ctx context.Context, bserv blockservice.BlockService, id c
 }
 
 func (t *Tree) getOrCreateDirectChildTree(name string) (*Tree, error) {
-	ctx := context.TODO()
+	if ch, ok := t.children[name]; ok {
+		return ch, nil
+	}
 	link := t.userland.Get(name)
 	if link == nil {
-		return NewEmptyTree(t.store, name), nil
+		ch := NewEmptyTree(t.store, name)
+		t.cacheChild(name, ch)
+		return ch, nil
 	}
-	return LoadTree(ctx, t.store, name, link.Cid)
+	return t.childTree(name, link.Cid)
 }
 
 func (t *Tree) createOrUpdateChild(srcPathStr, name string, f fs.File, srcFS fs.FS) (base.PutResult, error) {
@@ -593,7 +1112,6 @@ func (t *Tree) createOrUpdateChild(srcPathStr, name string, f fs.File, srcFS fs.
 }
 
 func (t *Tree) createOrUpdateChildDirectory(srcPathStr, name string, f fs.File, srcFS fs.FS) (base.PutResult, error) {
-	ctx := context.TODO()
 	dir, ok := f.(fs.ReadDirFile)
 	if !ok {
 		return nil, fmt.Errorf("cannot read directory contents")
@@ -603,14 +1121,13 @@ func (t *Tree) createOrUpdateChildDirectory(srcPathStr, name string, f fs.File,
 		return nil, fmt.Errorf("reading directory contents: %w", err)
 	}
 
-	var tree *Tree
-	if link := t.userland.Get(name); link != nil {
-		tree, err = LoadTree(ctx, t.store, name, link.Cid)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		tree = NewEmptyTree(t.store, name)
+	tree, err := t.getOrCreateDirectChildTree(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ents) == 0 {
+		return tree.changed()
 	}
 
 	var res base.PutResult
@@ -649,15 +1166,24 @@ func (t *Tree) createOrUpdateChildFile(name string, f fs.File) (base.PutResult,
 	if sdFile, ok := f.(base.LDFile); ok {
 		return t.createOrUpdateChildLDFile(name, sdFile)
 	}
+	if sl, ok := f.(base.Symlink); ok {
+		return t.createOrUpdateChildSymlink(name, sl.Target())
+	}
 
 	if link := t.userland.Get(name); link != nil {
-		previousFile, err := LoadFile(ctx, t.store, name, link.Cid)
+		n, err := loadNode(ctx, t.store, name, link.Cid)
 		if err != nil {
 			return nil, err
 		}
 
-		previousFile.SetFile(f)
-		return previousFile.Put()
+		switch prev := n.(type) {
+		case *File:
+			prev.SetFile(f)
+			return prev.Put()
+		case *Tree:
+			return nil, fmt.Errorf("cannot write file %q over a directory", name)
+		}
+		// writing a file over a symlink or data file replaces it
 	}
 
 	ch, err := NewFile(t.store, name, f)
@@ -667,18 +1193,42 @@ func (t *Tree) createOrUpdateChildFile(name string, f fs.File) (base.PutResult,
 	return ch.Put()
 }
 
+func (t *Tree) createOrUpdateChildSymlink(name, target string) (base.PutResult, error) {
+	ctx := context.TODO()
+	if link := t.userland.Get(name); link != nil {
+		n, err := loadNode(ctx, t.store, name, link.Cid)
+		if err != nil {
+			return nil, err
+		}
+		switch prev := n.(type) {
+		case *Symlink:
+			prev.SetTarget(target)
+			return prev.Put()
+		case *Tree:
+			return nil, fmt.Errorf("cannot write symlink %q over a directory", name)
+		}
+	}
+
+	return NewSymlink(t.store, name, target).Put()
+}
+
 func (t *Tree) updateUserlandLink(name string, res base.PutResult) {
 	log.Debugw("updateUserlandLink", "name", name, "cid", res.CID())
+	if ch, ok := t.children[name]; ok && !ch.cid.Equals(res.CID()) {
+		// child tree has been replaced
+		delete(t.children, name)
+	}
 	t.userland.Add(res.ToLink(name))
 	t.skeleton[name] = res.(PutResult).ToSkeletonInfo()
-	t.h.Info.Mtime = base.Timestamp().Unix()
+	t.h.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
 	t.h.Merge = nil // clear merge field in the case where we're mutating after a merge commit
 }
 
 func (t *Tree) removeUserlandLink(name string) {
+	delete(t.children, name)
 	t.userland.Remove(name)
 	delete(t.skeleton, name)
-	t.h.Info.Mtime = base.Timestamp().Unix()
+	t.h.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
 	t.h.Merge = nil // clear merge field in the case where we're mutating after a merge commit
 }
 
@@ -690,6 +1240,7 @@ type File struct {
 
 	metadata *LDFile
 	content  io.ReadCloser
+	readerAt *base.ReaderAt
 }
 
 var (
@@ -703,12 +1254,13 @@ func NewFile(store Store, name string, content io.ReadCloser) (*File, error) {
 	var meta interface{}
 	if mdn, ok := content.(base.Metadata); ok {
 		md, err := mdn.Metadata()
-		if err != nil {
+		if err != nil && !errors.Is(err, base.ErrNoLink) {
 			return nil, err
 		}
-		meta, err = md.Data()
-		if err != nil {
-			return nil, err
+		if err == nil {
+			if meta, err = md.Data(); err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -722,15 +1274,16 @@ func NewFileMetadata(store Store, name string, content io.ReadCloser, meta inter
 		md = NewBareLDFile(store, base.MetadataLinkName, meta)
 	}
 
-	return &File{
+	f := &File{
 		store:    store,
 		name:     name,
-		content:  content,
 		metadata: md,
 		h: &Header{
 			Info: NewInfo(base.NTFile),
 		},
-	}, nil
+	}
+	f.setContent(content)
+	return f, nil
 }
 
 func LoadFile(ctx context.Context, store Store, name string, id cid.Cid) (*File, error) {
@@ -770,8 +1323,9 @@ func fileFromHeader(ctx context.Context, store Store, h *Header, name string, id
 func (f *File) Links() base.Links          { return base.NewLinks() }
 func (f *File) Name() string               { return f.name }
 func (f *File) Size() int64                { return f.h.Info.Size }
-func (f *File) ModTime() time.Time         { return time.Unix(f.h.Info.Mtime, 0) }
-func (f *File) Mode() fs.FileMode          { return fs.FileMode(f.h.Info.Mode) }
+func (f *File) ModTime() time.Time         { return base.DecodeTimestamp(f.h.Info.Mtime) }
+func (f *File) Ctime() time.Time           { return base.DecodeTimestamp(f.h.Info.Ctime) }
+func (f *File) Mode() fs.FileMode          { return base.DecodeMode(f.h.Info.Mode) }
 func (f *File) Type() base.NodeType        { return f.h.Info.Type }
 func (f *File) IsDir() bool                { return false }
 func (f *File) Sys() interface{}           { return f.store }
@@ -799,10 +1353,36 @@ func (f *File) History(ctx context.Context, maxRevs int) ([]base.HistoryEntry, e
 }
 
 func (f *File) Read(p []byte) (n int, err error) {
-	f.ensureContent()
+	if err = f.ensureContent(); err != nil {
+		return 0, err
+	}
 	return f.content.Read(p)
 }
 
+// Seek sets the offset for the next Read of file contents. Files loaded from
+// the store support seeking, fetching only the blocks needed by later reads
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if err := f.ensureContent(); err != nil {
+		return 0, err
+	}
+	return base.Seek(f.content, offset, whence)
+}
+
+// ReadAt reads len(p) bytes of the stored file contents starting at off,
+// using a reader separate from Read
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if f.readerAt == nil {
+		r, err := f.store.GetFile(f.store.Context(), *f.h.Userland)
+		if err != nil {
+			return 0, err
+		}
+		if f.readerAt, err = base.NewReaderAt(r); err != nil {
+			return 0, err
+		}
+	}
+	return f.readerAt.ReadAt(p, off)
+}
+
 func (f *File) ensureContent() (err error) {
 	if f.content == nil {
 		ctx := f.store.Context()
@@ -812,14 +1392,20 @@ func (f *File) ensureContent() (err error) {
 }
 
 func (f *File) Close() error {
+	if f.readerAt != nil {
+		f.readerAt.Close()
+		f.readerAt = nil
+	}
 	if closer, ok := f.content.(io.Closer); ok {
 		return closer.Close()
 	}
 	return nil
 }
 
+// SetFile replaces the contents of f with r. If r is an fs.File its mode &
+// modification time are recorded
 func (f *File) SetFile(r io.ReadCloser) {
-	f.content = r
+	f.setContent(r)
 
 	if mdn, ok := r.(base.Metadata); ok {
 		md, err := mdn.Metadata()
@@ -834,15 +1420,45 @@ func (f *File) SetFile(r io.ReadCloser) {
 	}
 }
 
+func (f *File) setContent(r io.ReadCloser) {
+	f.content = r
+	var fi fs.FileInfo
+	if sf, ok := r.(fs.File); ok {
+		fi, _ = sf.Stat()
+	}
+	f.h.Info.Mode, f.h.Info.Mtime = base.SourceAttrs(fi, f.h.Info.Mode)
+}
+
+// countReader counts bytes read from r
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Put writes f. Files loaded from the store that haven't been read or given
+// new contents keep their existing contents
 func (f *File) Put() (base.PutResult, error) {
 	store := f.store
 	ctx := context.TODO()
 
-	userlandRes, err := store.PutFile(base.NewMemfileReader("", f.content))
-	if err != nil {
-		return PutResult{}, fmt.Errorf("putting file %q in store: %w", f.name, err)
+	if f.content != nil || f.h.Userland == nil {
+		if f.content == nil {
+			return nil, fmt.Errorf("file %q has no contents", f.name)
+		}
+		content := &countReader{r: f.content}
+		userlandRes, err := store.PutFile(base.NewMemfileReader("", content))
+		if err != nil {
+			return PutResult{}, fmt.Errorf("putting file %q in store: %w", f.name, err)
+		}
+		f.h.Userland = &userlandRes.Cid
+		f.h.Info.Size = content.n
 	}
-	f.h.Userland = &userlandRes.Cid
 
 	if f.metadata != nil {
 		log.Debugw("putting meta", "name", f.name)
@@ -878,6 +1494,30 @@ func (f *File) Put() (base.PutResult, error) {
 	}, nil
 }
 
+// OpenPatch opens the contents of f for random-access editing
+func (f *File) OpenPatch() (*chunkpatch.File, error) {
+	dag := merkledag.NewDAGService(f.store.Blockservice())
+	return chunkpatch.Open(f.store.Context(), dag, leafCodec{}, *f.h.Userland, f.h.Info.Size)
+}
+
+// applyPatch writes the edited contents of p as a new revision of f
+func (f *File) applyPatch(p *chunkpatch.File) (base.PutResult, error) {
+	if !p.Base().Equals(*f.h.Userland) {
+		return nil, fmt.Errorf("%q: %w", f.name, chunkpatch.ErrBaseChanged)
+	}
+	root, err := p.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	id := root.Cid()
+	f.h.Userland = &id
+	f.h.Info.Size = p.Size()
+	f.h.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+	f.content = nil
+	return f.Put()
+}
+
 func (f *File) AsHistoryEntry() base.HistoryEntry {
 	return base.HistoryEntry{
 		Cid:      f.cid,
@@ -888,6 +1528,107 @@ func (f *File) AsHistoryEntry() base.HistoryEntry {
 	}
 }
 
+type Symlink struct {
+	store Store
+	name  string
+	cid   cid.Cid
+	h     *Header
+}
+
+var (
+	_ base.Node    = (*Symlink)(nil)
+	_ base.Symlink = (*Symlink)(nil)
+)
+
+func NewSymlink(store Store, name, target string) *Symlink {
+	return &Symlink{
+		store: store,
+		name:  name,
+		h: &Header{
+			Info:    NewInfo(base.NTSymlink),
+			Symlink: target,
+		},
+	}
+}
+
+func LoadSymlink(ctx context.Context, store Store, name string, id cid.Cid) (*Symlink, error) {
+	h, err := loadHeader(ctx, store.Blockservice(), id)
+	if err != nil {
+		return nil, err
+	}
+	if h.Info.Type != base.NTSymlink {
+		return nil, fmt.Errorf("expected %q to be a symlink", name)
+	}
+
+	return &Symlink{store: store, name: name, cid: id, h: h}, nil
+}
+
+func (s *Symlink) Target() string             { return s.h.Symlink }
+func (s *Symlink) Links() base.Links          { return base.NewLinks() }
+func (s *Symlink) Name() string               { return s.name }
+func (s *Symlink) Size() int64                { return int64(len(s.h.Symlink)) }
+func (s *Symlink) ModTime() time.Time         { return base.DecodeTimestamp(s.h.Info.Mtime) }
+func (s *Symlink) Ctime() time.Time           { return base.DecodeTimestamp(s.h.Info.Ctime) }
+func (s *Symlink) Mode() fs.FileMode          { return base.DecodeMode(s.h.Info.Mode) | fs.ModeSymlink }
+func (s *Symlink) Type() base.NodeType        { return s.h.Info.Type }
+func (s *Symlink) IsDir() bool                { return false }
+func (s *Symlink) Sys() interface{}           { return s.store }
+func (s *Symlink) Cid() cid.Cid               { return s.cid }
+func (s *Symlink) Stat() (fs.FileInfo, error) { return s, nil }
+
+func (s *Symlink) Read(p []byte) (n int, err error) {
+	return 0, errors.New("cannot read symlink")
+}
+func (s *Symlink) Close() error { return nil }
+
+func (s *Symlink) Metadata() (base.LDFile, error) {
+	return nil, base.ErrNoLink
+}
+
+func (s *Symlink) SetTarget(target string) {
+	s.h.Symlink = target
+	s.h.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
+}
+
+func (s *Symlink) History(ctx context.Context, maxRevs int) ([]base.HistoryEntry, error) {
+	return history(ctx, s, maxRevs)
+}
+
+func (s *Symlink) Put() (base.PutResult, error) {
+	ctx := context.TODO()
+	s.h.Info.Size = s.Size()
+	if s.cid.Defined() {
+		id := s.cid
+		s.h.Previous = &id
+	}
+
+	blk, err := s.h.encodeBlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Blockservice().Blockstore().Put(ctx, blk); err != nil {
+		return nil, err
+	}
+	s.cid = blk.Cid()
+
+	log.Debugw("wrote public symlink", "name", s.name, "cid", s.cid.String(), "target", s.h.Symlink)
+	return PutResult{
+		Cid:  s.cid,
+		Size: s.h.Info.Size,
+		Type: s.h.Info.Type,
+	}, nil
+}
+
+func (s *Symlink) AsHistoryEntry() base.HistoryEntry {
+	return base.HistoryEntry{
+		Cid:      s.cid,
+		Previous: s.h.Previous,
+		Mtime:    s.h.Info.Mtime,
+		Type:     s.h.Info.Type,
+		Size:     s.h.Info.Size,
+	}
+}
+
 // load a public node
 func loadNode(ctx context.Context, store Store, name string, id cid.Cid) (n base.Node, err error) {
 	h, err := loadHeader(ctx, store.Blockservice(), id)
@@ -911,6 +1652,8 @@ func loadNode(ctx context.Context, store Store, name string, id cid.Cid) (n base
 		return decodeLDFileBlock(df, blk)
 	case base.NTDir:
 		return treeFromHeader(ctx, store, h, name, id)
+	case base.NTSymlink:
+		return &Symlink{store: store, name: name, cid: id, h: h}, nil
 	default:
 		return nil, fmt.Errorf("unrecognized node type: %s", h.Info.Type)
 	}
@@ -918,7 +1661,8 @@ func loadNode(ctx context.Context, store Store, name string, id cid.Cid) (n base
 
 func loadNodeFromSkeletonInfo(ctx context.Context, store Store, name string, info SkeletonInfo) (n base.Node, err error) {
 	if info.IsFile {
-		return LoadFile(ctx, store, name, info.Cid)
+		// symlinks are marked as files in the skeleton
+		return loadNode(ctx, store, name, info.Cid)
 	}
 	return LoadTree(ctx, store, name, info.Cid)
 }
@@ -1020,13 +1764,19 @@ func (df *LDFile) Size() int64 {
 }
 func (df *LDFile) ModTime() time.Time {
 	if df.info != nil {
-		return time.Unix(df.info.Mtime, 0)
+		return base.DecodeTimestamp(df.info.Mtime)
+	}
+	return time.Time{}
+}
+func (df *LDFile) Ctime() time.Time {
+	if df.info != nil {
+		return base.DecodeTimestamp(df.info.Ctime)
 	}
 	return time.Time{}
 }
 func (df *LDFile) Mode() fs.FileMode {
 	if df.info != nil {
-		return fs.FileMode(df.info.Mode)
+		return base.DecodeMode(df.info.Mode)
 	}
 	return fs.FileMode(0)
 }
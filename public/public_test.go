@@ -49,6 +49,37 @@ func TestFileMetadata(t *testing.T) {
 	assert.Equal(t, expect, got)
 }
 
+func TestCopyFileWithoutMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	root := NewEmptyTree(store, "root")
+	_, err := root.Add(base.MustPath("a.txt"), base.NewMemfileBytes("a.txt", []byte("a")))
+	require.Nil(t, err)
+	_, err = root.Add(base.MustPath("b.txt"), base.NewMemfileBytes("b.txt", []byte("b")))
+	require.Nil(t, err)
+
+	// files read from a tree report a missing metadata link with ErrNoLink,
+	// which shouldn't stop them from being written elsewhere
+	for _, name := range []string{"a.txt", "c.txt"} {
+		f, err := root.Get(base.MustPath("b.txt"))
+		require.Nil(t, err)
+		_, err = root.Add(base.MustPath(name), f)
+		require.Nil(t, err, name)
+	}
+}
+
+func TestSymlinkRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	sl := NewSymlink(store, "link", "target")
+	_, err := ioutil.ReadAll(sl)
+	require.NotNil(t, err)
+}
+
 func TestTreeSkeleton(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -14,11 +14,14 @@ import (
 	cbornode "github.com/ipfs/go-ipld-cbor"
 	format "github.com/ipfs/go-ipld-format"
 	merkledag "github.com/ipfs/go-merkledag"
+	unixfs "github.com/ipfs/go-unixfs"
 	balanced "github.com/ipfs/go-unixfs/importer/balanced"
 	ihelper "github.com/ipfs/go-unixfs/importer/helpers"
 	unixfsio "github.com/ipfs/go-unixfs/io"
+	unixfspb "github.com/ipfs/go-unixfs/pb"
 	multihash "github.com/multiformats/go-multihash"
 	base "github.com/functionland/wnfs-go/base"
+	chunkpatch "github.com/functionland/wnfs-go/chunkpatch"
 )
 
 // Store is a store of Content-Addressed block data indexed by merkle
@@ -70,7 +73,7 @@ func (mds *store) PutFile(f fs.File) (PutResult, error) {
 	}
 	prefix.MhType = multihash.SHA2_256
 
-	spl := chunker.NewSizeSplitter(f, 1024*256)
+	spl := chunker.NewSizeSplitter(f, fileChunkSize)
 	dbp := ihelper.DagBuilderParams{
 		Maxlinks: 1024,
 
@@ -103,6 +106,33 @@ func (mds *store) PutFile(f fs.File) (PutResult, error) {
 	}, nil
 }
 
+// fileChunkSize is the number of content bytes stored in each leaf of a file
+const fileChunkSize = 1024 * 256
+
+// leafCodec encodes file contents as UnixFS leaves, matching the leaves
+// written by PutFile
+type leafCodec struct{}
+
+var _ chunkpatch.Codec = leafCodec{}
+
+func (leafCodec) ChunkSize() int { return fileChunkSize }
+
+func (leafCodec) EncodeLeaf(_ int, data []byte) (format.Node, uint64, error) {
+	fsn := unixfs.NewFSNode(unixfspb.Data_File)
+	fsn.SetData(data)
+	b, err := fsn.GetBytes()
+	if err != nil {
+		return nil, 0, err
+	}
+	nd := merkledag.NodeWithData(b)
+	nd.SetCidBuilder(chunkpatch.CidBuilder())
+	return nd, uint64(len(data)), nil
+}
+
+func (leafCodec) DecodeLeaf(nd format.Node) ([]byte, error) {
+	return unixfs.ReadUnixFSNodeData(nd)
+}
+
 func (mds *store) GetFile(ctx context.Context, root cid.Cid) (io.ReadCloser, error) {
 	ses := merkledag.NewSession(ctx, mds.dagserv)
 
@@ -171,7 +201,7 @@ func (r PutResult) ToLink(name string) base.Link {
 		Name:   name,
 		Cid:    r.Cid,
 		Size:   r.Size,
-		IsFile: (r.Type == base.NTFile || r.Type == base.NTLDFile),
+		IsFile: (r.Type == base.NTFile || r.Type == base.NTLDFile || r.Type == base.NTSymlink),
 	}
 }
 
@@ -181,6 +211,6 @@ func (r PutResult) ToSkeletonInfo() SkeletonInfo {
 		Metadata:    r.Metadata,
 		Userland:    r.Userland,
 		SubSkeleton: r.Skeleton,
-		IsFile:      (r.Type == base.NTFile || r.Type == base.NTLDFile),
+		IsFile:      (r.Type == base.NTFile || r.Type == base.NTLDFile || r.Type == base.NTSymlink),
 	}
 }
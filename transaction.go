@@ -0,0 +1,332 @@
+package wnfs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	blockservice "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	base "github.com/functionland/wnfs-go/base"
+	private "github.com/functionland/wnfs-go/private"
+	ratchet "github.com/functionland/wnfs-go/private/ratchet"
+	public "github.com/functionland/wnfs-go/public"
+)
+
+// Transaction runs fn against a staged copy of the filesystem. Blocks &
+// ratchets written by fn are held in memory & only written to the underlying
+// stores if fn returns nil. Only blocks the final state of the transaction
+// reaches are written, intermediate blocks fn replaced are dropped. If fn
+// returns an error all staged changes, including ratchet increments & HAMT
+// insertions, are discarded and the filesystem is left unchanged. Transaction
+// holds the filesystem's write lock until fn returns, fn must not call methods
+// of fsys
+func (fsys *fileSystem) Transaction(fn func(tx PosixFS) error) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	ctx := fsys.ctx
+	bs := newStagedBlockstore(fsys.store.Blockservice().Blockstore())
+	rs := newStagedRatchetStore(fsys.root.pstore.RatchetStore())
+	store := public.NewStore(ctx, blockservice.New(bs, nil))
+
+	root, err := fsys.root.reload(ctx, store, rs)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	tx := &fileSystem{ctx: ctx, store: store, root: root}
+
+	if err := fn(tx); err != nil {
+		log.Debugw("fileSystem.Transaction rollback", "err", err)
+		return err
+	}
+
+	// write deferred changes before the staged stores are flushed
+	if err := tx.root.flush(); err != nil {
+		return fmt.Errorf("writing transaction changes: %w", err)
+	}
+	if err := bs.flush(ctx, tx.root); err != nil {
+		return fmt.Errorf("writing transaction blocks: %w", err)
+	}
+	if err := rs.flush(ctx); err != nil {
+		return fmt.Errorf("writing transaction ratchets: %w", err)
+	}
+
+	// reopen the transaction result on the underlying stores
+	root, err = tx.root.reload(ctx, fsys.store, fsys.root.pstore.RatchetStore())
+	if err != nil {
+		return err
+	}
+	fsys.root = root
+	return nil
+}
+
+// reload opens the current state of r, including any changes that haven't
+// been written to the root header, backed by store & rs
+func (r *rootTree) reload(ctx context.Context, store public.Store, rs ratchet.Store) (*rootTree, error) {
+	if err := r.flush(); err != nil {
+		return nil, err
+	}
+	h := *r.h
+	pubID := r.Public.Cid()
+	h.Public = &pubID
+	privID := r.Private.Cid()
+	h.Private = &privID
+
+	name, err := r.Private.PrivateName()
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := rootFromHeader(ctx, store, rs, r.id, &h, r.Private.Key(), name, r.opts)
+	if err != nil {
+		return nil, err
+	}
+	root.tx = r.tx
+	root.rootKey = r.rootKey
+	root.commitKey, root.commitName = r.commitKey, r.commitName
+	root.prettyBase = r.prettyBase
+	root.metadata = r.metadata
+	root.setOptions(nil)
+	return root, nil
+}
+
+// stagedBlockstore holds written blocks in memory, reading through to an
+// underlying blockstore
+type stagedBlockstore struct {
+	blockstore.Blockstore
+	lk     sync.RWMutex
+	staged map[cid.Cid]blocks.Block
+}
+
+var _ blockstore.Blockstore = (*stagedBlockstore)(nil)
+
+func newStagedBlockstore(bs blockstore.Blockstore) *stagedBlockstore {
+	return &stagedBlockstore{Blockstore: bs, staged: map[cid.Cid]blocks.Block{}}
+}
+
+func (s *stagedBlockstore) DeleteBlock(ctx context.Context, id cid.Cid) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	delete(s.staged, id)
+	return nil
+}
+
+func (s *stagedBlockstore) Has(ctx context.Context, id cid.Cid) (bool, error) {
+	s.lk.RLock()
+	_, ok := s.staged[id]
+	s.lk.RUnlock()
+	if ok {
+		return true, nil
+	}
+	return s.Blockstore.Has(ctx, id)
+}
+
+func (s *stagedBlockstore) Get(ctx context.Context, id cid.Cid) (blocks.Block, error) {
+	s.lk.RLock()
+	blk, ok := s.staged[id]
+	s.lk.RUnlock()
+	if ok {
+		return blk, nil
+	}
+	return s.Blockstore.Get(ctx, id)
+}
+
+func (s *stagedBlockstore) GetSize(ctx context.Context, id cid.Cid) (int, error) {
+	s.lk.RLock()
+	blk, ok := s.staged[id]
+	s.lk.RUnlock()
+	if ok {
+		return len(blk.RawData()), nil
+	}
+	return s.Blockstore.GetSize(ctx, id)
+}
+
+func (s *stagedBlockstore) Put(ctx context.Context, blk blocks.Block) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.staged[blk.Cid()] = blk
+	return nil
+}
+
+func (s *stagedBlockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for _, blk := range blks {
+		s.staged[blk.Cid()] = blk
+	}
+	return nil
+}
+
+func (s *stagedBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	keys, err := s.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lk.RLock()
+	staged := make([]cid.Cid, 0, len(s.staged))
+	for id := range s.staged {
+		staged = append(staged, id)
+	}
+	s.lk.RUnlock()
+
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		for _, id := range staged {
+			select {
+			case out <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for id := range keys {
+			select {
+			case out <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// isStaged reports whether the block with id is held in memory
+func (s *stagedBlockstore) isStaged(id cid.Cid) bool {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	_, ok := s.staged[id]
+	return ok
+}
+
+// reachable returns the CIDs of staged blocks reachable from r, including
+// prior revisions. Blocks in the underlying blockstore aren't followed, the
+// blocks they link to are stored already
+func (s *stagedBlockstore) reachable(ctx context.Context, r *rootTree) (map[cid.Cid]struct{}, error) {
+	ids := map[cid.Cid]struct{}{}
+	visit := func(id cid.Cid) bool {
+		if !s.isStaged(id) {
+			return false
+		}
+		ids[id] = struct{}{}
+		return true
+	}
+
+	bserv := r.store.Blockservice()
+	if r.Public != nil {
+		if err := base.WalkBlocks(ctx, bserv, r.Public.Cid(), visit); err != nil {
+			return nil, err
+		}
+	}
+	if r.Private != nil {
+		if err := base.WalkBlocks(ctx, bserv, r.Private.Cid(), visit); err != nil {
+			return nil, err
+		}
+		name, err := r.Private.PrivateName()
+		if err != nil {
+			return nil, err
+		}
+		if err := private.WalkNewBlocks(ctx, r.pstore, name, r.Private.Key(), visit); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// flush writes staged blocks reachable from r to the underlying blockstore,
+// dropping the rest
+func (s *stagedBlockstore) flush(ctx context.Context, r *rootTree) error {
+	keep, err := s.reachable(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	blks := make([]blocks.Block, 0, len(keep))
+	for id := range keep {
+		blks = append(blks, s.staged[id])
+	}
+	log.Debugw("flushing staged blocks", "staged", len(s.staged), "reachable", len(blks))
+	if err := s.Blockstore.PutMany(ctx, blks); err != nil {
+		return err
+	}
+	s.staged = map[cid.Cid]blocks.Block{}
+	return nil
+}
+
+// stagedRatchetStore holds ratchets in memory, reading through to an
+// underlying ratchet store. Flush is a no-op, staged ratchets are only written
+// by flush
+type stagedRatchetStore struct {
+	ratchet.Store
+	lk     sync.Mutex
+	staged map[string]*ratchet.Spiral
+}
+
+var _ ratchet.Store = (*stagedRatchetStore)(nil)
+
+func newStagedRatchetStore(rs ratchet.Store) *stagedRatchetStore {
+	return &stagedRatchetStore{Store: rs, staged: map[string]*ratchet.Spiral{}}
+}
+
+func (s *stagedRatchetStore) PutRatchet(ctx context.Context, name string, r *ratchet.Spiral) (updated bool, err error) {
+	if _, err := s.Store.OldestKnownRatchet(ctx, name); err == nil {
+		return false, nil
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if _, exists := s.staged[name]; exists {
+		return false, nil
+	}
+	s.staged[name] = r.Copy()
+	return true, nil
+}
+
+func (s *stagedRatchetStore) OldestKnownRatchet(ctx context.Context, name string) (*ratchet.Spiral, error) {
+	if r, err := s.Store.OldestKnownRatchet(ctx, name); err == nil {
+		return r, nil
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if r, ok := s.staged[name]; ok {
+		return r, nil
+	}
+	return nil, ratchet.ErrRatchetNotFound
+}
+
+func (s *stagedRatchetStore) ForEach(ctx context.Context, visit func(name string, r *ratchet.Spiral) error) error {
+	if err := s.Store.ForEach(ctx, visit); err != nil {
+		return err
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for name, r := range s.staged {
+		if err := visit(name, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stagedRatchetStore) Flush() error { return nil }
+
+// flush writes all staged ratchets to the underlying ratchet store
+func (s *stagedRatchetStore) flush(ctx context.Context) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	for name, r := range s.staged {
+		if _, err := s.Store.PutRatchet(ctx, name, r); err != nil {
+			return err
+		}
+	}
+	s.staged = map[string]*ratchet.Spiral{}
+	return s.Store.Flush()
+}
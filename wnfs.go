@@ -7,6 +7,10 @@ import (
 	"fmt"
 	"io/fs"
 	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
 	"time"
 
 	blocks "github.com/ipfs/go-block-format"
@@ -16,6 +20,7 @@ import (
 	golog "github.com/ipfs/go-log"
 	base "github.com/functionland/wnfs-go/base"
 	private "github.com/functionland/wnfs-go/private"
+	ciphersuite "github.com/functionland/wnfs-go/private/ciphersuite"
 	ratchet "github.com/functionland/wnfs-go/private/ratchet"
 	public "github.com/functionland/wnfs-go/public"
 )
@@ -34,14 +39,43 @@ const (
 )
 
 type WNFS interface {
-	fs.FS
-	fs.ReadDirFile // wnfs root is a directory file
+	// WNFS implements the optional io/fs interfaces. Paths passed to io/fs
+	// methods must satisfy fs.ValidPath, "." is the root directory
+	fs.StatFS
+	fs.ReadDirFS
+	fs.ReadFileFS
+	fs.GlobFS
+	fs.SubFS
 	PosixFS
 	PrivateFS
 
 	Cid() cid.Cid
 	History(ctx context.Context, pathStr string, generations int) ([]HistoryEntry, error)
 	Commit() (CommitResult, error)
+	// MvAcross moves a file or directory between the /public and /private
+	// hierarchies by decrypting or re-encrypting contents. Unlike Mv, the moved
+	// nodes are written as new nodes, & do not keep their history
+	MvAcross(from, to string) error
+
+	// AtVersion opens the version of the filesystem described by a history
+	// entry returned by History. The returned filesystem is read-only
+	AtVersion(ctx context.Context, ent HistoryEntry) (WNFS, error)
+	// Checkout opens the filesystem as it was n commits ago, where 0 is the
+	// last commit. The returned filesystem is read-only, & serves concurrent
+	// readers a snapshot that isn't affected by later writes
+	Checkout(n int) (WNFS, error)
+	// Restore writes a prior version of the file or directory at pathStr back
+	// to the current tree as a new revision
+	Restore(ctx context.Context, pathStr string, historyCid cid.Cid) error
+	// Transaction runs fn against a staged copy of the filesystem, applying all
+	// changes if fn returns nil, discarding them otherwise
+	Transaction(fn func(tx PosixFS) error) error
+	// Import recursively copies src into the directory dst, filtering paths,
+	// reporting progress & continuing past files that fail to import
+	Import(ctx context.Context, dst string, src fs.FS, opts ImportOptions) (ImportResult, error)
+	// Export writes the file or directory at srcPath to dst, decrypting
+	// private files
+	Export(ctx context.Context, srcPath string, dst ExportTarget) error
 }
 
 type PosixFS interface {
@@ -53,11 +87,22 @@ type PosixFS interface {
 	Write(pathStr string, f fs.File) error
 	Cat(pathStr string) ([]byte, error)
 	Open(pathStr string) (fs.File, error)
+	// OpenFile opens a file for reading & random-access writes with
+	// os.OpenFile-style flags
+	OpenFile(pathStr string, flag int, perm fs.FileMode) (File, error)
 
 	// general
-	// Mv(from, to string) error
+	Mv(from, to string) error
 	Cp(pathStr, srcPathStr string, src fs.FS) error
 	Rm(pathStr string) error
+
+	// symlinks
+	Symlink(target, linkPath string) error
+	Readlink(pathStr string) (string, error)
+
+	// attributes
+	Chmod(pathStr string, mode fs.FileMode) error
+	Chtimes(pathStr string, mtime time.Time) error
 }
 
 type (
@@ -69,12 +114,69 @@ type (
 
 var NewKey = private.NewKey
 
+// ErrCrossHierarchyMove is returned when attempting to Mv a path between the
+// /public and /private hierarchies. Use MvAcross to move with re-encryption
+var ErrCrossHierarchyMove = errors.New("cannot move between file hierarchies")
+
+// ErrReadOnly is returned by write methods of a filesystem opened with
+// AtVersion or Checkout
+var ErrReadOnly = errors.New("filesystem is read-only")
+
+// ErrNoPrettyBranch is returned when reading from /p before the pretty branch
+// has been built. The branch is written each time the root is Put
+var ErrNoPrettyBranch = errors.New("pretty branch has not been built")
+
 type PrivateFS interface {
 	RootKey() private.Key
 	PrivateName() (PrivateName, error)
 }
 
+// Options configure how a filesystem is opened
+type Options struct {
+	// DeferFlush holds changes to directories in memory, writing each modified
+	// directory once on Commit instead of after every operation. Uncommitted
+	// changes are lost if the filesystem isn't committed
+	DeferFlush bool
+	// CipherSuite is the AEAD new private data is encrypted with, defaulting to
+	// AES-GCM. Private data encrypted with any suite can be read regardless
+	CipherSuite ciphersuite.Suite
+}
+
+// Option is a function that adjusts Options
+type Option func(o *Options)
+
+// DeferFlush enables deferred directory writes
+func DeferFlush(o *Options) {
+	o.DeferFlush = true
+}
+
+// CipherSuite sets the AEAD new private data is encrypted with
+func CipherSuite(s ciphersuite.Suite) Option {
+	return func(o *Options) {
+		o.CipherSuite = s
+	}
+}
+
+func newOptions(opts []Option) Options {
+	o := Options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// fileSystem is safe for concurrent use. Reads (Open, Cat, Ls, Readlink,
+// Stat) run in parallel, while writes, Commit, Transaction & History are
+// serialized & block reads until they return. Reads see the working state of
+// the filesystem as of the last completed write, including writes that haven't
+// been committed. Readers that need a committed snapshot open one with
+// Checkout(0), which is read-only & unaffected by later writes. Files opened
+// from the filesystem are not safe for concurrent use, & directories opened
+// before a write may not reflect it
 type fileSystem struct {
+	// lk guards root. History holds the write lock because reading private
+	// history populates HAMT node caches
+	lk    sync.RWMutex
 	store public.Store
 	ctx   context.Context
 	root  *rootTree
@@ -82,19 +184,20 @@ type fileSystem struct {
 
 var _ WNFS = (*fileSystem)(nil)
 
-func NewEmptyFS(ctx context.Context, bserv blockservice.BlockService, rs ratchet.Store, rootKey Key) (WNFS, error) {
+func NewEmptyFS(ctx context.Context, bserv blockservice.BlockService, rs ratchet.Store, rootKey Key, opts ...Option) (WNFS, error) {
 	store := public.NewStore(ctx, bserv)
 	fs := &fileSystem{
 		ctx:   ctx,
 		store: store,
 	}
 
-	root, err := newEmptyRootTree(store, rs, rootKey)
+	root, err := newEmptyRootTree(store, rs, rootKey, newOptions(opts))
 	if err != nil {
 		return nil, err
 	}
 
 	fs.root = root
+	root.setOptions(nil)
 
 	// put all root tree to establish base hashes for all top level directories in
 	// the file hierarchy
@@ -104,14 +207,14 @@ func NewEmptyFS(ctx context.Context, bserv blockservice.BlockService, rs ratchet
 	if _, err := root.Private.Put(); err != nil {
 		return nil, err
 	}
-	if _, err := root.Put(); err != nil {
+	if err := root.Commit(); err != nil {
 		return nil, err
 	}
 
 	return fs, nil
 }
 
-func FromCID(ctx context.Context, bserv blockservice.BlockService, rs ratchet.Store, id cid.Cid, rootKey Key, rootName PrivateName) (WNFS, error) {
+func FromCID(ctx context.Context, bserv blockservice.BlockService, rs ratchet.Store, id cid.Cid, rootKey Key, rootName PrivateName, opts ...Option) (WNFS, error) {
 	log.Debugw("FromCID", "cid", id, "key", rootKey.Encode(), "name", string(rootName))
 	store := public.NewStore(ctx, bserv)
 	fs := &fileSystem{
@@ -119,39 +222,173 @@ func FromCID(ctx context.Context, bserv blockservice.BlockService, rs ratchet.St
 		store: store,
 	}
 
-	root, err := loadRoot(ctx, store, rs, id, rootKey, rootName)
+	root, err := loadRoot(ctx, store, rs, id, rootKey, rootName, newOptions(opts))
 	if err != nil {
 		return nil, fmt.Errorf("opening root tree %s:\n%w", id, err)
 	}
 
+	root.setOptions(nil)
 	fs.root = root
 	return fs, nil
 }
 
+func (fsys *fileSystem) AtVersion(ctx context.Context, ent HistoryEntry) (WNFS, error) {
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	return fsys.atVersion(ctx, ent)
+}
+
+func (fsys *fileSystem) atVersion(ctx context.Context, ent HistoryEntry) (WNFS, error) {
+	log.Debugw("fileSystem.AtVersion", "cid", ent.Cid)
+	key := Key{}
+	if ent.Key != "" {
+		if err := key.Decode(ent.Key); err != nil {
+			return nil, fmt.Errorf("decoding key for version %s: %w", ent.Cid, err)
+		}
+	}
+
+	rs := fsys.root.pstore.RatchetStore()
+	root, err := loadRoot(ctx, fsys.store, rs, ent.Cid, key, PrivateName(ent.PrivateName), fsys.root.opts)
+	if err != nil {
+		return nil, fmt.Errorf("opening root tree %s:\n%w", ent.Cid, err)
+	}
+
+	return &readOnlyFS{
+		fileSystem: &fileSystem{
+			ctx:   ctx,
+			store: fsys.store,
+			root:  root,
+		},
+	}, nil
+}
+
+func (fsys *fileSystem) Checkout(n int) (WNFS, error) {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	if n < 0 {
+		return nil, fmt.Errorf("invalid version %d", n)
+	}
+	hist, err := fsys.root.history(n + 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(hist) <= n {
+		return nil, fmt.Errorf("version %d not found, history has %d entries", n, len(hist))
+	}
+	return fsys.atVersion(fsys.ctx, hist[n])
+}
+
+// Restore writes a prior version of the file or directory at pathStr back to
+// the current tree as a new revision. historyCid is either a CID from the
+// history of the node at pathStr, or the root CID of a past version of the
+// filesystem. Deleted nodes can be restored from any version they exist in
+func (fsys *fileSystem) Restore(ctx context.Context, pathStr string, historyCid cid.Cid) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	log.Debugw("fileSystem.Restore", "pathStr", pathStr, "historyCid", historyCid)
+	tree, relPath, err := fsys.fsHierarchyDirectoryNode(pathStr)
+	if err != nil {
+		return err
+	}
+	if len(relPath) == 0 {
+		return fmt.Errorf("cannot restore %q", pathStr)
+	}
+
+	ent, err := fsys.findHistoryEntry(ctx, pathStr, historyCid)
+	if err != nil {
+		return err
+	}
+
+	switch t := tree.(type) {
+	case *public.Tree:
+		_, err = t.Restore(relPath, ent.Cid)
+	case *private.Root:
+		key := Key{}
+		if err = key.Decode(ent.Key); err != nil {
+			return fmt.Errorf("decoding key for %s: %w", ent.Cid, err)
+		}
+		_, err = t.Restore(relPath, ent.Cid, key, private.Name(ent.PrivateName))
+	default:
+		err = fmt.Errorf("cannot restore %q", pathStr)
+	}
+	return err
+}
+
+// findHistoryEntry searches the history of the node at pathStr for id,
+// falling back to past versions of the filesystem for nodes that have been
+// removed or replaced
+func (fsys *fileSystem) findHistoryEntry(ctx context.Context, pathStr string, id cid.Cid) (HistoryEntry, error) {
+	if hist, err := fsys.history(ctx, pathStr, -1); err == nil {
+		for _, ent := range hist {
+			if ent.Cid.Equals(id) {
+				return ent, nil
+			}
+		}
+	}
+
+	versions, err := fsys.root.history(-1)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	for _, v := range versions {
+		old, err := fsys.atVersion(ctx, v)
+		if err != nil {
+			return HistoryEntry{}, err
+		}
+		hist, err := old.History(ctx, pathStr, -1)
+		if err != nil || len(hist) == 0 {
+			// path doesn't exist in this version
+			continue
+		}
+		if v.Cid.Equals(id) {
+			return hist[0], nil
+		}
+		for _, ent := range hist {
+			if ent.Cid.Equals(id) {
+				return ent, nil
+			}
+		}
+	}
+
+	return HistoryEntry{}, fmt.Errorf("%s is not a version of %q: %w", id, pathStr, base.ErrNotFound)
+}
+
 func (fsys *fileSystem) Context() context.Context { return fsys.ctx }
-func (fsys *fileSystem) Name() string             { return fsys.root.Name() }
-func (fsys *fileSystem) Cid() cid.Cid             { return fsys.root.Cid() }
-func (fsys *fileSystem) Size() int64              { return fsys.root.Size() }
-func (fsys *fileSystem) Links() base.Links        { return fsys.root.Links() }
+func (fsys *fileSystem) Name() string             { return "wnfs" }
+
+func (fsys *fileSystem) Cid() cid.Cid {
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	return fsys.root.Cid()
+}
 
-func (fsys *fileSystem) Stat() (fs.FileInfo, error) {
-	return fsys.root.Stat()
+func (fsys *fileSystem) Size() int64 {
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	return fsys.root.Size()
 }
 
-func (fsys *fileSystem) Read(p []byte) (n int, err error) {
-	return -1, errors.New("cannot read bytes of filsystem root")
+func (fsys *fileSystem) Links() base.Links {
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	return fsys.root.Links()
 }
-func (fsys *fileSystem) Close() error { return nil }
 
-func (fsys *fileSystem) ReadDir(n int) ([]fs.DirEntry, error) {
-	return fsys.root.ReadDir(n)
+func (fsys *fileSystem) committed() (cid.Cid, Key, PrivateName) {
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	return fsys.root.id, fsys.root.commitKey, fsys.root.commitName
 }
 
 func (fsys *fileSystem) RootKey() Key {
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
 	return fsys.root.Private.Key()
 }
 
 func (fsys *fileSystem) PrivateName() (PrivateName, error) {
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
 	pn, err := fsys.root.Private.PrivateName()
 	if err != nil {
 		return "", err
@@ -160,6 +397,8 @@ func (fsys *fileSystem) PrivateName() (PrivateName, error) {
 }
 
 func (fsys *fileSystem) Ls(pathStr string) ([]fs.DirEntry, error) {
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
 	log.Debugw("fileSystem.Ls", "pathStr", pathStr)
 	tree, path, err := fsys.fsHierarchyDirectoryNode(pathStr)
 	if err != nil {
@@ -181,10 +420,16 @@ func (fsys *fileSystem) Ls(pathStr string) ([]fs.DirEntry, error) {
 		return nil, fmt.Errorf("path %q is not a directory", pathStr)
 	}
 
-	return dir.ReadDir(-1)
+	ents, err := dir.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.lockedDirEntries(ents), nil
 }
 
 func (fsys *fileSystem) Mkdir(pathStr string) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
 	log.Debugw("fileSystem.Mkdir", "pathStr", pathStr)
 	tree, path, err := fsys.fsHierarchyDirectoryNode(pathStr)
 	if err != nil {
@@ -195,7 +440,23 @@ func (fsys *fileSystem) Mkdir(pathStr string) error {
 	return err
 }
 
+// Open opens the file or directory at pathStr, which must satisfy
+// fs.ValidPath. Each directory returned by Open tracks its own ReadDir
+// position
 func (fsys *fileSystem) Open(pathStr string) (fs.File, error) {
+	if !fs.ValidPath(pathStr) {
+		return nil, &fs.PathError{Op: "open", Path: pathStr, Err: fs.ErrInvalid}
+	}
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	f, err := fsys.open(pathStr)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: pathStr, Err: err}
+	}
+	return fsys.openDirFile(f), nil
+}
+
+func (fsys *fileSystem) open(pathStr string) (fs.File, error) {
 	log.Debugw("fileSystem.Open", "pathStr", pathStr)
 	tree, path, err := fsys.fsHierarchyDirectoryNode(pathStr)
 	if err != nil {
@@ -206,7 +467,9 @@ func (fsys *fileSystem) Open(pathStr string) (fs.File, error) {
 }
 
 func (fsys *fileSystem) Cat(pathStr string) ([]byte, error) {
-	f, err := fsys.Open(pathStr)
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	f, err := fsys.open(pathStr)
 	if err != nil {
 		return nil, fmt.Errorf("opening %s:\n%w", pathStr, err)
 	}
@@ -214,7 +477,28 @@ func (fsys *fileSystem) Cat(pathStr string) ([]byte, error) {
 }
 
 func (fsys *fileSystem) Cp(pathStr, srcPath string, src fs.FS) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	return fsys.cp(pathStr, srcPath, src)
+}
+
+func (fsys *fileSystem) cp(pathStr, srcPath string, src fs.FS) error {
 	log.Debugw("fileSystem.Cp", "pathStr", pathStr, "srcPath", srcPath)
+	// copying within the filesystem, the lock is already held
+	switch s := src.(type) {
+	case *fileSystem:
+		if s == fsys {
+			src = unlockedFS{fsys}
+		}
+	case subFS:
+		if s.fsys == fsys {
+			sub, err := fs.Sub(unlockedFS{fsys}, s.dir)
+			if err != nil {
+				return err
+			}
+			src = sub
+		}
+	}
 	node, relPath, err := fsys.fsHierarchyDirectoryNode(pathStr)
 	if err != nil {
 		return err
@@ -225,6 +509,8 @@ func (fsys *fileSystem) Cp(pathStr, srcPath string, src fs.FS) error {
 }
 
 func (fsys *fileSystem) Write(pathStr string, f fs.File) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
 	log.Debugw("fileSystem.Write", "pathStr", pathStr)
 	_, isDataFile := f.(StructuredDataFile)
 	fi, err := f.Stat()
@@ -244,7 +530,160 @@ func (fsys *fileSystem) Write(pathStr string, f fs.File) error {
 	return err
 }
 
+func (fsys *fileSystem) Mv(from, to string) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	return fsys.mv(from, to)
+}
+
+func (fsys *fileSystem) mv(from, to string) error {
+	log.Debugw("fileSystem.Mv", "from", from, "to", to)
+	tree, fromPath, err := fsys.fsHierarchyDirectoryNode(from)
+	if err != nil {
+		return err
+	}
+	toTree, toPath, err := fsys.fsHierarchyDirectoryNode(to)
+	if err != nil {
+		return err
+	}
+	if tree != toTree {
+		return fmt.Errorf("moving %q to %q: %w", from, to, ErrCrossHierarchyMove)
+	}
+	if len(fromPath) == 0 {
+		return fmt.Errorf("cannot move %q", from)
+	}
+
+	// moving onto an existing directory moves into that directory
+	if f, err := tree.Get(toPath); err == nil {
+		if fi, err := f.Stat(); err == nil && fi.IsDir() {
+			toPath = append(toPath, fromPath[len(fromPath)-1])
+		}
+	}
+
+	if fromPath.String() == toPath.String() {
+		return nil
+	}
+	if strings.HasPrefix(toPath.String(), fromPath.String()+"/") {
+		return fmt.Errorf("cannot move %q to a subdirectory of itself", from)
+	}
+
+	_, err = tree.Mv(fromPath, toPath)
+	return err
+}
+
+func (fsys *fileSystem) MvAcross(from, to string) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	log.Debugw("fileSystem.MvAcross", "from", from, "to", to)
+	tree, _, err := fsys.fsHierarchyDirectoryNode(from)
+	if err != nil {
+		return err
+	}
+	toTree, toPath, err := fsys.fsHierarchyDirectoryNode(to)
+	if err != nil {
+		return err
+	}
+	if tree == toTree {
+		return fsys.mv(from, to)
+	}
+
+	if f, err := toTree.Get(toPath); err == nil {
+		if fi, err := f.Stat(); err == nil && fi.IsDir() {
+			to = path.Join(to, path.Base(from))
+		}
+	}
+
+	if err := fsys.cp(to, from, fsys); err != nil {
+		return err
+	}
+	return fsys.rm(from)
+}
+
+// Symlink creates a symbolic link at linkPath that points to target. Absolute
+// targets are resolved from the root of the file hierarchy containing the link
+// (eg: "/docs" in a link under /public resolves to /public/docs), relative
+// targets from the directory containing the link. Symlinks cannot point across
+// file hierarchies
+func (fsys *fileSystem) Symlink(target, linkPath string) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	log.Debugw("fileSystem.Symlink", "target", target, "linkPath", linkPath)
+	if target == "" {
+		return errors.New("symlink target cannot be empty")
+	}
+	node, relPath, err := fsys.fsHierarchyDirectoryNode(linkPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = node.Add(relPath, base.NewMemSymlink(path.Base(linkPath), target))
+	return err
+}
+
+func (fsys *fileSystem) Readlink(pathStr string) (string, error) {
+	fsys.lk.RLock()
+	defer fsys.lk.RUnlock()
+	log.Debugw("fileSystem.Readlink", "pathStr", pathStr)
+	tree, relPath, err := fsys.fsHierarchyDirectoryNode(pathStr)
+	if err != nil {
+		return "", err
+	}
+
+	return tree.Readlink(relPath)
+}
+
+// Chmod sets the permission bits of the file, directory or symlink at
+// pathStr. Symlinks aren't followed
+func (fsys *fileSystem) Chmod(pathStr string, mode fs.FileMode) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	log.Debugw("fileSystem.Chmod", "pathStr", pathStr, "mode", mode)
+	tree, relPath, err := fsys.fsHierarchyDirectoryNode(pathStr)
+	if err != nil {
+		return err
+	}
+
+	switch t := tree.(type) {
+	case *public.Tree:
+		_, err = t.Chmod(relPath, mode)
+	case *private.Root:
+		_, err = t.Chmod(relPath, mode)
+	default:
+		err = fmt.Errorf("cannot change mode of %q", pathStr)
+	}
+	return err
+}
+
+// Chtimes sets the modification time of the file, directory or symlink at
+// pathStr. Times are stored with millisecond precision. Symlinks aren't
+// followed
+func (fsys *fileSystem) Chtimes(pathStr string, mtime time.Time) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	log.Debugw("fileSystem.Chtimes", "pathStr", pathStr, "mtime", mtime)
+	tree, relPath, err := fsys.fsHierarchyDirectoryNode(pathStr)
+	if err != nil {
+		return err
+	}
+
+	switch t := tree.(type) {
+	case *public.Tree:
+		_, err = t.Chtimes(relPath, mtime)
+	case *private.Root:
+		_, err = t.Chtimes(relPath, mtime)
+	default:
+		err = fmt.Errorf("cannot change modification time of %q", pathStr)
+	}
+	return err
+}
+
 func (fsys *fileSystem) Rm(pathStr string) error {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	return fsys.rm(pathStr)
+}
+
+func (fsys *fileSystem) rm(pathStr string) error {
 	log.Debugw("fileSystem.Rm", "pathStr", pathStr)
 	tree, relPath, err := fsys.fsHierarchyDirectoryNode(pathStr)
 	if err != nil {
@@ -256,6 +695,12 @@ func (fsys *fileSystem) Rm(pathStr string) error {
 }
 
 func (fsys *fileSystem) History(ctx context.Context, pathStr string, max int) ([]HistoryEntry, error) {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
+	return fsys.history(ctx, pathStr, max)
+}
+
+func (fsys *fileSystem) history(ctx context.Context, pathStr string, max int) ([]HistoryEntry, error) {
 	if pathStr == "." || pathStr == "" {
 		return fsys.root.history(max)
 	}
@@ -292,13 +737,59 @@ func (fsys *fileSystem) fsHierarchyDirectoryNode(pathStr string) (dir base.Tree,
 		return fsys.root.Public, tail, nil
 	case FileHierarchyNamePrivate:
 		return fsys.root.Private, tail, nil
-	// case FileHierarchyNamePretty:
-	// 	return fsys.root.Pretty, relPath, nil
+	case FileHierarchyNamePretty:
+		if fsys.root.Pretty == nil {
+			return nil, path, ErrNoPrettyBranch
+		}
+		return fsys.root.Pretty, tail, nil
 	default:
 		return nil, path, fmt.Errorf("%q is not a valid filesystem path", path)
 	}
 }
 
+// unlockedFS opens files without acquiring the filesystem lock, for reading
+// from a filesystem while a write holds the lock
+type unlockedFS struct {
+	fsys *fileSystem
+}
+
+func (u unlockedFS) Open(pathStr string) (fs.File, error) { return u.fsys.open(pathStr) }
+
+// readOnlyFS wraps a fileSystem, rejecting all writes
+type readOnlyFS struct {
+	*fileSystem
+}
+
+var _ WNFS = (*readOnlyFS)(nil)
+
+func (fsys *readOnlyFS) Mkdir(pathStr string) error                  { return ErrReadOnly }
+func (fsys *readOnlyFS) Write(pathStr string, f fs.File) error       { return ErrReadOnly }
+func (fsys *readOnlyFS) Mv(from, to string) error                    { return ErrReadOnly }
+func (fsys *readOnlyFS) MvAcross(from, to string) error              { return ErrReadOnly }
+func (fsys *readOnlyFS) Cp(pathStr, srcPath string, src fs.FS) error { return ErrReadOnly }
+func (fsys *readOnlyFS) Rm(pathStr string) error                     { return ErrReadOnly }
+func (fsys *readOnlyFS) Symlink(target, linkPath string) error       { return ErrReadOnly }
+func (fsys *readOnlyFS) Commit() (CommitResult, error)               { return CommitResult{}, ErrReadOnly }
+func (fsys *readOnlyFS) Restore(ctx context.Context, pathStr string, historyCid cid.Cid) error {
+	return ErrReadOnly
+}
+func (fsys *readOnlyFS) Chmod(pathStr string, mode fs.FileMode) error {
+	return ErrReadOnly
+}
+func (fsys *readOnlyFS) Chtimes(pathStr string, mtime time.Time) error {
+	return ErrReadOnly
+}
+func (fsys *readOnlyFS) OpenFile(pathStr string, flag int, perm fs.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, ErrReadOnly
+	}
+	return fsys.fileSystem.OpenFile(pathStr, flag, perm)
+}
+func (fsys *readOnlyFS) Transaction(fn func(tx PosixFS) error) error { return ErrReadOnly }
+func (fsys *readOnlyFS) Import(ctx context.Context, dst string, src fs.FS, opts ImportOptions) (ImportResult, error) {
+	return ImportResult{}, ErrReadOnly
+}
+
 type CommitResult struct {
 	Root        cid.Cid
 	PrivateName *PrivateName
@@ -306,16 +797,18 @@ type CommitResult struct {
 }
 
 func (fsys *fileSystem) Commit() (res CommitResult, err error) {
+	fsys.lk.Lock()
+	defer fsys.lk.Unlock()
 	if err = fsys.root.Commit(); err != nil {
 		return res, err
 	}
 
-	pn, err := fsys.PrivateName()
+	pn, err := fsys.root.Private.PrivateName()
 	if err != nil {
 		return res, err
 	}
 
-	key := fsys.RootKey()
+	key := fsys.root.Private.Key()
 
 	return CommitResult{
 		Root:        fsys.root.id,
@@ -338,6 +831,7 @@ func (h *rootHeader) encodeBlock() (blocks.Block, error) {
 		"info":               h.Info.Map(),
 		"metadata":           h.Metadata,
 		"previous":           h.Previous,
+		base.PrettyLinkName:  h.Pretty,
 		base.PublicLinkName:  h.Public,
 		base.PrivateLinkName: h.Private,
 	}
@@ -387,10 +881,19 @@ type rootTree struct {
 	id      cid.Cid
 	tx      cid.Cid // transaction start CID
 	rootKey Key
-
-	h *rootHeader
-
-	// Pretty   *base.BareTree
+	// key & name of the private root of the committed version id. Uncommitted
+	// private writes advance the private root beyond them
+	commitKey  Key
+	commitName PrivateName
+
+	h    *rootHeader
+	opts Options
+	// mdLk guards lazy loading of metadata by concurrent readers
+	mdLk sync.Mutex
+	// CID of the public tree the pretty branch was last built from
+	prettyBase cid.Cid
+
+	Pretty   *public.PrettyTree
 	metadata *public.LDFile
 	Public   *public.Tree
 	Private  *private.Root
@@ -398,19 +901,19 @@ type rootTree struct {
 
 var _ base.Tree = (*rootTree)(nil)
 
-func newEmptyRootTree(store public.Store, rs ratchet.Store, rootKey Key) (root *rootTree, err error) {
+func newEmptyRootTree(store public.Store, rs ratchet.Store, rootKey Key, opts Options) (root *rootTree, err error) {
 	root = &rootTree{
 		store:   store,
 		rootKey: rootKey,
+		opts:    opts,
 
 		h: &rootHeader{
 			Info: public.NewInfo(base.NTDir),
 		},
 		Public: public.NewEmptyTree(store, FileHierarchyNamePublic),
-		// Pretty: &base.BareTree{},
 	}
 
-	root.pstore, err = private.NewStore(context.TODO(), store.Blockservice(), rs)
+	root.pstore, err = private.NewStore(context.TODO(), store.Blockservice(), rs, private.WithCipherSuite(opts.CipherSuite))
 	if err != nil {
 		return nil, err
 	}
@@ -423,18 +926,24 @@ func newEmptyRootTree(store public.Store, rs ratchet.Store, rootKey Key) (root *
 	return root, nil
 }
 
-func loadRoot(ctx context.Context, store public.Store, rs ratchet.Store, id cid.Cid, rootKey Key, rootName PrivateName) (r *rootTree, err error) {
-	r = &rootTree{store: store, id: id, tx: id, rootKey: rootKey}
-
+func loadRoot(ctx context.Context, store public.Store, rs ratchet.Store, id cid.Cid, rootKey Key, rootName PrivateName, opts Options) (r *rootTree, err error) {
 	blk, err := store.Blockservice().GetBlock(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("loading root header block: %w", err)
 	}
 
-	if r.h, err = decodeRootHeader(blk); err != nil {
+	h, err := decodeRootHeader(blk)
+	if err != nil {
 		return nil, fmt.Errorf("decoding root header block: %w", err)
 	}
 
+	return rootFromHeader(ctx, store, rs, id, h, rootKey, rootName, opts)
+}
+
+func rootFromHeader(ctx context.Context, store public.Store, rs ratchet.Store, id cid.Cid, h *rootHeader, rootKey Key, rootName PrivateName, opts Options) (r *rootTree, err error) {
+	r = &rootTree{store: store, id: id, tx: id, rootKey: rootKey, h: h, opts: opts}
+	suite := private.WithCipherSuite(opts.CipherSuite)
+
 	if r.h.Public != nil {
 		if r.Public, err = public.LoadTree(ctx, store, FileHierarchyNamePublic, *r.h.Public); err != nil {
 			return nil, fmt.Errorf("opening /%s tree %s:\n%w", FileHierarchyNamePublic, r.h.Public, err)
@@ -443,15 +952,24 @@ func loadRoot(ctx context.Context, store public.Store, rs ratchet.Store, id cid.
 		r.Public = public.NewEmptyTree(store, FileHierarchyNamePublic)
 	}
 
+	if r.h.Pretty != nil {
+		if r.h.Public != nil {
+			r.prettyBase = *r.h.Public
+		}
+		if r.Pretty, err = public.LoadPrettyTree(ctx, store, FileHierarchyNamePretty, *r.h.Pretty, r.prettyBase); err != nil {
+			return nil, fmt.Errorf("opening /%s tree %s:\n%w", FileHierarchyNamePretty, r.h.Pretty, err)
+		}
+	}
+
 	if r.h.Private != nil && !rootKey.IsEmpty() {
-		if r.pstore, err = private.LoadStore(ctx, store.Blockservice(), rs, *r.h.Private); err != nil {
+		if r.pstore, err = private.LoadStore(ctx, store.Blockservice(), rs, *r.h.Private, suite); err != nil {
 			return nil, err
 		}
 		if r.Private, err = private.LoadRoot(store.Context(), r.pstore, FileHierarchyNamePrivate, rootKey, rootName); err != nil {
 			return nil, fmt.Errorf("opening private root:\n%w", err)
 		}
 	} else {
-		if r.pstore, err = private.LoadStore(ctx, store.Blockservice(), rs, cid.Undef); err != nil {
+		if r.pstore, err = private.LoadStore(ctx, store.Blockservice(), rs, cid.Undef, suite); err != nil {
 			return nil, err
 		}
 		if r.Private, err = private.LoadRoot(store.Context(), r.pstore, FileHierarchyNamePrivate, rootKey, rootName); err != nil {
@@ -459,13 +977,53 @@ func loadRoot(ctx context.Context, store public.Store, rs ratchet.Store, id cid.
 		}
 	}
 
-	return r, nil
+	return r, r.markCommitted()
+}
+
+// markCommitted records the private root of r as the private root of the
+// committed version
+func (r *rootTree) markCommitted() error {
+	if r.Private == nil {
+		return nil
+	}
+	name, err := r.Private.PrivateName()
+	if err != nil {
+		return err
+	}
+	r.commitKey, r.commitName = r.Private.Key(), name
+	return nil
+}
+
+func (r *rootTree) setOptions(opts []Option) {
+	for _, opt := range opts {
+		opt(&r.opts)
+	}
+	r.Public.SetDeferred(r.opts.DeferFlush)
+	r.Private.SetDeferred(r.opts.DeferFlush)
+}
+
+// flush writes deferred changes to the public & private file hierarchies
+func (r *rootTree) flush() error {
+	if r.Public != nil && r.Public.Dirty() {
+		if _, err := r.Public.Put(); err != nil {
+			return fmt.Errorf("writing /%s tree: %w", FileHierarchyNamePublic, err)
+		}
+	}
+	if r.Private != nil && r.Private.Dirty() {
+		if _, err := r.Private.Put(); err != nil {
+			return fmt.Errorf("writing /%s tree: %w", FileHierarchyNamePrivate, err)
+		}
+	}
+	return nil
 }
 
 func (r *rootTree) Put() (result base.PutResult, err error) {
 	ctx := context.TODO()
+	if err = r.flush(); err != nil {
+		return result, err
+	}
 
-	r.h.Info.Mtime = base.Timestamp().Unix()
+	r.h.Info.Mtime = base.EncodeTimestamp(base.Timestamp())
 	if r.Public != nil {
 		id := r.Public.Cid()
 		r.h.Public = &id
@@ -483,7 +1041,11 @@ func (r *rootTree) Put() (result base.PutResult, err error) {
 		r.h.Metadata = &id
 	}
 
-	// TODO(by): build pretty link
+	if r.Public != nil && (r.Pretty == nil || !r.prettyBase.Equals(r.Public.Cid())) {
+		if err = r.putPretty(ctx); err != nil {
+			return result, fmt.Errorf("building /%s tree: %w", FileHierarchyNamePretty, err)
+		}
+	}
 
 	blk, err := r.h.encodeBlock()
 	if err != nil {
@@ -497,24 +1059,46 @@ func (r *rootTree) Put() (result base.PutResult, err error) {
 	return result, nil
 }
 
+// putPretty writes the pretty branch: a plain UnixFS mirror of /public that
+// stock IPFS gateways can browse. Only subtrees that changed since the last
+// build are rewritten
+func (r *rootTree) putPretty(ctx context.Context) error {
+	prevPretty := cid.Undef
+	if r.Pretty != nil {
+		prevPretty = r.Pretty.Cid()
+	}
+
+	id, err := public.BuildPretty(ctx, r.store, r.Public, r.prettyBase, prevPretty)
+	if err != nil {
+		return err
+	}
+	if r.Pretty, err = public.LoadPrettyTree(ctx, r.store, FileHierarchyNamePretty, id, r.Public.Cid()); err != nil {
+		return err
+	}
+	r.prettyBase = r.Public.Cid()
+	r.h.Pretty = &id
+	return nil
+}
+
 func (r *rootTree) Commit() error {
 	if r.tx.Defined() {
-		r.h.Previous = &r.tx
+		prev := r.tx
+		r.h.Previous = &prev
 	}
 	if _, err := r.Put(); err != nil {
 		return err
 	}
 	r.tx = r.id
-	return nil
+	return r.markCommitted()
 }
 
 func (r *rootTree) Cid() cid.Cid        { return r.id }
 func (r *rootTree) Name() string        { return "wnfs" }
 func (r *rootTree) Size() int64         { return r.h.Info.Size }
 func (r *rootTree) IsDir() bool         { return true }
-func (r *rootTree) Mode() fs.FileMode   { return fs.FileMode(r.h.Info.Mode) }
+func (r *rootTree) Mode() fs.FileMode   { return fs.ModeDir | base.DecodeMode(r.h.Info.Mode) }
 func (r *rootTree) Type() base.NodeType { return r.h.Info.Type }
-func (r *rootTree) ModTime() time.Time  { return time.Unix(r.h.Info.Mtime, 0) }
+func (r *rootTree) ModTime() time.Time  { return base.DecodeTimestamp(r.h.Info.Mtime) }
 func (r *rootTree) Sys() interface{}    { return r.store }
 
 func (r *rootTree) SetMetadata(md interface{}) error {
@@ -523,6 +1107,8 @@ func (r *rootTree) SetMetadata(md interface{}) error {
 }
 
 func (r *rootTree) Metadata() (f base.LDFile, err error) {
+	r.mdLk.Lock()
+	defer r.mdLk.Unlock()
 	if r.metadata == nil && r.h.Metadata != nil {
 		r.metadata, err = public.LoadLDFile(r.store.Context(), r.store, base.MetadataLinkName, *r.h.Metadata)
 	}
@@ -531,11 +1117,13 @@ func (r *rootTree) Metadata() (f base.LDFile, err error) {
 
 func (r *rootTree) Links() base.Links {
 	links := base.NewLinks(
-		// base.Link{Cid: r.Pretty, Size: r.Pretty.Size(), Name: FileHierarchyNamePretty},
 		base.Link{Cid: r.Public.Cid(), Size: r.Public.Size(), Name: FileHierarchyNamePublic},
 		base.Link{Cid: r.Private.Cid(), Size: r.Private.Size(), Name: FileHierarchyNamePrivate},
 	)
 
+	if r.Pretty != nil {
+		links.Add(base.Link{Cid: r.Pretty.Cid(), Size: r.Pretty.Size(), Name: FileHierarchyNamePretty})
+	}
 	if r.h.Previous != nil && !r.id.Equals(cid.Undef) {
 		links.Add(base.Link{Cid: *r.h.Previous, Name: PreviousLinkName})
 	}
@@ -561,8 +1149,11 @@ func (r *rootTree) Get(path base.Path) (f fs.File, err error) {
 			}
 		}
 		return r.Private.Get(tail)
-	// case FileHierarchyNamePretty:
-	// 	return fsys.root.Pretty, relPath, nil
+	case FileHierarchyNamePretty:
+		if r.Pretty == nil {
+			return nil, ErrNoPrettyBranch
+		}
+		return r.Pretty.Get(tail)
 	default:
 		return nil, fmt.Errorf("%q is not a valid filesystem path", path)
 	}
@@ -584,33 +1175,54 @@ func (r *rootTree) Rm(path base.Path) (res base.PutResult, err error) {
 	return nil, fmt.Errorf("cannot remove directory from root")
 }
 
+func (r *rootTree) Mv(from, to base.Path) (res base.PutResult, err error) {
+	return nil, fmt.Errorf("cannot move within root directory, only /public or /private")
+}
+
+func (r *rootTree) Readlink(path base.Path) (string, error) {
+	head, tail := path.Shift()
+	switch head {
+	case FileHierarchyNamePublic:
+		return r.Public.Readlink(tail)
+	case FileHierarchyNamePrivate:
+		return r.Private.Readlink(tail)
+	case FileHierarchyNamePretty:
+		if r.Pretty == nil {
+			return "", ErrNoPrettyBranch
+		}
+		return r.Pretty.Readlink(tail)
+	default:
+		return "", fmt.Errorf("%q is not a symlink", path)
+	}
+}
+
 func (r *rootTree) Stat() (fi fs.FileInfo, err error) {
 	return base.NewFSFileInfo(
 		"",
 		r.Size(),
-		fs.ModeDir,
-		// TODO (b5):
-		// mtime: time.Unix(t.metadata.UnixMeta.Mtime, 0),
-		time.Unix(0, 0),
+		r.Mode(),
+		r.ModTime(),
 		r.store,
 	), nil
 }
 
+// ReadDir lists the first n file hierarchies in the root, or all of them if
+// n <= 0
 func (r *rootTree) ReadDir(n int) ([]fs.DirEntry, error) {
-	if n != -1 {
-		return nil, errors.New("wnfs root only supports n= -1 for directory listing")
-	}
-
 	links := []fs.DirEntry{}
 	if r.Private != nil {
-		links = append(links, base.NewFSDirEntry(FileHierarchyNamePrivate, false))
+		links = append(links, base.NewFSDirEntryStat(FileHierarchyNamePrivate, false, r.Private.Stat))
 	}
 	if r.Public != nil {
-		links = append(links, base.NewFSDirEntry(FileHierarchyNamePublic, false))
+		links = append(links, base.NewFSDirEntryStat(FileHierarchyNamePublic, false, r.Public.Stat))
 	}
 
-	// TODO(b5): pretty dir
+	// the pretty branch mirrors /public and is left out of listings so tree
+	// walks don't visit public files twice. it's still reachable by path
 
+	if n > 0 && n < len(links) {
+		links = links[:n]
+	}
 	return links, nil
 }
 
@@ -658,9 +1270,6 @@ func (r *rootTree) history(max int) (hist []base.HistoryEntry, err error) {
 		if privHist, err = r.Private.History(ctx, -1); err != nil {
 			return hist, err
 		}
-		if len(privHist) >= 1 {
-			privHist = privHist[1:]
-		}
 	}
 	log.Debugw("private history", "history", privHist)
 
@@ -683,12 +1292,18 @@ func (r *rootTree) history(max int) (hist []base.HistoryEntry, err error) {
 			Previous: h.Previous,
 		}
 
-		if len(privHist) > i {
-			ent.Key = privHist[i].Key
-			ent.PrivateName = privHist[i].PrivateName
+		// private revisions don't line up one-to-one with commits. use the most
+		// recent revision that was written to this version's HAMT
+		if h.Private != nil {
+			if i, err = privateRevisionAt(ctx, r.pstore.RatchetStore(), store, *h.Private, privHist, i); err != nil {
+				return nil, err
+			}
+			if i < len(privHist) {
+				ent.Key = privHist[i].Key
+				ent.PrivateName = privHist[i].PrivateName
+			}
 		}
 
-		i++
 		hist = append(hist, ent)
 		prev = ent.Previous
 
@@ -700,6 +1315,26 @@ func (r *rootTree) history(max int) (hist []base.HistoryEntry, err error) {
 	return hist, nil
 }
 
+// privateRevisionAt returns the index of the first entry in privHist, starting
+// at start, with a private name present in the HAMT at hamtID. returns
+// len(privHist) if no entry matches
+func privateRevisionAt(ctx context.Context, rs ratchet.Store, store public.Store, hamtID cid.Cid, privHist []base.HistoryEntry, start int) (int, error) {
+	pstore, err := private.LoadStore(ctx, store.Blockservice(), rs, hamtID)
+	if err != nil {
+		return start, err
+	}
+	for i := start; i < len(privHist); i++ {
+		exists, _, err := pstore.HAMT().Root().FindRaw(ctx, privHist[i].PrivateName)
+		if err != nil {
+			return start, err
+		}
+		if exists {
+			return i, nil
+		}
+	}
+	return len(privHist), nil
+}
+
 func (r *rootTree) MergeDiverged(n base.Node) (result base.MergeResult, err error) {
 	return base.MergeResult{}, fmt.Errorf("unfinished: root tree MergeDiverged")
 }
@@ -713,7 +1348,14 @@ func Merge(ctx context.Context, aFs, bFs WNFS) (err error) {
 	if !ok {
 		return fmt.Errorf("'b' is not a wnfs filesystem")
 	}
-	log.Debugw("Merge", "acid", a.Cid(), "bcid", b.Cid())
+	if a == b {
+		return nil
+	}
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	log.Debugw("Merge", "acid", a.root.Cid(), "bcid", b.root.Cid())
 
 	if a.root.Public != nil && b.root.Public != nil {
 		res, err := public.Merge(ctx, a.root.Public, b.root.Public)
@@ -808,6 +1450,9 @@ type Factory struct {
 	BlockService blockservice.BlockService
 	Ratchets     ratchet.Store
 	Decryption   private.DecryptionStore
+	Tags         TagStore
+	// Options are applied to every filesystem the factory opens
+	Options []Option
 }
 
 func (fac Factory) Load(ctx context.Context, id cid.Cid) (fs WNFS, err error) {
@@ -824,16 +1469,135 @@ func (fac Factory) Load(ctx context.Context, id cid.Cid) (fs WNFS, err error) {
 		err = nil
 	}
 
-	return FromCID(ctx, fac.BlockService, fac.Ratchets, id, key, name)
+	return FromCID(ctx, fac.BlockService, fac.Ratchets, id, key, name, fac.Options...)
+}
+
+// Commit commits fs, saving the decryption fields of the new root to the
+// factory's decryption store when the store is writable
+func (fac Factory) Commit(fs WNFS) (CommitResult, error) {
+	res, err := fs.Commit()
+	if err != nil {
+		return res, err
+	}
+	ds, ok := fac.Decryption.(private.WritableDecryptionStore)
+	if ok && res.PrivateName != nil && res.PrivateKey != nil {
+		if err := ds.PutDecryptionFields(res.Root, *res.PrivateName, *res.PrivateKey); err != nil {
+			return res, fmt.Errorf("updating decryption store: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// Tag is a named reference to a committed version of a filesystem. Tags carry
+// the key & private name required to open the private hierarchy
+type Tag struct {
+	Name        string       `json:"name"`
+	Root        cid.Cid      `json:"root"`
+	Key         *Key         `json:"key,omitempty"`
+	PrivateName *PrivateName `json:"privateName,omitempty"`
+	Created     int64        `json:"created"`
+}
+
+// ErrTagExists is returned when creating a tag with a name that's already in use
+var ErrTagExists = errors.New("tag already exists")
+
+// TagStore persists tags. GetTag must return base.ErrNotFound for unknown
+// names
+type TagStore interface {
+	GetTag(name string) (Tag, error)
+	PutTag(t Tag) error
+	ListTags() ([]Tag, error)
+}
+
+// committedVersion is implemented by filesystems that track the private root
+// of their last commit
+type committedVersion interface {
+	committed() (root cid.Cid, key Key, name PrivateName)
+}
+
+// NewTag creates a tag referencing the last committed version of fs. Changes
+// that haven't been committed aren't part of the tagged version
+func NewTag(fs WNFS, name string) (Tag, error) {
+	if name == "" || strings.ContainsAny(name, " \t\n/") {
+		return Tag{}, fmt.Errorf("invalid tag name %q", name)
+	}
+
+	t := Tag{
+		Name:    name,
+		Created: base.EncodeTimestamp(base.Timestamp()),
+	}
+	if c, ok := fs.(committedVersion); ok {
+		root, key, pn := c.committed()
+		t.Root = root
+		if pn != "" {
+			t.Key = &key
+			t.PrivateName = &pn
+		}
+	} else {
+		t.Root = fs.Cid()
+		if pn, err := fs.PrivateName(); err == nil {
+			key := fs.RootKey()
+			t.Key = &key
+			t.PrivateName = &pn
+		}
+	}
+	if !t.Root.Defined() {
+		return Tag{}, fmt.Errorf("cannot tag an uncommitted filesystem")
+	}
+	return t, nil
+}
+
+// Tag names the current version of fs, storing the tag in the factory's tag
+// store
+func (fac Factory) Tag(fs WNFS, name string) (Tag, error) {
+	if fac.Tags == nil {
+		return Tag{}, fmt.Errorf("factory has no tag store")
+	}
+	if _, err := fac.Tags.GetTag(name); err == nil {
+		return Tag{}, fmt.Errorf("%w: %q", ErrTagExists, name)
+	} else if !errors.Is(err, base.ErrNotFound) {
+		return Tag{}, err
+	}
+
+	t, err := NewTag(fs, name)
+	if err != nil {
+		return Tag{}, err
+	}
+	return t, fac.Tags.PutTag(t)
+}
+
+func (fac Factory) ListTags() ([]Tag, error) {
+	if fac.Tags == nil {
+		return nil, fmt.Errorf("factory has no tag store")
+	}
+	return fac.Tags.ListTags()
+}
+
+// LoadTag opens the version of a filesystem referenced by a named tag
+func (fac Factory) LoadTag(ctx context.Context, name string) (WNFS, error) {
+	if fac.Tags == nil {
+		return nil, fmt.Errorf("factory has no tag store")
+	}
+	t, err := fac.Tags.GetTag(name)
+	if err != nil {
+		return nil, fmt.Errorf("loading tag %q: %w", name, err)
+	}
+	if t.Key == nil || t.PrivateName == nil {
+		return fac.Load(ctx, t.Root)
+	}
+	return fac.LoadWithDecryption(ctx, t.Root, *t.PrivateName, *t.Key)
 }
 
 func (fac Factory) LoadWithDecryption(ctx context.Context, id cid.Cid, name private.Name, key private.Key) (fs WNFS, err error) {
-	return FromCID(ctx, fac.BlockService, fac.Ratchets, id, key, name)
+	return FromCID(ctx, fac.BlockService, fac.Ratchets, id, key, name, fac.Options...)
 }
 
 func NodeIsPrivate(n Node) bool {
+	if d, ok := n.(*dirFile); ok {
+		n = d.Tree
+	}
 	switch n.(type) {
-	case *private.Root, *private.Tree, *private.File, *private.LDFile:
+	case *private.Root, *private.Tree, *private.File, *private.LDFile, *private.Symlink:
 		return true
 	default:
 		return false
@@ -1,20 +1,39 @@
 package wnfs
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	cmp "github.com/google/go-cmp/cmp"
+	blocks "github.com/ipfs/go-block-format"
+	blockservice "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	golog "github.com/ipfs/go-log"
+	mh "github.com/multiformats/go-multihash"
 	base "github.com/functionland/wnfs-go/base"
+	chunkpatch "github.com/functionland/wnfs-go/chunkpatch"
 	mockblocks "github.com/functionland/wnfs-go/mockblocks"
 	private "github.com/functionland/wnfs-go/private"
+	ciphersuite "github.com/functionland/wnfs-go/private/ciphersuite"
 	ratchet "github.com/functionland/wnfs-go/private/ratchet"
 	public "github.com/functionland/wnfs-go/public"
 	"github.com/stretchr/testify/assert"
@@ -67,6 +86,125 @@ func TestTransactions(t *testing.T) {
 	require.Nil(err)
 }
 
+func TestTransaction(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(err)
+	err = fsys.Write("private/keep.txt", base.NewMemfileBytes("keep.txt", []byte("keep")))
+	require.Nil(err)
+	_, err = fsys.Commit()
+	require.Nil(err)
+
+	countBlocks := func() (n int) {
+		keys, err := store.Blockservice().Blockstore().AllKeysChan(ctx)
+		require.Nil(err)
+		for range keys {
+			n++
+		}
+		return n
+	}
+
+	// failed transactions leave no trace
+	before := fsys.Cid()
+	blockCount := countBlocks()
+	errBoom := fmt.Errorf("boom")
+	err = fsys.Transaction(func(tx PosixFS) error {
+		if err := tx.Write("public/a.txt", base.NewMemfileBytes("a.txt", []byte("a"))); err != nil {
+			return err
+		}
+		if err := tx.Write("private/keep.txt", base.NewMemfileBytes("keep.txt", []byte("changed"))); err != nil {
+			return err
+		}
+		if _, err := tx.Cat("private/keep.txt"); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	require.ErrorIs(err, errBoom)
+	require.True(before.Equals(fsys.Cid()))
+	require.Equal(blockCount, countBlocks())
+	_, err = fsys.Open("public/a.txt")
+	require.NotNil(err)
+	got, err := fsys.Cat("private/keep.txt")
+	require.Nil(err)
+	require.Equal([]byte("keep"), got)
+
+	// successful transactions apply all changes
+	err = fsys.Transaction(func(tx PosixFS) error {
+		if err := tx.Mkdir("public/dir"); err != nil {
+			return err
+		}
+		if err := tx.Write("public/dir/a.txt", base.NewMemfileBytes("a.txt", []byte("a"))); err != nil {
+			return err
+		}
+		return tx.Write("private/keep.txt", base.NewMemfileBytes("keep.txt", []byte("changed")))
+	})
+	require.Nil(err)
+	got, err = fsys.Cat("public/dir/a.txt")
+	require.Nil(err)
+	require.Equal([]byte("a"), got)
+
+	res, err := fsys.Commit()
+	require.Nil(err)
+	fsys, err = FromCID(ctx, store.Blockservice(), rs, res.Root, *res.PrivateKey, *res.PrivateName)
+	require.Nil(err)
+	got, err = fsys.Cat("private/keep.txt")
+	require.Nil(err)
+	require.Equal([]byte("changed"), got)
+	hist, err := fsys.History(ctx, ".", -1)
+	require.Nil(err)
+	require.Len(hist, 3)
+
+	// only blocks the result of a transaction reaches are written
+	dec, err := private.NewDecryptionStore(filepath.Join(t.TempDir(), "decryption.json"))
+	require.Nil(err)
+	fac := Factory{BlockService: store.Blockservice(), Ratchets: rs, Decryption: dec}
+	allBlocks := func() map[cid.Cid]struct{} {
+		keys, err := store.Blockservice().Blockstore().AllKeysChan(ctx)
+		require.Nil(err)
+		ids := map[cid.Cid]struct{}{}
+		for id := range keys {
+			ids[id] = struct{}{}
+		}
+		return ids
+	}
+	existing := allBlocks()
+	err = fsys.Transaction(func(tx PosixFS) error {
+		for i := 0; i < 10; i++ {
+			for _, hierarchy := range []string{"public", "private"} {
+				name := fmt.Sprintf("file_%d.txt", i)
+				if err := tx.Write(hierarchy+"/many/"+name, base.NewMemfileBytes(name, []byte(name))); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	require.Nil(err)
+	written := allBlocks()
+	res, err = fac.Commit(fsys)
+	require.Nil(err)
+	ids, err := fac.carBlocks(ctx, res.Root)
+	require.Nil(err)
+	reachable := map[cid.Cid]struct{}{}
+	for _, id := range ids {
+		reachable[id] = struct{}{}
+	}
+	for id := range written {
+		if _, ok := existing[id]; ok {
+			continue
+		}
+		_, ok := reachable[id]
+		require.True(ok, "transaction wrote unreachable block %s", id)
+	}
+}
+
 func TestPublicWNFS(t *testing.T) {
 	require := require.New(t)
 	assert := assert.New(t)
@@ -77,106 +215,1850 @@ func TestPublicWNFS(t *testing.T) {
 		store := newMemTestStore(ctx, t)
 		rs := ratchet.NewMemStore(ctx)
 
-		fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+		fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+		require.Nil(err)
+
+		pathStr := "public/foo/hello.txt"
+		fileContents := []byte("hello!")
+		f := base.NewMemfileBytes("hello.txt", fileContents)
+
+		err = fsys.Write(pathStr, f)
+		require.Nil(err)
+		_, err = fsys.Commit()
+		require.Nil(err)
+
+		t.Logf("wnfs root CID: %s", fsys.Cid())
+
+		gotFileContents, err := fsys.Cat(pathStr)
+		require.Nil(err)
+		if diff := cmp.Diff(fileContents, gotFileContents); diff != "" {
+			t.Errorf("result mismatch. (-want +got):\n%s", diff)
+		}
+
+		ents, err := fsys.Ls("public/foo")
+		require.Nil(err)
+		assert.Equal(len(ents), 1)
+
+		err = fsys.Rm(pathStr)
+		require.Nil(err)
+
+		_, err = fsys.Cat(pathStr)
+		require.ErrorIs(err, base.ErrNotFound)
+
+		err = fsys.Mkdir("public/bar")
+		require.Nil(err)
+
+		ents, err = fsys.Ls("public/foo")
+		require.Nil(err)
+		assert.Equal(len(ents), 0)
+
+		ents, err = fsys.Ls("public")
+		require.Nil(err)
+		assert.Equal(len(ents), 2)
+
+		dfs := os.DirFS("./testdata")
+		err = fsys.Cp("public/cats", "cats", dfs)
+		require.Nil(err)
+
+		ents, err = fsys.Ls("public/cats")
+		require.Nil(err)
+		assert.Equal(len(ents), 2)
+	})
+}
+
+func TestMerge(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+
+	a, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pathStr := "public/foo/hello.txt"
+	fileContents := []byte("hello!")
+	f := base.NewMemfileBytes("hello.txt", fileContents)
+	err = a.Write(pathStr, f)
+	require.Nil(err)
+	_, err = a.Commit()
+	require.Nil(err)
+
+	pn, err := a.PrivateName()
+	require.Nil(err)
+
+	b, err := FromCID(ctx, store.Blockservice(), rs, a.Cid(), a.RootKey(), pn)
+	require.Nil(err)
+
+	pathStr = "public/foo/world.txt"
+	fileContents = []byte("world!")
+	f = base.NewMemfileBytes("world.txt", fileContents)
+	err = a.Write(pathStr, f)
+	require.Nil(err)
+	_, err = a.Commit()
+	require.Nil(err)
+
+	pathStr = "public/bonjour.txt"
+	fileContents = []byte("bjr!")
+	f = base.NewMemfileBytes("bonjour.txt", fileContents)
+	err = b.Write(pathStr, f)
+	require.Nil(err)
+	_, err = a.Commit()
+	require.Nil(err)
+
+	err = Merge(ctx, a, b)
+	require.Nil(err)
+	res, err := a.Commit()
+	require.Nil(err)
+
+	t.Logf("%#v", res)
+}
+
+func TestMv(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(err)
+
+	for _, hierarchy := range []string{"public", "private"} {
+		t.Run(hierarchy, func(t *testing.T) {
+			fileContents := []byte("hello!")
+			err := fsys.Write(hierarchy+"/foo/hello.txt", base.NewMemfileBytes("hello.txt", []byte("hi")))
+			require.Nil(err)
+			_, err = fsys.Commit()
+			require.Nil(err)
+			err = fsys.Write(hierarchy+"/foo/hello.txt", base.NewMemfileBytes("hello.txt", fileContents))
+			require.Nil(err)
+			_, err = fsys.Commit()
+			require.Nil(err)
+
+			// moved nodes keep their CID & history
+			nodeInfo := func(path string) (cid.Cid, []base.HistoryEntry) {
+				f, err := fsys.Open(path)
+				require.Nil(err)
+				hist, err := fsys.History(ctx, path, -1)
+				require.Nil(err)
+				return f.(base.Node).Cid(), hist
+			}
+			id, hist := nodeInfo(hierarchy + "/foo/hello.txt")
+			require.Len(hist, 2)
+			requireMoved := func(path string) {
+				gotID, gotHist := nodeInfo(path)
+				require.True(id.Equals(gotID), "moved node CID changed. want: %s got: %s", id, gotID)
+				require.Equal(hist, gotHist)
+			}
+
+			// rename within a directory
+			err = fsys.Mv(hierarchy+"/foo/hello.txt", hierarchy+"/foo/bonjour.txt")
+			require.Nil(err)
+			_, err = fsys.Cat(hierarchy + "/foo/hello.txt")
+			require.ErrorIs(err, base.ErrNotFound)
+			got, err := fsys.Cat(hierarchy + "/foo/bonjour.txt")
+			require.Nil(err)
+			require.Equal(fileContents, got)
+			requireMoved(hierarchy + "/foo/bonjour.txt")
+
+			// move across directories, creating missing parents
+			err = fsys.Mv(hierarchy+"/foo/bonjour.txt", hierarchy+"/bar/baz/bonjour.txt")
+			require.Nil(err)
+			got, err = fsys.Cat(hierarchy + "/bar/baz/bonjour.txt")
+			require.Nil(err)
+			require.Equal(fileContents, got)
+			requireMoved(hierarchy + "/bar/baz/bonjour.txt")
+			ents, err := fsys.Ls(hierarchy + "/foo")
+			require.Nil(err)
+			require.Equal(0, len(ents))
+
+			// move into an existing directory
+			err = fsys.Mv(hierarchy+"/bar/baz", hierarchy+"/foo")
+			require.Nil(err)
+			got, err = fsys.Cat(hierarchy + "/foo/baz/bonjour.txt")
+			require.Nil(err)
+			require.Equal(fileContents, got)
+
+			err = fsys.Mv(hierarchy+"/foo", hierarchy+"/foo/baz/nope")
+			require.NotNil(err)
+
+			// a failed move leaves the source in place
+			err = fsys.Write(hierarchy+"/f.txt", base.NewMemfileBytes("f.txt", []byte("f")))
+			require.Nil(err)
+			err = fsys.Mv(hierarchy+"/foo/baz/bonjour.txt", hierarchy+"/f.txt/x")
+			require.NotNil(err)
+			err = fsys.Write(hierarchy+"/g.txt", base.NewMemfileBytes("g.txt", []byte("g")))
+			require.Nil(err)
+			got, err = fsys.Cat(hierarchy + "/foo/baz/bonjour.txt")
+			require.Nil(err)
+			require.Equal(fileContents, got)
+
+			_, err = fsys.Commit()
+			require.Nil(err)
+			requireMoved(hierarchy + "/foo/baz/bonjour.txt")
+		})
+	}
+
+	err = fsys.Mv("public/foo/baz/bonjour.txt", "private/bonjour.txt")
+	require.ErrorIs(err, ErrCrossHierarchyMove)
+
+	err = fsys.MvAcross("public/foo/baz/bonjour.txt", "private/bonjour.txt")
+	require.Nil(err)
+	_, err = fsys.Cat("public/foo/baz/bonjour.txt")
+	require.ErrorIs(err, base.ErrNotFound)
+	got, err := fsys.Cat("private/bonjour.txt")
+	require.Nil(err)
+	require.Equal([]byte("hello!"), got)
+
+	_, err = fsys.Commit()
+	require.Nil(err)
+}
+
+func TestSymlink(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(err)
+
+	fileContents := []byte("hello!")
+	for _, hierarchy := range []string{"public", "private"} {
+		t.Run(hierarchy, func(t *testing.T) {
+			err := fsys.Write(hierarchy+"/foo/bar/hello.txt", base.NewMemfileBytes("hello.txt", fileContents))
+			require.Nil(err)
+
+			// relative link to a file
+			err = fsys.Symlink("bar/hello.txt", hierarchy+"/foo/rel.txt")
+			require.Nil(err)
+			got, err := fsys.Cat(hierarchy + "/foo/rel.txt")
+			require.Nil(err)
+			require.Equal(fileContents, got)
+
+			// absolute link to a directory, followed as an intermediate component
+			err = fsys.Symlink("/foo/bar", hierarchy+"/baz/abs")
+			require.Nil(err)
+			got, err = fsys.Cat(hierarchy + "/baz/abs/hello.txt")
+			require.Nil(err)
+			require.Equal(fileContents, got)
+
+			// relative link using parent directories
+			err = fsys.Symlink("../foo/bar/hello.txt", hierarchy+"/baz/up.txt")
+			require.Nil(err)
+			got, err = fsys.Cat(hierarchy + "/baz/up.txt")
+			require.Nil(err)
+			require.Equal(fileContents, got)
+
+			target, err := fsys.Readlink(hierarchy + "/baz/abs")
+			require.Nil(err)
+			require.Equal("/foo/bar", target)
+			_, err = fsys.Readlink(hierarchy + "/foo/bar/hello.txt")
+			require.NotNil(err)
+
+			// loops
+			err = fsys.Symlink("loop_b", hierarchy+"/loop_a")
+			require.Nil(err)
+			err = fsys.Symlink("loop_a", hierarchy+"/loop_b")
+			require.Nil(err)
+			_, err = fsys.Open(hierarchy + "/loop_a")
+			require.ErrorIs(err, base.ErrSymlinkLoop)
+			err = fsys.Symlink(".", hierarchy+"/self")
+			require.Nil(err)
+			_, err = fsys.Open(hierarchy + "/self/self/self/foo/rel.txt")
+			require.Nil(err)
+
+			// dangling links
+			err = fsys.Symlink("nope.txt", hierarchy+"/dangling.txt")
+			require.Nil(err)
+			_, err = fsys.Open(hierarchy + "/dangling.txt")
+			require.ErrorIs(err, base.ErrNotFound)
+
+			// retarget an existing link
+			err = fsys.Symlink("bar", hierarchy+"/foo/rel.txt")
+			require.Nil(err)
+			target, err = fsys.Readlink(hierarchy + "/foo/rel.txt")
+			require.Nil(err)
+			require.Equal("bar", target)
+
+			// files & links don't replace directories
+			err = fsys.Write(hierarchy+"/foo/bar", base.NewMemfileBytes("bar", fileContents))
+			require.NotNil(err)
+			err = fsys.Symlink("rel.txt", hierarchy+"/foo/bar")
+			require.NotNil(err)
+			got, err = fsys.Cat(hierarchy + "/foo/bar/hello.txt")
+			require.Nil(err)
+			require.Equal(fileContents, got)
+		})
+	}
+
+	res, err := fsys.Commit()
+	require.Nil(err)
+
+	fsys, err = FromCID(ctx, store.Blockservice(), rs, res.Root, *res.PrivateKey, *res.PrivateName)
+	require.Nil(err)
+	for _, hierarchy := range []string{"public", "private"} {
+		target, err := fsys.Readlink(hierarchy + "/baz/abs")
+		require.Nil(err)
+		require.Equal("/foo/bar", target)
+		got, err := fsys.Cat(hierarchy + "/baz/abs/hello.txt")
+		require.Nil(err)
+		require.Equal(fileContents, got)
+	}
+}
+
+func TestEmptyFSIsFirstVersion(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(err)
+	empty := fsys.Cid()
+
+	hist, err := fsys.History(ctx, ".", -1)
+	require.Nil(err)
+	require.Equal(1, len(hist))
+	require.Equal(empty, hist[0].Cid)
+
+	err = fsys.Write("private/foo.txt", base.NewMemfileBytes("foo.txt", []byte("foo")))
+	require.Nil(err)
+	_, err = fsys.Commit()
+	require.Nil(err)
+
+	// the first commit follows the empty filesystem
+	hist, err = fsys.History(ctx, ".", -1)
+	require.Nil(err)
+	require.Equal(2, len(hist))
+	require.NotNil(hist[0].Previous)
+	require.Equal(empty, *hist[0].Previous)
+	require.Equal(empty, hist[1].Cid)
+
+	old, err := fsys.Checkout(1)
+	require.Nil(err)
+	ents, err := old.Ls("private")
+	require.Nil(err)
+	require.Equal(0, len(ents))
+}
+
+func TestHistoryPrivateRevisions(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(err)
+
+	// private revisions don't line up one-to-one with commits: some commits
+	// don't change the private root, others change it more than once
+	writes := []struct {
+		hierarchy, content string
+	}{
+		{"private", "one"},
+		{"public", "two"},
+		{"private", "three"},
+	}
+	for _, w := range writes {
+		err = fsys.Write(w.hierarchy+"/foo.txt", base.NewMemfileBytes("foo.txt", []byte(w.content)))
+		require.Nil(err)
+		err = fsys.Write(w.hierarchy+"/bar.txt", base.NewMemfileBytes("bar.txt", []byte(w.content)))
+		require.Nil(err)
+		_, err = fsys.Commit()
+		require.Nil(err)
+	}
+
+	hist, err := fsys.History(ctx, ".", -1)
+	require.Nil(err)
+	require.Equal(len(writes)+1, len(hist))
+	for i, expect := range []string{"three", "one", "one"} {
+		old, err := fsys.AtVersion(ctx, hist[i])
+		require.Nil(err)
+		got, err := old.Cat("private/foo.txt")
+		require.Nil(err, "version %d", i)
+		require.Equal(expect, string(got), "version %d", i)
+	}
+	old, err := fsys.AtVersion(ctx, hist[len(writes)])
+	require.Nil(err)
+	_, err = old.Cat("private/foo.txt")
+	require.ErrorIs(err, base.ErrNotFound)
+}
+
+func TestCheckout(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(err)
+
+	for _, content := range []string{"one", "two", "three"} {
+		err = fsys.Write("public/foo.txt", base.NewMemfileBytes("foo.txt", []byte(content)))
+		require.Nil(err)
+		err = fsys.Write("private/bar.txt", base.NewMemfileBytes("bar.txt", []byte(content)))
+		require.Nil(err)
+		_, err = fsys.Commit()
+		require.Nil(err)
+	}
+
+	old, err := fsys.Checkout(1)
+	require.Nil(err)
+	got, err := old.Cat("public/foo.txt")
+	require.Nil(err)
+	require.Equal([]byte("two"), got)
+	got, err = old.Cat("private/bar.txt")
+	require.Nil(err)
+	require.Equal([]byte("two"), got)
+
+	err = old.Write("public/foo.txt", base.NewMemfileBytes("foo.txt", []byte("nope")))
+	require.ErrorIs(err, ErrReadOnly)
+	err = old.Rm("private/bar.txt")
+	require.ErrorIs(err, ErrReadOnly)
+	_, err = old.Commit()
+	require.ErrorIs(err, ErrReadOnly)
+
+	hist, err := fsys.History(ctx, ".", -1)
+	require.Nil(err)
+	old, err = fsys.AtVersion(ctx, hist[2])
+	require.Nil(err)
+	got, err = old.Cat("public/foo.txt")
+	require.Nil(err)
+	require.Equal([]byte("one"), got)
+
+	// current version is unaffected
+	got, err = fsys.Cat("public/foo.txt")
+	require.Nil(err)
+	require.Equal([]byte("three"), got)
+
+	_, err = fsys.Checkout(len(hist))
+	require.NotNil(err)
+}
+
+func TestRestore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(t, err)
+
+	for _, hierarchy := range []string{"public", "private"} {
+		t.Run(hierarchy, func(t *testing.T) {
+			require := require.New(t)
+			filePath := hierarchy + "/docs/hello.txt"
+
+			err := fsys.Write(filePath, base.NewMemfileBytes("hello.txt", []byte("original")))
+			require.Nil(err)
+			err = fsys.Write(hierarchy+"/docs/other.txt", base.NewMemfileBytes("other.txt", []byte("other")))
+			require.Nil(err)
+			res, err := fsys.Commit()
+			require.Nil(err)
+
+			hist, err := fsys.History(ctx, filePath, -1)
+			require.Nil(err)
+			original := hist[0].Cid
+
+			// restore an overwritten file from its own history
+			err = fsys.Write(filePath, base.NewMemfileBytes("hello.txt", []byte("oops")))
+			require.Nil(err)
+			_, err = fsys.Commit()
+			require.Nil(err)
+
+			err = fsys.Restore(ctx, filePath, original)
+			require.Nil(err)
+			got, err := fsys.Cat(filePath)
+			require.Nil(err)
+			require.Equal([]byte("original"), got)
+
+			hist, err = fsys.History(ctx, filePath, -1)
+			require.Nil(err)
+			// restored revision links back to the version it restores
+			require.NotNil(hist[0].Previous)
+			require.True(original.Equals(*hist[0].Previous))
+			if hierarchy == "public" {
+				require.Len(hist, 2)
+			} else {
+				// restored revision extends the ratchet, later revisions don't
+				// link to the restored version
+				require.Len(hist, 3)
+				require.Nil(hist[1].Previous)
+			}
+
+			// restore a removed directory from a past root
+			err = fsys.Rm(hierarchy + "/docs")
+			require.Nil(err)
+			_, err = fsys.Commit()
+			require.Nil(err)
+			_, err = fsys.Open(filePath)
+			require.NotNil(err)
+
+			err = fsys.Restore(ctx, hierarchy+"/docs", res.Root)
+			require.Nil(err)
+			_, err = fsys.Commit()
+			require.Nil(err)
+			got, err = fsys.Cat(filePath)
+			require.Nil(err)
+			require.Equal([]byte("original"), got)
+			got, err = fsys.Cat(hierarchy + "/docs/other.txt")
+			require.Nil(err)
+			require.Equal([]byte("other"), got)
+
+			err = fsys.Restore(ctx, filePath, res.Root)
+			require.Nil(err)
+			err = fsys.Restore(ctx, hierarchy+"/docs/missing.txt", res.Root)
+			require.ErrorIs(err, base.ErrNotFound)
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+	fac := Factory{
+		BlockService: store.Blockservice(),
+		Ratchets:     rs,
+		Tags:         memTagStore{},
+	}
+
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(err)
+
+	err = fsys.Write("public/hello.txt", base.NewMemfileBytes("hello.txt", []byte("v1")))
+	require.Nil(err)
+	err = fsys.Write("private/hello.txt", base.NewMemfileBytes("hello.txt", []byte("v1")))
+	require.Nil(err)
+	_, err = fsys.Commit()
+	require.Nil(err)
+
+	tag, err := fac.Tag(fsys, "v1")
+	require.Nil(err)
+	require.True(fsys.Cid().Equals(tag.Root))
+	require.NotNil(tag.Key)
+	require.NotNil(tag.PrivateName)
+
+	_, err = fac.Tag(fsys, "v1")
+	require.ErrorIs(err, ErrTagExists)
+	_, err = fac.Tag(fsys, "has space")
+	require.NotNil(err)
+
+	err = fsys.Write("public/hello.txt", base.NewMemfileBytes("hello.txt", []byte("v2")))
+	require.Nil(err)
+	err = fsys.Write("private/hello.txt", base.NewMemfileBytes("hello.txt", []byte("v2")))
+	require.Nil(err)
+	_, err = fsys.Commit()
+	require.Nil(err)
+	_, err = fac.Tag(fsys, "v2")
+	require.Nil(err)
+
+	tags, err := fac.ListTags()
+	require.Nil(err)
+	require.Len(tags, 2)
+
+	old, err := fac.LoadTag(ctx, "v1")
+	require.Nil(err)
+	for _, p := range []string{"public/hello.txt", "private/hello.txt"} {
+		got, err := old.Cat(p)
+		require.Nil(err)
+		require.Equal([]byte("v1"), got)
+	}
+
+	// tags reference the last commit, excluding uncommitted writes
+	committed := fsys.Cid()
+	err = fsys.Write("private/hello.txt", base.NewMemfileBytes("hello.txt", []byte("v3")))
+	require.Nil(err)
+	err = fsys.Write("private/uncommitted.txt", base.NewMemfileBytes("uncommitted.txt", []byte("v3")))
+	require.Nil(err)
+	tag, err = fac.Tag(fsys, "uncommitted")
+	require.Nil(err)
+	require.True(committed.Equals(tag.Root))
+	tagged, err := fac.LoadTag(ctx, "uncommitted")
+	require.Nil(err)
+	got, err := tagged.Cat("private/hello.txt")
+	require.Nil(err)
+	require.Equal([]byte("v2"), got)
+	_, err = tagged.Cat("private/uncommitted.txt")
+	require.ErrorIs(err, fs.ErrNotExist)
+
+	_, err = fac.LoadTag(ctx, "missing")
+	require.ErrorIs(err, base.ErrNotFound)
+}
+
+type memTagStore map[string]Tag
+
+func (s memTagStore) GetTag(name string) (Tag, error) {
+	t, ok := s[name]
+	if !ok {
+		return t, base.ErrNotFound
+	}
+	return t, nil
+}
+
+func (s memTagStore) PutTag(t Tag) error {
+	s[t.Name] = t
+	return nil
+}
+
+func (s memTagStore) ListTags() ([]Tag, error) {
+	tags := make([]Tag, 0, len(s))
+	for _, t := range s {
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+func TestPrettyBranch(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := newCountingBlockstore()
+	store := public.NewStore(ctx, blockservice.New(bs, nil))
+	rs := ratchet.NewMemStore(ctx)
+
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(err)
+
+	hello := []byte("hello!")
+	err = fsys.Write("public/foo/hello.txt", base.NewMemfileBytes("hello.txt", hello))
+	require.Nil(err)
+	err = fsys.Write("public/bar/goodbye.txt", base.NewMemfileBytes("goodbye.txt", []byte("goodbye!")))
+	require.Nil(err)
+	err = fsys.Symlink("foo/hello.txt", "public/link.txt")
+	require.Nil(err)
+	err = fsys.Write("private/secret.txt", base.NewMemfileBytes("secret.txt", []byte("shh")))
+	require.Nil(err)
+	res, err := fsys.Commit()
+	require.Nil(err)
+
+	got, err := fsys.Cat("p/foo/hello.txt")
+	require.Nil(err)
+	require.Equal(hello, got)
+	target, err := fsys.Readlink("p/link.txt")
+	require.Nil(err)
+	require.Equal("foo/hello.txt", target)
+	_, err = fsys.Open("p/secret.txt")
+	require.ErrorIs(err, base.ErrNotFound)
+	err = fsys.Write("p/nope.txt", base.NewMemfileBytes("nope.txt", hello))
+	require.ErrorIs(err, public.ErrReadOnlyPretty)
+
+	// modification times come from the public nodes the mirror was built from
+	for _, path := range []string{"foo", "foo/hello.txt"} {
+		pub, err := fsys.Stat("public/" + path)
+		require.Nil(err)
+		pretty, err := fsys.Stat("p/" + path)
+		require.Nil(err)
+		require.False(pretty.ModTime().Equal(base.DecodeTimestamp(0)), path)
+		require.True(pub.ModTime().Equal(pretty.ModTime()), path)
+	}
+
+	// listing a directory doesn't load its entries
+	bs.gets.Store(0)
+	ents, err := fsys.ReadDir("p")
+	require.Nil(err)
+	require.Equal(int64(0), bs.gets.Load())
+	types := map[string]bool{}
+	for _, ent := range ents {
+		types[ent.Name()] = ent.IsDir()
+	}
+	require.Equal(map[string]bool{"bar": true, "foo": true, "link.txt": false}, types)
+
+	// each open of a pretty directory reads entries in batches
+	for i := 0; i < 2; i++ {
+		f, err := fsys.Open("p")
+		require.Nil(err)
+		dir := f.(*dirFile).Tree.(fs.ReadDirFile)
+		var names []string
+		for {
+			ents, err := dir.ReadDir(2)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.Nil(err)
+			for _, ent := range ents {
+				names = append(names, ent.Name())
+			}
+		}
+		require.Equal([]string{"bar", "foo", "link.txt"}, names)
+	}
+
+	fooDir, err := fsys.Open("p/foo")
+	require.Nil(err)
+	fooID := fooDir.(base.Node).Cid()
+	_, err = ioutil.ReadAll(fooDir)
+	require.NotNil(err)
+
+	// writes to a sibling directory reuse the unchanged pretty subtree
+	err = fsys.Write("public/bar/goodbye.txt", base.NewMemfileBytes("goodbye.txt", []byte("see ya!")))
+	require.Nil(err)
+	_, err = fsys.Commit()
+	require.Nil(err)
+
+	got, err = fsys.Cat("p/bar/goodbye.txt")
+	require.Nil(err)
+	require.Equal([]byte("see ya!"), got)
+	fooDir, err = fsys.Open("p/foo")
+	require.Nil(err)
+	require.True(fooID.Equals(fooDir.(base.Node).Cid()))
+
+	// pretty branch survives reloading
+	fsys, err = FromCID(ctx, store.Blockservice(), rs, res.Root, *res.PrivateKey, *res.PrivateName)
+	require.Nil(err)
+	got, err = fsys.Cat("p/bar/goodbye.txt")
+	require.Nil(err)
+	require.Equal([]byte("goodbye!"), got)
+}
+
+func TestDeferFlush(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	write := func(opts ...Option) (fsys WNFS, rs ratchet.Store, bs *countingBlockstore, res CommitResult) {
+		bs = newCountingBlockstore()
+		rs = ratchet.NewMemStore(ctx)
+		fsys, err := NewEmptyFS(ctx, blockservice.New(bs, nil), rs, testRootKey, opts...)
+		require.Nil(err)
+		bs.puts.Store(0)
+
+		for _, hierarchy := range []string{"public", "private"} {
+			for i := 0; i < 5; i++ {
+				name := fmt.Sprintf("file_%d.txt", i)
+				err = fsys.Write(hierarchy+"/a/b/c/"+name, base.NewMemfileBytes(name, []byte(name)))
+				require.Nil(err)
+			}
+			err = fsys.Mkdir(hierarchy + "/a/d")
+			require.Nil(err)
+			err = fsys.Mv(hierarchy+"/a/b/c/file_0.txt", hierarchy+"/a/d/file_0.txt")
+			require.Nil(err)
+			err = fsys.Rm(hierarchy + "/a/b/c/file_1.txt")
+			require.Nil(err)
+
+			// pending changes are readable before commit
+			got, err := fsys.Cat(hierarchy + "/a/d/file_0.txt")
+			require.Nil(err)
+			require.Equal([]byte("file_0.txt"), got)
+		}
+
+		res, err = fsys.Commit()
+		require.Nil(err)
+		return fsys, rs, bs, res
+	}
+
+	_, _, eager, _ := write()
+	fsys, rs, deferred, res := write(DeferFlush)
+	t.Logf("block writes eager: %d deferred: %d", eager.puts.Load(), deferred.puts.Load())
+	require.Less(deferred.puts.Load(), eager.puts.Load())
+
+	fsys, err := FromCID(ctx, blockservice.New(deferred, nil), rs, res.Root, *res.PrivateKey, *res.PrivateName)
+	require.Nil(err)
+	for _, hierarchy := range []string{"public", "private"} {
+		ents, err := fsys.Ls(hierarchy + "/a/b/c")
+		require.Nil(err)
+		require.Equal(3, len(ents))
+		got, err := fsys.Cat(hierarchy + "/a/d/file_0.txt")
+		require.Nil(err)
+		require.Equal([]byte("file_0.txt"), got)
+		_, err = fsys.Open(hierarchy + "/a/b/c/file_1.txt")
+		require.ErrorIs(err, base.ErrNotFound)
+	}
+}
+
+func TestConcurrentReadWrite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(t, err)
+
+	hierarchies := []string{"public", "private"}
+	for _, hierarchy := range hierarchies {
+		err = fsys.Write(hierarchy+"/dir/hello.txt", base.NewMemfileBytes("hello.txt", []byte("hello!")))
+		require.Nil(t, err)
+	}
+	_, err = fsys.Commit()
+	require.Nil(t, err)
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, 64)
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				for _, hierarchy := range hierarchies {
+					data, err := fsys.Cat(hierarchy + "/dir/hello.txt")
+					if err != nil {
+						errs <- err
+						return
+					}
+					if string(data) != "hello!" {
+						errs <- fmt.Errorf("unexpected contents: %q", data)
+						return
+					}
+					if _, err := fsys.Ls(hierarchy + "/dir"); err != nil {
+						errs <- err
+						return
+					}
+					if _, err := fsys.Open(hierarchy); err != nil {
+						errs <- err
+						return
+					}
+				}
+				fsys.Cid()
+			}
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				for _, hierarchy := range hierarchies {
+					name := fmt.Sprintf("file_%d_%d.txt", i, j)
+					if err := fsys.Write(hierarchy+"/dir/"+name, base.NewMemfileBytes(name, []byte(name))); err != nil {
+						errs <- err
+						return
+					}
+				}
+				if _, err := fsys.Commit(); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := fsys.History(ctx, "private/dir", -1); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for _, hierarchy := range hierarchies {
+		ents, err := fsys.Ls(hierarchy + "/dir")
+		require.Nil(t, err)
+		assert.Equal(t, 11, len(ents))
+	}
+}
+
+func TestCommittedSnapshotReads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(t, err)
+
+	hierarchies := []string{"public", "private"}
+	for _, hierarchy := range hierarchies {
+		err = fsys.Write(hierarchy+"/hello.txt", base.NewMemfileBytes("hello.txt", []byte("v1")))
+		require.Nil(t, err)
+	}
+	_, err = fsys.Commit()
+	require.Nil(t, err)
+
+	snap, err := fsys.Checkout(0)
+	require.Nil(t, err)
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, 64)
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				for _, hierarchy := range hierarchies {
+					data, err := snap.Cat(hierarchy + "/hello.txt")
+					if err != nil {
+						errs <- err
+						return
+					}
+					if string(data) != "v1" {
+						errs <- fmt.Errorf("snapshot read %q", data)
+						return
+					}
+					ents, err := snap.Ls(hierarchy)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if len(ents) != 1 {
+						errs <- fmt.Errorf("snapshot has %d entries in %s", len(ents), hierarchy)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 5; j++ {
+			for _, hierarchy := range hierarchies {
+				name := fmt.Sprintf("file_%d.txt", j)
+				if err := fsys.Write(hierarchy+"/"+name, base.NewMemfileBytes(name, []byte(name))); err != nil {
+					errs <- err
+					return
+				}
+				if err := fsys.Write(hierarchy+"/hello.txt", base.NewMemfileBytes("hello.txt", []byte("v2"))); err != nil {
+					errs <- err
+					return
+				}
+			}
+			if _, err := fsys.Commit(); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// reads through the filesystem see writes that haven't been committed
+	for _, hierarchy := range hierarchies {
+		err = fsys.Write(hierarchy+"/hello.txt", base.NewMemfileBytes("hello.txt", []byte("v3")))
+		require.Nil(t, err)
+		data, err := fsys.Cat(hierarchy + "/hello.txt")
+		require.Nil(t, err)
+		assert.Equal(t, "v3", string(data))
+		data, err = snap.Cat(hierarchy + "/hello.txt")
+		require.Nil(t, err)
+		assert.Equal(t, "v1", string(data))
+	}
+}
+
+func TestImport(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(err)
+
+	mtime := time.Now().Add(-time.Hour)
+	src := fstest.MapFS{
+		"a.txt":              {Data: []byte("a"), ModTime: mtime},
+		"sub/b.txt":          {Data: []byte("bb"), ModTime: mtime},
+		"sub/debug.log":      {Data: []byte("log"), ModTime: mtime},
+		"node_modules/x.js":  {Data: []byte("x"), ModTime: mtime},
+		"deep/nested/c.md":   {Data: []byte("ccc"), ModTime: mtime},
+		"deep/nested/broken": {Data: []byte("broken"), ModTime: mtime},
+		"deep/empty":         {Mode: fs.ModeDir, ModTime: mtime},
+	}
+	failing := failingFS{FS: src, fail: "deep/nested/broken"}
+
+	for _, hierarchy := range []string{"public", "private"} {
+		var progress []ImportProgress
+		opts := ImportOptions{
+			Exclude:       []string{"*.log", "node_modules/"},
+			SkipUnchanged: true,
+			Progress:      func(p ImportProgress) { progress = append(progress, p) },
+		}
+
+		res, err := fsys.Import(ctx, hierarchy+"/imported", failing, opts)
+		var importErr *ImportError
+		require.ErrorAs(err, &importErr)
+		require.Contains(importErr.Failed, "deep/nested/broken")
+		require.Equal(ImportResult{Files: 3, Bytes: 6}, res)
+		require.Equal(4, len(progress))
+		require.Equal(1, progress[len(progress)-1].Failed)
+
+		got, err := fsys.Cat(hierarchy + "/imported/deep/nested/c.md")
+		require.Nil(err)
+		require.Equal([]byte("ccc"), got)
+		_, err = fsys.Ls(hierarchy + "/imported/deep/empty")
+		require.Nil(err)
+		_, err = fsys.Open(hierarchy + "/imported/sub/debug.log")
+		require.ErrorIs(err, base.ErrNotFound)
+		_, err = fsys.Open(hierarchy + "/imported/node_modules")
+		require.ErrorIs(err, base.ErrNotFound)
+
+		// unchanged files are skipped on re-import
+		res, err = fsys.Import(ctx, hierarchy+"/imported", src, opts)
+		require.Nil(err)
+		require.Equal(ImportResult{Files: 1, Skipped: 3, Bytes: 6}, res)
+
+		// only matching files are imported with include patterns
+		res, err = fsys.Import(ctx, hierarchy+"/docs", src, ImportOptions{Include: []string{"*.md"}})
+		require.Nil(err)
+		require.Equal(ImportResult{Files: 1, Bytes: 3}, res)
+		ents, err := fsys.Ls(hierarchy + "/docs")
+		require.Nil(err)
+		require.Equal(1, len(ents))
+
+		// progress callbacks can read from the filesystem, & files can be
+		// imported from the filesystem itself
+		docs, err := fsys.Sub(hierarchy + "/docs")
+		require.Nil(err)
+		opts = ImportOptions{Progress: func(p ImportProgress) {
+			require.Nil(p.Err)
+			got, err := fsys.Cat(hierarchy + "/copy/" + p.Path)
+			require.Nil(err)
+			require.Equal([]byte("ccc"), got)
+		}}
+		res, err = fsys.Import(ctx, hierarchy+"/copy", docs, opts)
+		require.Nil(err)
+		require.Equal(ImportResult{Files: 1, Bytes: 3}, res)
+	}
+}
+
+// failingFS returns an error opening one path
+type failingFS struct {
+	fs.FS
+	fail string
+}
+
+func (f failingFS) Open(name string) (fs.File, error) {
+	if name == f.fail {
+		return nil, fmt.Errorf("opening %s: %w", name, fs.ErrPermission)
+	}
+	return f.FS.Open(name)
+}
+
+func TestModeAndTimes(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(err)
+
+	stat := func(pathStr string) fs.FileInfo {
+		t.Helper()
+		f, err := fsys.Open(pathStr)
+		require.Nil(err)
+		fi, err := f.Stat()
+		require.Nil(err)
+		return fi
+	}
+
+	written := time.Date(2021, 3, 4, 5, 6, 7, 891234567, time.UTC)
+	changed := time.Date(2022, 1, 2, 3, 4, 5, 678000000, time.UTC)
+
+	for _, hierarchy := range []string{"public", "private"} {
+		dir := hierarchy + "/dir"
+		file := dir + "/file.txt"
+
+		// writes honor source file info
+		fi := base.NewFSFileInfo("file.txt", 5, 0600, written, nil)
+		f, err := base.NewFileWithInfo(fi, strings.NewReader("hello"))
+		require.Nil(err)
+		err = fsys.Write(file, f)
+		require.Nil(err)
+
+		got := stat(file)
+		require.Equal(fs.FileMode(0600), got.Mode(), hierarchy)
+		require.True(written.Truncate(time.Millisecond).Equal(got.ModTime()), "%s: %s != %s", hierarchy, written, got.ModTime())
+		require.False(got.(base.CtimeInfo).Ctime().IsZero())
+
+		// files without permission bits use defaults
+		err = fsys.Write(dir+"/default.txt", base.NewMemfileBytes("default.txt", []byte("default")))
+		require.Nil(err)
+		require.Equal(fs.FileMode(base.ModeDefault), stat(dir+"/default.txt").Mode(), hierarchy)
+		require.Equal(fs.ModeDir|base.ModeDirDefault, stat(dir).Mode(), hierarchy)
+		require.True(stat(dir).IsDir())
+
+		dirMtime := stat(dir).ModTime()
+		err = fsys.Chmod(file, 0640)
+		require.Nil(err)
+		err = fsys.Chtimes(file, changed)
+		require.Nil(err)
+		got = stat(file)
+		require.Equal(fs.FileMode(0640), got.Mode(), hierarchy)
+		require.True(changed.Equal(got.ModTime()), hierarchy)
+		require.True(dirMtime.Equal(stat(dir).ModTime()), "%s: changing a file shouldn't change its directory", hierarchy)
+		data, err := fsys.Cat(file)
+		require.Nil(err)
+		require.Equal("hello", string(data))
+
+		err = fsys.Chmod(dir, 0700)
+		require.Nil(err)
+		err = fsys.Chtimes(dir, changed)
+		require.Nil(err)
+		require.Equal(fs.ModeDir|0700, stat(dir).Mode(), hierarchy)
+		require.True(changed.Equal(stat(dir).ModTime()), hierarchy)
+
+		err = fsys.Symlink("file.txt", dir+"/link")
+		require.Nil(err)
+		err = fsys.Chmod(dir+"/link", 0777)
+		require.Nil(err)
+		target, err := fsys.Readlink(dir + "/link")
+		require.Nil(err)
+		require.Equal("file.txt", target)
+
+		err = fsys.Chmod(dir+"/missing", 0777)
+		require.ErrorIs(err, base.ErrNotFound)
+	}
+
+	res, err := fsys.Commit()
+	require.Nil(err)
+	root, err := fsys.Stat(".")
+	require.Nil(err)
+	require.True(root.IsDir())
+	require.True(root.ModTime().After(time.Unix(0, 0)))
+
+	fsys, err = FromCID(ctx, store.Blockservice(), rs, res.Root, *res.PrivateKey, *res.PrivateName)
+	require.Nil(err)
+	for _, hierarchy := range []string{"public", "private"} {
+		got := stat(hierarchy + "/dir/file.txt")
+		require.Equal(fs.FileMode(0640), got.Mode(), hierarchy)
+		require.True(changed.Equal(got.ModTime()), hierarchy)
+		require.Equal(fs.ModeDir|0700, stat(hierarchy+"/dir").Mode(), hierarchy)
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := newCountingBlockstore()
+	rs := ratchet.NewMemStore(ctx)
+	fsys, err := NewEmptyFS(ctx, blockservice.New(bs, nil), rs, testRootKey)
+	require.Nil(err)
+
+	data := make([]byte, 4*1024*1024+1000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	cat := func(pathStr string) []byte {
+		t.Helper()
+		got, err := fsys.Cat(pathStr)
+		require.Nil(err)
+		return got
+	}
+
+	for _, hierarchy := range []string{"public", "private"} {
+		pathStr := hierarchy + "/logs/app.log"
+		bs.puts.Store(0)
+		err = fsys.Write(pathStr, base.NewMemfileBytes("app.log", data))
+		require.Nil(err)
+		writePuts := bs.puts.Load()
+		expect := append([]byte(nil), data...)
+
+		// appends only write leaves at the end of the file
+		bs.puts.Store(0)
+		f, err := fsys.OpenFile(pathStr, os.O_WRONLY|os.O_APPEND, 0)
+		require.Nil(err)
+		line := []byte("appended line\n")
+		_, err = f.Write(line)
+		require.Nil(err)
+		require.Nil(f.Close())
+		expect = append(expect, line...)
+		require.Equal(expect, cat(pathStr), hierarchy)
+		t.Logf("%s block writes. full write: %d append: %d", hierarchy, writePuts, bs.puts.Load())
+		require.Less(bs.puts.Load(), writePuts/2, hierarchy)
+
+		// writes across a chunk boundary are readable before they're synced
+		f, err = fsys.OpenFile(pathStr, os.O_RDWR, 0)
+		require.Nil(err)
+		patch := bytes.Repeat([]byte("x"), 100)
+		off := int64(1024*256 - 50)
+		_, err = f.WriteAt(patch, off)
+		require.Nil(err)
+		copy(expect[off:], patch)
+		buf := make([]byte, 200)
+		_, err = f.ReadAt(buf, off-50)
+		require.Nil(err)
+		require.Equal(expect[off-50:off+150], buf)
+		_, err = f.Seek(-5, io.SeekEnd)
+		require.Nil(err)
+		_, err = f.Write([]byte("TAIL\n"))
+		require.Nil(err)
+		copy(expect[len(expect)-5:], "TAIL\n")
+		fi, err := f.Stat()
+		require.Nil(err)
+		require.Equal(int64(len(expect)), fi.Size())
+		require.Nil(f.Close())
+		require.Equal(expect, cat(pathStr), hierarchy)
+
+		// truncating shrinks the file, growing fills with zeros
+		f, err = fsys.OpenFile(pathStr, os.O_RDWR, 0)
+		require.Nil(err)
+		require.Nil(f.Truncate(1024*1024 + 10))
+		require.Nil(f.Truncate(1024*1024 + 20))
+		require.Nil(f.Close())
+		expect = append(expect[:1024*1024+10], make([]byte, 10)...)
+		require.Equal(expect, cat(pathStr), hierarchy)
+
+		// concurrent handles conflict
+		a, err := fsys.OpenFile(pathStr, os.O_WRONLY|os.O_APPEND, 0)
+		require.Nil(err)
+		b, err := fsys.OpenFile(pathStr, os.O_WRONLY|os.O_APPEND, 0)
+		require.Nil(err)
+		_, err = a.Write([]byte("a"))
+		require.Nil(err)
+		_, err = b.Write([]byte("b"))
+		require.Nil(err)
+		require.Nil(a.Close())
+		require.ErrorIs(b.Close(), chunkpatch.ErrBaseChanged)
+		expect = append(expect, 'a')
+		require.Equal(expect, cat(pathStr), hierarchy)
+
+		// O_TRUNC replaces contents
+		f, err = fsys.OpenFile(pathStr, os.O_WRONLY|os.O_TRUNC, 0)
 		require.Nil(err)
+		_, err = f.Write([]byte("fresh"))
+		require.Nil(err)
+		require.Nil(f.Close())
+		require.Equal([]byte("fresh"), cat(pathStr), hierarchy)
 
-		pathStr := "public/foo/hello.txt"
-		fileContents := []byte("hello!")
-		f := base.NewMemfileBytes("hello.txt", fileContents)
+		// O_CREATE creates missing files
+		newPath := hierarchy + "/logs/new.log"
+		_, err = fsys.OpenFile(newPath, os.O_WRONLY, 0)
+		require.ErrorIs(err, base.ErrNotFound)
+		f, err = fsys.OpenFile(newPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		require.Nil(err)
+		_, err = f.Write([]byte("new"))
+		require.Nil(err)
+		require.Nil(f.Close())
+		_, err = fsys.OpenFile(newPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		require.ErrorIs(err, fs.ErrExist)
+		require.Equal([]byte("new"), cat(newPath), hierarchy)
+		nf, err := fsys.Open(newPath)
+		require.Nil(err)
+		nfi, err := nf.Stat()
+		require.Nil(err)
+		require.Equal(fs.FileMode(0600), nfi.Mode(), hierarchy)
 
-		err = fsys.Write(pathStr, f)
+		// read-only handles reject writes
+		f, err = fsys.OpenFile(newPath, os.O_RDONLY, 0)
 		require.Nil(err)
-		_, err = fsys.Commit()
+		_, err = f.Write([]byte("nope"))
+		require.Error(err)
+		got, err := ioutil.ReadAll(f)
 		require.Nil(err)
+		require.Equal([]byte("new"), got)
+		require.Nil(f.Close())
+		_, err = f.Read(buf)
+		require.ErrorIs(err, ErrFileClosed)
+	}
 
-		t.Logf("wnfs root CID: %s", fsys.Cid())
+	res, err := fsys.Commit()
+	require.Nil(err)
+	fsys, err = FromCID(ctx, blockservice.New(bs, nil), rs, res.Root, *res.PrivateKey, *res.PrivateName)
+	require.Nil(err)
+	for _, hierarchy := range []string{"public", "private"} {
+		require.Equal([]byte("fresh"), cat(hierarchy+"/logs/app.log"), hierarchy)
+		require.Equal([]byte("new"), cat(hierarchy+"/logs/new.log"), hierarchy)
+	}
+}
 
-		gotFileContents, err := fsys.Cat(pathStr)
+func TestOpenSeekReadAt(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := newCountingBlockstore()
+	rs := ratchet.NewMemStore(ctx)
+	fsys, err := NewEmptyFS(ctx, blockservice.New(bs, nil), rs, testRootKey)
+	require.Nil(err)
+
+	data := make([]byte, 4*1024*1024+1000)
+	rand.New(rand.NewSource(1)).Read(data)
+	for _, hierarchy := range []string{"public", "private"} {
+		err = fsys.Write(hierarchy+"/video.mp4", base.NewMemfileBytes("video.mp4", data))
 		require.Nil(err)
-		if diff := cmp.Diff(fileContents, gotFileContents); diff != "" {
-			t.Errorf("result mismatch. (-want +got):\n%s", diff)
-		}
+		err = fsys.Write(hierarchy+"/empty.txt", base.NewMemfileBytes("empty.txt", nil))
+		require.Nil(err)
+	}
+	res, err := fsys.Commit()
+	require.Nil(err)
+	fsys, err = FromCID(ctx, blockservice.New(bs, nil), rs, res.Root, *res.PrivateKey, *res.PrivateName)
+	require.Nil(err)
 
-		ents, err := fsys.Ls("public/foo")
+	for _, hierarchy := range []string{"public", "private"} {
+		f, err := fsys.Open(hierarchy + "/video.mp4")
 		require.Nil(err)
-		assert.Equal(len(ents), 1)
+		fi, err := f.Stat()
+		require.Nil(err)
+		require.Equal(int64(len(data)), fi.Size(), hierarchy)
+		ra, ok := f.(io.ReaderAt)
+		require.True(ok, "%s file should implement io.ReaderAt", hierarchy)
+		s, ok := f.(io.Seeker)
+		require.True(ok, "%s file should implement io.Seeker", hierarchy)
+
+		// partial reads only fetch blocks they need
+		bs.gets.Store(0)
+		buf := make([]byte, 100)
+		off := int64(len(data) - 600)
+		n, err := ra.ReadAt(buf, off)
+		require.Nil(err)
+		require.Equal(100, n)
+		require.Equal(data[off:off+100], buf, hierarchy)
+		require.Less(bs.gets.Load(), int64(4), hierarchy)
 
-		err = fsys.Rm(pathStr)
+		// reads across a chunk boundary
+		off = 1024*256 - 50
+		_, err = ra.ReadAt(buf, off)
 		require.Nil(err)
+		require.Equal(data[off:off+100], buf, hierarchy)
 
-		_, err = fsys.Cat(pathStr)
-		require.ErrorIs(err, base.ErrNotFound)
+		// reads past the end return io.EOF
+		n, err = ra.ReadAt(buf, int64(len(data)-10))
+		require.Equal(io.EOF, err, hierarchy)
+		require.Equal(10, n)
+		require.Equal(data[len(data)-10:], buf[:n], hierarchy)
 
-		err = fsys.Mkdir("public/bar")
+		// ReadAt doesn't move the read offset
+		_, err = io.ReadFull(f, buf)
 		require.Nil(err)
+		require.Equal(data[:100], buf, hierarchy)
 
-		ents, err = fsys.Ls("public/foo")
+		pos, err := s.Seek(1024*1024*3+7, io.SeekStart)
 		require.Nil(err)
-		assert.Equal(len(ents), 0)
+		require.Equal(int64(1024*1024*3+7), pos)
+		_, err = io.ReadFull(f, buf)
+		require.Nil(err)
+		require.Equal(data[pos:pos+100], buf, hierarchy)
 
-		ents, err = fsys.Ls("public")
+		pos, err = s.Seek(-1024*512, io.SeekCurrent)
 		require.Nil(err)
-		assert.Equal(len(ents), 2)
+		_, err = io.ReadFull(f, buf)
+		require.Nil(err)
+		require.Equal(data[pos:pos+100], buf, hierarchy)
 
-		dfs := os.DirFS("./testdata")
-		err = fsys.Cp("public/cats", "cats", dfs)
+		pos, err = s.Seek(-50, io.SeekEnd)
 		require.Nil(err)
+		require.Equal(int64(len(data)-50), pos)
+		got, err := ioutil.ReadAll(f)
+		require.Nil(err)
+		require.Equal(data[pos:], got, hierarchy)
+		require.Nil(f.Close())
 
-		ents, err = fsys.Ls("public/cats")
+		f, err = fsys.Open(hierarchy + "/empty.txt")
 		require.Nil(err)
-		assert.Equal(len(ents), 2)
-	})
+		n, err = f.(io.ReaderAt).ReadAt(buf, 0)
+		require.Equal(io.EOF, err, hierarchy)
+		require.Equal(0, n)
+		pos, err = f.(io.Seeker).Seek(0, io.SeekEnd)
+		require.Nil(err)
+		require.Equal(int64(0), pos)
+		require.Nil(f.Close())
+	}
 }
 
-func TestMerge(t *testing.T) {
+func TestFSConformance(t *testing.T) {
 	require := require.New(t)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	store := newMemTestStore(ctx, t)
 	rs := ratchet.NewMemStore(ctx)
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(err)
 
-	a, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
-	if err != nil {
+	big := make([]byte, 1024*300)
+	rand.New(rand.NewSource(1)).Read(big)
+	var expect []string
+	for _, hierarchy := range []string{"public", "private"} {
+		files := map[string][]byte{
+			"a.txt":            []byte("a"),
+			"empty.txt":        nil,
+			"dir/b.txt":        []byte("bbb"),
+			"dir/sub/big.bin":  big,
+			"dir/sub/zeta.txt": []byte("last"),
+		}
+		for name, data := range files {
+			err = fsys.Write(hierarchy+"/"+name, base.NewMemfileBytes(path.Base(name), data))
+			require.Nil(err)
+			expect = append(expect, hierarchy+"/"+name)
+		}
+		require.Nil(fsys.Mkdir(hierarchy + "/dir/empty"))
+		require.Nil(fsys.Symlink("dir/b.txt", hierarchy+"/link.txt"))
+		require.Nil(fsys.Symlink("dir/sub", hierarchy+"/linkdir"))
+		expect = append(expect, hierarchy+"/dir/empty", hierarchy+"/link.txt")
+	}
+
+	if err := fstest.TestFS(fsys, expect...); err != nil {
 		t.Fatal(err)
 	}
 
-	pathStr := "public/foo/hello.txt"
-	fileContents := []byte("hello!")
-	f := base.NewMemfileBytes("hello.txt", fileContents)
-	err = a.Write(pathStr, f)
+	res, err := fsys.Commit()
 	require.Nil(err)
-	_, err = a.Commit()
+	fsys, err = FromCID(ctx, store.Blockservice(), rs, res.Root, *res.PrivateKey, *res.PrivateName)
 	require.Nil(err)
+	if err := fstest.TestFS(fsys, expect...); err != nil {
+		t.Fatal(err)
+	}
 
-	pn, err := a.PrivateName()
-	require.Nil(err)
+	for _, hierarchy := range []string{"public", "private"} {
+		sub, err := fs.Sub(fsys, hierarchy+"/dir")
+		require.Nil(err)
+		if err := fstest.TestFS(sub, "b.txt", "sub/big.bin", "empty"); err != nil {
+			t.Fatal(err)
+		}
 
-	b, err := FromCID(ctx, store.Blockservice(), rs, a.Cid(), a.RootKey(), pn)
-	require.Nil(err)
+		// each open directory tracks its own position
+		a, err := fsys.Open(hierarchy + "/dir")
+		require.Nil(err)
+		b, err := fsys.Open(hierarchy + "/dir")
+		require.Nil(err)
+		ents, err := a.(fs.ReadDirFile).ReadDir(2)
+		require.Nil(err)
+		require.Equal(2, len(ents))
+		ents, err = b.(fs.ReadDirFile).ReadDir(-1)
+		require.Nil(err)
+		require.Equal(3, len(ents))
+		ents, err = a.(fs.ReadDirFile).ReadDir(2)
+		require.Nil(err)
+		require.Equal(1, len(ents))
+		_, err = a.(fs.ReadDirFile).ReadDir(2)
+		require.Equal(io.EOF, err)
 
-	pathStr = "public/foo/world.txt"
-	fileContents = []byte("world!")
-	f = base.NewMemfileBytes("world.txt", fileContents)
-	err = a.Write(pathStr, f)
-	require.Nil(err)
-	_, err = a.Commit()
+		ents, err = fsys.ReadDir(hierarchy)
+		require.Nil(err)
+		require.Equal("link.txt", ents[3].Name())
+		info, err := ents[3].Info()
+		require.Nil(err)
+		require.Equal("link.txt", info.Name())
+		require.Equal(fs.ModeSymlink, ents[3].Type())
+
+		_, err = fsys.Stat(hierarchy + "/missing.txt")
+		require.ErrorIs(err, fs.ErrNotExist)
+		_, err = fsys.Open("/" + hierarchy + "/a.txt")
+		require.ErrorIs(err, fs.ErrInvalid)
+		_, err = fs.Sub(fsys, hierarchy+"/a.txt")
+		require.NotNil(err)
+	}
+
+	matches, err := fs.Glob(fsys, "*/dir/*.txt")
 	require.Nil(err)
+	require.Equal([]string{"private/dir/b.txt", "public/dir/b.txt"}, matches)
 
-	pathStr = "public/bonjour.txt"
-	fileContents = []byte("bjr!")
-	f = base.NewMemfileBytes("bonjour.txt", fileContents)
-	err = b.Write(pathStr, f)
+	// copying from a sub filesystem of fsys reads while Cp holds the lock
+	pub, err := fs.Sub(fsys, "public")
 	require.Nil(err)
-	_, err = a.Commit()
+	done := make(chan error)
+	go func() { done <- fsys.Cp("private/copy", "dir", pub) }()
+	select {
+	case err = <-done:
+		require.Nil(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out copying from a sub filesystem")
+	}
+	got, err := fsys.ReadFile("private/copy/b.txt")
 	require.Nil(err)
+	want, err := fsys.ReadFile("public/dir/b.txt")
+	require.Nil(err)
+	require.Equal(want, got)
+}
 
-	err = Merge(ctx, a, b)
+func TestExport(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
 	require.Nil(err)
-	res, err := a.Commit()
+
+	files := map[string]string{
+		"dir/a.txt":            "a",
+		"dir/sub/b.txt":        "bb",
+		"dir/sub/deeper/c.txt": "ccc",
+	}
+	for _, hierarchy := range []string{"public", "private"} {
+		for p, data := range files {
+			err = fsys.Write(hierarchy+"/"+p, base.NewMemfileBytes(filepath.Base(p), []byte(data)))
+			require.Nil(err)
+		}
+		err = fsys.Mkdir(hierarchy + "/dir/empty")
+		require.Nil(err)
+		err = fsys.Symlink("sub/b.txt", hierarchy+"/dir/link.txt")
+		require.Nil(err)
+		err = fsys.Symlink("/dir/sub/b.txt", hierarchy+"/dir/sub/deeper/abs.txt")
+		require.Nil(err)
+	}
+	_, err = fsys.Commit()
 	require.Nil(err)
 
-	t.Logf("%#v", res)
+	for _, hierarchy := range []string{"public", "private"} {
+		dir, err := ioutil.TempDir("", "wnfs_export")
+		require.Nil(err)
+		defer os.RemoveAll(dir)
+
+		err = fsys.Export(ctx, hierarchy+"/dir", NewDirTarget(dir))
+		require.Nil(err)
+		for p, data := range files {
+			got, err := ioutil.ReadFile(filepath.Join(dir, strings.TrimPrefix(p, "dir/")))
+			require.Nil(err)
+			require.Equal(data, string(got))
+		}
+		fi, err := os.Stat(filepath.Join(dir, "empty"))
+		require.Nil(err)
+		require.True(fi.IsDir())
+		target, err := os.Readlink(filepath.Join(dir, "link.txt"))
+		require.Nil(err)
+		require.Equal("sub/b.txt", target)
+		// absolute targets are relative to the hierarchy root, not the host
+		target, err = os.Readlink(filepath.Join(dir, "sub", "deeper", "abs.txt"))
+		require.Nil(err)
+		require.Equal("../b.txt", target)
+		data, err := ioutil.ReadFile(filepath.Join(dir, "sub", "deeper", "abs.txt"))
+		require.Nil(err)
+		require.Equal("bb", string(data))
+
+		f, err := fsys.Open(hierarchy + "/dir/sub/b.txt")
+		require.Nil(err)
+		wfi, err := f.Stat()
+		require.Nil(err)
+		fi, err = os.Stat(filepath.Join(dir, "sub", "b.txt"))
+		require.Nil(err)
+		require.Equal(wfi.ModTime().Unix(), fi.ModTime().Unix())
+
+		buf := &bytes.Buffer{}
+		err = fsys.Export(ctx, hierarchy+"/dir", NewTarTarget(buf))
+		require.Nil(err)
+		got := map[string]string{}
+		links := map[string]string{}
+		tr := tar.NewReader(buf)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.Nil(err)
+			switch hdr.Typeflag {
+			case tar.TypeReg:
+				data, err := ioutil.ReadAll(tr)
+				require.Nil(err)
+				got["dir/"+hdr.Name] = string(data)
+			case tar.TypeSymlink:
+				links[hdr.Name] = hdr.Linkname
+			}
+		}
+		require.Equal(files, got)
+		require.Equal(map[string]string{"link.txt": "sub/b.txt", "sub/deeper/abs.txt": "../b.txt"}, links)
+
+		// exporting a single file writes it by name
+		buf.Reset()
+		err = fsys.Export(ctx, hierarchy+"/dir/a.txt", NewTarTarget(buf))
+		require.Nil(err)
+		hdr, err := tar.NewReader(buf).Next()
+		require.Nil(err)
+		require.Equal("a.txt", hdr.Name)
+	}
+}
+
+func TestCipherSuites(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+	requireSuite := func(fsys WNFS, suite ciphersuite.Suite) {
+		t.Helper()
+		fi, err := fsys.Stat("private")
+		require.Nil(t, err)
+		ps, ok := fi.Sys().(private.Store)
+		require.True(t, ok)
+		require.Equal(t, suite, ps.CipherSuite())
+	}
+
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey, CipherSuite(ciphersuite.ChaCha20Poly1305))
+	require.Nil(t, err)
+	requireSuite(fsys, ciphersuite.ChaCha20Poly1305)
+	err = fsys.Write("private/chacha.txt", base.NewMemfileBytes("chacha.txt", []byte("chacha")))
+	require.Nil(t, err)
+	res, err := fsys.Commit()
+	require.Nil(t, err)
+
+	for _, suite := range []ciphersuite.Suite{ciphersuite.AESGCM, ciphersuite.XChaCha20Poly1305} {
+		fsys, err = FromCID(ctx, store.Blockservice(), rs, res.Root, *res.PrivateKey, *res.PrivateName, CipherSuite(suite))
+		require.Nil(t, err)
+		requireSuite(fsys, suite)
+		err = fsys.Write("private/"+suite.String()+".txt", base.NewMemfileBytes(suite.String()+".txt", []byte(suite.String())))
+		require.Nil(t, err)
+		res, err = fsys.Commit()
+		require.Nil(t, err)
+	}
+
+	// files written with each suite are readable without specifying a suite
+	fsys, err = FromCID(ctx, store.Blockservice(), rs, res.Root, *res.PrivateKey, *res.PrivateName)
+	require.Nil(t, err)
+	requireSuite(fsys, ciphersuite.Default)
+	for _, name := range []string{"chacha", "aes-gcm", "xchacha20-poly1305"} {
+		data, err := fsys.Cat("private/" + name + ".txt")
+		require.Nil(t, err)
+		require.Equal(t, name, string(data))
+	}
+
+	// history written with other suites is readable
+	old, err := fsys.Checkout(2)
+	require.Nil(t, err)
+	data, err := old.Cat("private/chacha.txt")
+	require.Nil(t, err)
+	require.Equal(t, "chacha", string(data))
+}
+
+func TestCAR(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newMemTestStore(ctx, t)
+	rs := ratchet.NewMemStore(ctx)
+	dec, err := private.NewDecryptionStore(filepath.Join(t.TempDir(), "decryption.json"))
+	require.Nil(t, err)
+	fac := Factory{BlockService: store.Blockservice(), Ratchets: rs, Decryption: dec}
+
+	fsys, err := NewEmptyFS(ctx, store.Blockservice(), rs, testRootKey)
+	require.Nil(t, err)
+
+	big := make([]byte, 600*1024)
+	_, err = rand.Read(big)
+	require.Nil(t, err)
+	versions := []string{"one", "two", "three"}
+	var res CommitResult
+	for _, content := range versions {
+		for _, hierarchy := range []string{"public", "private"} {
+			err = fsys.Write(hierarchy+"/dir/foo.txt", base.NewMemfileBytes("foo.txt", []byte(content)))
+			require.Nil(t, err)
+		}
+		res, err = fac.Commit(fsys)
+		require.Nil(t, err)
+	}
+	for _, hierarchy := range []string{"public", "private"} {
+		err = fsys.Write(hierarchy+"/big.bin", base.NewMemfileBytes("big.bin", big))
+		require.Nil(t, err)
+		err = fsys.Write(hierarchy+"/meta.txt", public.WrapFileMetadata(base.NewMemfileBytes("meta.txt", []byte("meta")), map[string]interface{}{"hello": "world"}))
+		require.Nil(t, err)
+	}
+	res, err = fac.Commit(fsys)
+	require.Nil(t, err)
+	versions = append(versions, "three")
+
+	for _, version := range []int{1, 2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			require := require.New(t)
+			buf := &bytes.Buffer{}
+			err := fac.ExportCAR(ctx, res.Root, buf, CAROptions{Version: version})
+			require.Nil(err)
+			if version == 2 {
+				checkCARv2Index(t, buf.Bytes())
+			}
+
+			dst := Factory{BlockService: mockblocks.NewOfflineMemBlockservice(), Ratchets: rs}
+			roots, err := dst.ImportCAR(ctx, buf)
+			require.Nil(err)
+			require.Equal([]cid.Cid{res.Root}, roots)
+
+			imported, err := dst.LoadWithDecryption(ctx, res.Root, *res.PrivateName, *res.PrivateKey)
+			require.Nil(err)
+			for _, hierarchy := range []string{"public", "private"} {
+				got, err := imported.Cat(hierarchy + "/big.bin")
+				require.Nil(err)
+				require.True(bytes.Equal(big, got))
+				f, err := imported.Open(hierarchy + "/meta.txt")
+				require.Nil(err)
+				md, err := f.(base.Node).Metadata()
+				require.Nil(err, hierarchy)
+				_, err = md.Data()
+				require.Nil(err)
+				f.Close()
+			}
+
+			// every committed version is readable from the imported blocks
+			for n := range versions {
+				old, err := imported.Checkout(n)
+				require.Nil(err)
+				for _, hierarchy := range []string{"public", "private"} {
+					got, err := old.Cat(hierarchy + "/dir/foo.txt")
+					require.Nil(err, "version %d %s", n, hierarchy)
+					require.Equal(versions[len(versions)-1-n], string(got))
+				}
+			}
+		})
+	}
+
+	// tampered blocks are rejected
+	buf := &bytes.Buffer{}
+	require.Nil(t, fac.ExportCAR(ctx, res.Root, buf, CAROptions{}))
+	data := buf.Bytes()
+	data[len(data)-1] ^= 0xff
+	_, err = Factory{BlockService: mockblocks.NewOfflineMemBlockservice()}.ImportCAR(ctx, bytes.NewReader(data))
+	require.NotNil(t, err)
+
+	// private blocks can't be found without decryption fields
+	err = Factory{BlockService: store.Blockservice(), Ratchets: rs}.ExportCAR(ctx, res.Root, ioutil.Discard, CAROptions{})
+	require.NotNil(t, err)
+}
+
+func TestBundle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newFactory := func() Factory {
+		dec, err := private.NewDecryptionStore(filepath.Join(t.TempDir(), "decryption.json"))
+		require.Nil(t, err)
+		return Factory{
+			BlockService: mockblocks.NewOfflineMemBlockservice(),
+			Ratchets:     ratchet.NewMemStore(ctx),
+			Decryption:   dec,
+		}
+	}
+	write := func(fsys WNFS, name, content string) {
+		t.Helper()
+		for _, hierarchy := range []string{"public", "private"} {
+			err := fsys.Write(hierarchy+"/"+name, base.NewMemfileBytes(name, []byte(content)))
+			require.Nil(t, err)
+		}
+	}
+	requireContents := func(fsys WNFS, name, content string) {
+		t.Helper()
+		for _, hierarchy := range []string{"public", "private"} {
+			got, err := fsys.Cat(hierarchy + "/" + name)
+			require.Nil(t, err, "%s/%s", hierarchy, name)
+			require.Equal(t, content, string(got))
+		}
+	}
+
+	a := newFactory()
+	fsA, err := NewEmptyFS(ctx, a.BlockService, a.Ratchets, testRootKey)
+	require.Nil(t, err)
+	write(fsA, "shared.txt", "shared")
+	base0, err := a.Commit(fsA)
+	require.Nil(t, err)
+
+	// clone a into b, as copying a repo directory would
+	b := newFactory()
+	buf := &bytes.Buffer{}
+	require.Nil(t, a.CreateBundle(ctx, base0.Root, cid.Undef, buf))
+	_, err = b.ImportCAR(ctx, buf)
+	require.Nil(t, err)
+	require.Nil(t, b.Decryption.(private.WritableDecryptionStore).PutDecryptionFields(base0.Root, *base0.PrivateName, *base0.PrivateKey))
+	err = a.Ratchets.ForEach(ctx, func(name string, r *ratchet.Spiral) error {
+		_, err := b.Ratchets.PutRatchet(ctx, name, r)
+		return err
+	})
+	require.Nil(t, err)
+	fsB, err := b.Load(ctx, base0.Root)
+	require.Nil(t, err)
+
+	write(fsA, "a.txt", "from a")
+	headA, err := a.Commit(fsA)
+	require.Nil(t, err)
+	write(fsB, "b.txt", "from b")
+	_, err = b.Commit(fsB)
+	require.Nil(t, err)
+
+	full := &bytes.Buffer{}
+	require.Nil(t, a.ExportCAR(ctx, headA.Root, full, CAROptions{}))
+	buf.Reset()
+	require.Nil(t, a.CreateBundle(ctx, headA.Root, base0.Root, buf))
+	require.True(t, buf.Len() < full.Len(), "bundle of %d bytes should be smaller than full export of %d bytes", buf.Len(), full.Len())
+
+	// b has no keys for headA, & finds them by ratcheting forward from base0
+	head, err := b.ApplyBundle(ctx, fsB, buf)
+	require.Nil(t, err)
+	require.True(t, head.Equals(headA.Root))
+	merged, err := b.Commit(fsB)
+	require.Nil(t, err)
+	requireContents(fsB, "shared.txt", "shared")
+	requireContents(fsB, "a.txt", "from a")
+	requireContents(fsB, "b.txt", "from b")
+
+	// send the merge back to a
+	buf.Reset()
+	require.Nil(t, b.CreateBundle(ctx, merged.Root, headA.Root, buf))
+	_, err = a.ApplyBundle(ctx, fsA, buf)
+	require.Nil(t, err)
+	_, err = a.Commit(fsA)
+	require.Nil(t, err)
+	requireContents(fsA, "a.txt", "from a")
+	requireContents(fsA, "b.txt", "from b")
+
+	// bundles created against versions a peer doesn't know can't be opened
+	c := newFactory()
+	fsC, err := NewEmptyFS(ctx, c.BlockService, c.Ratchets, NewKey())
+	require.Nil(t, err)
+	buf.Reset()
+	require.Nil(t, a.CreateBundle(ctx, headA.Root, base0.Root, buf))
+	_, err = c.ApplyBundle(ctx, fsC, buf)
+	require.NotNil(t, err)
+}
+
+// checkCARv2Index confirms every entry of a CARv2 sorted index points to the
+// section of a block with a matching digest
+func checkCARv2Index(t *testing.T, car []byte) {
+	t.Helper()
+	require := require.New(t)
+	require.Equal(carV2Pragma, car[:carV2PragmaSize])
+	hdr := car[carV2PragmaSize : carV2PragmaSize+carV2HeaderSize]
+	dataOffset := binary.LittleEndian.Uint64(hdr[16:])
+	indexOffset := binary.LittleEndian.Uint64(hdr[32:])
+	data := car[dataOffset:indexOffset]
+
+	idx := bytes.NewReader(car[indexOffset:])
+	codec, err := binary.ReadUvarint(idx)
+	require.Nil(err)
+	require.Equal(uint64(carIndexSorted), codec)
+	var buckets int32
+	require.Nil(binary.Read(idx, binary.LittleEndian, &buckets))
+	entries := 0
+	for i := int32(0); i < buckets; i++ {
+		var width uint32
+		var size int64
+		require.Nil(binary.Read(idx, binary.LittleEndian, &width))
+		require.Nil(binary.Read(idx, binary.LittleEndian, &size))
+		for j := int64(0); j < size/int64(width); j++ {
+			ent := make([]byte, width)
+			_, err := io.ReadFull(idx, ent)
+			require.Nil(err)
+			digest, offset := ent[:width-8], binary.LittleEndian.Uint64(ent[width-8:])
+
+			blk, err := readCARSection(bufio.NewReader(bytes.NewReader(data[offset:])))
+			require.Nil(err)
+			dh, err := mh.Decode(blk.Cid().Hash())
+			require.Nil(err)
+			require.Equal(digest, dh.Digest)
+			entries++
+		}
+	}
+	require.Equal(0, idx.Len())
+	require.True(entries > 0)
 }
 
 func BenchmarkPublicCat10MbFile(t *testing.B) {
@@ -574,6 +2456,57 @@ func BenchmarkPrivateCp10DirectoriesWithOne10MbFileEach(t *testing.B) {
 	}
 }
 
+func BenchmarkPublicWriteNestedFiles(b *testing.B) {
+	benchmarkWriteNestedFiles(b, "public")
+}
+
+func BenchmarkPublicWriteNestedFilesDeferFlush(b *testing.B) {
+	benchmarkWriteNestedFiles(b, "public", DeferFlush)
+}
+
+func BenchmarkPrivateWriteNestedFiles(b *testing.B) {
+	benchmarkWriteNestedFiles(b, "private")
+}
+
+func BenchmarkPrivateWriteNestedFilesDeferFlush(b *testing.B) {
+	benchmarkWriteNestedFiles(b, "private", DeferFlush)
+}
+
+// benchmarkWriteNestedFiles writes 10 files four directories deep per commit,
+// reporting the number of blocks written per commit
+func benchmarkWriteNestedFiles(b *testing.B, hierarchy string, opts ...Option) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := newCountingBlockstore()
+	rs := ratchet.NewMemStore(ctx)
+	fsys, err := NewEmptyFS(ctx, blockservice.New(bs, nil), rs, testRootKey, opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	data := make([]byte, 1024)
+	if _, err := rand.Read(data); err != nil {
+		b.Fatal(err)
+	}
+	bs.puts.Store(0)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 10; j++ {
+			name := fmt.Sprintf("file_%d.txt", j)
+			if err := fsys.Write(hierarchy+"/a/b/c/d/"+name, base.NewMemfileBytes(name, data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if _, err := fsys.Commit(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(bs.puts.Load())/float64(b.N), "blockwrites/op")
+}
+
 type fataler interface {
 	Name() string
 	Helper()
@@ -605,3 +2538,31 @@ func newFileTestStore(ctx context.Context, f fataler) (st public.Store, cleanup
 	store := public.NewStore(ctx, bserv)
 	return store, cleanup
 }
+
+// countingBlockstore counts blocks written to & read from an in-memory
+// blockstore. Blockservices read & write from multiple goroutines, so counts
+// are atomic
+type countingBlockstore struct {
+	blockstore.Blockstore
+	puts atomic.Int64
+	gets atomic.Int64
+}
+
+func newCountingBlockstore() *countingBlockstore {
+	return &countingBlockstore{Blockstore: mockblocks.NewMemBlockstore()}
+}
+
+func (bs *countingBlockstore) Put(ctx context.Context, blk blocks.Block) error {
+	bs.puts.Add(1)
+	return bs.Blockstore.Put(ctx, blk)
+}
+
+func (bs *countingBlockstore) Get(ctx context.Context, id cid.Cid) (blocks.Block, error) {
+	bs.gets.Add(1)
+	return bs.Blockstore.Get(ctx, id)
+}
+
+func (bs *countingBlockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	bs.puts.Add(int64(len(blks)))
+	return bs.Blockstore.PutMany(ctx, blks)
+}